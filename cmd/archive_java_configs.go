@@ -0,0 +1,225 @@
+package cmd
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	log "github.com/gkontos/bivalve-chronicles"
+
+	"github.com/gkontos/spiny-dogfish/model"
+)
+
+// archiveSeparator separates an archive from the entry within it, as in app.jar!/BOOT-INF/classes/application.yml
+const archiveSeparator = "!/"
+
+// defaultArchives are read when no archives are configured: the jar or war built by maven
+var defaultArchives = []string{"target/*.jar", "target/*.war"}
+
+// packagedLayouts are the directories of a spring boot jar and war that hold the application's own classes and
+// the jars of its dependencies
+var packagedLayouts = []struct {
+	classes string
+	lib     string
+}{
+	{classes: "BOOT-INF/classes/", lib: "BOOT-INF/lib/"},
+	{classes: "WEB-INF/classes/", lib: "WEB-INF/lib/"},
+}
+
+// classpathEntry is a single root of the classpath within an archive: the archive itself, the classes directory of
+// a spring boot archive or a nested dependency jar
+type classpathEntry struct {
+	// path is the entry as it is shown, ie: app.jar!/BOOT-INF/lib/starter.jar
+	path   string
+	reader *zip.Reader
+	// prefix is the directory within reader that is the root of the classpath
+	prefix string
+}
+
+// archivePaths are the configured archives, or those built into target when none are configured.  Relative paths
+// and globs are resolved against the project root
+func (appCtx *Pruner) archivePaths() ([]string, error) {
+	patterns := appCtx.Config.Archives
+	if len(patterns) == 0 {
+		patterns = defaultArchives
+	}
+	paths := make([]string, 0)
+	for _, pattern := range patterns {
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(appCtx.Config.ProjectRoot, pattern)
+		}
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid archive pattern %q: %v", pattern, err)
+		}
+		sort.Strings(matches)
+		paths = append(paths, matches...)
+	}
+	return paths, nil
+}
+
+// scanArchives will find the configuration files packaged in the archives, in classpath order.  Spring reads
+// classpath:/application.yml from the first classpath entry that has one, so a file that the project or an earlier
+// jar already provides is skipped.  The classes of a spring boot archive are a packaged copy of src/main/resources
+// and are only read when the project has no resources directory
+func (appCtx *Pruner) scanArchives(projectFiles []model.JavaConfigFileMetadata) *scanSummary {
+	summary := &scanSummary{root: "archives", discovered: make([]model.JavaConfigFileMetadata, 0), skipped: make([]skippedPath, 0)}
+	archives, err := appCtx.archivePaths()
+	if err != nil {
+		summary.skipped = append(summary.skipped, skippedPath{path: strings.Join(appCtx.Config.Archives, ", "), reason: err.Error()})
+		return summary
+	}
+	resources := filepath.Join(appCtx.Config.ProjectRoot, javaClasspathResourcePath)
+	_, statErr := os.Stat(resources)
+	hasResources := statErr == nil
+
+	// provided maps each classpath relative file to the path that provides it
+	provided := make(map[string]string)
+	for _, file := range projectFiles {
+		provided[path.Join(file.Location, path.Base(filepath.ToSlash(file.Path)))] = file.Path
+	}
+	for _, archive := range archives {
+		reader, err := zip.OpenReader(archive)
+		if err != nil {
+			summary.skipped = append(summary.skipped, skippedPath{path: archive, reason: fmt.Sprintf("unable to open archive: %v", err)})
+			continue
+		}
+		for _, entry := range classpathEntries(archive, &reader.Reader, summary) {
+			if entry.prefix != "" && hasResources {
+				summary.skipped = append(summary.skipped, skippedPath{path: entry.path + archiveSeparator + entry.prefix,
+					reason: "packaged copy of " + javaClasspathResourcePath})
+				continue
+			}
+			for _, file := range entry.reader.File {
+				if file.FileInfo().IsDir() || !strings.HasPrefix(file.Name, entry.prefix) {
+					continue
+				}
+				relative := strings.TrimPrefix(file.Name, entry.prefix)
+				location := path.Dir(relative)
+				if location == "." {
+					location = ""
+				}
+				// spring only searches classpath:/ and classpath:/config/ so everything else is silent
+				if location != "" && location != "config" {
+					continue
+				}
+				fullPath := entry.path + archiveSeparator + file.Name
+				configFile, reason := configFileMetadata(path.Dir(fullPath), path.Base(relative))
+				if reason != "" {
+					continue
+				}
+				if first, shadowed := provided[relative]; shadowed {
+					summary.skipped = append(summary.skipped, skippedPath{path: fullPath, reason: "shadowed by " + first})
+					continue
+				}
+				provided[relative] = fullPath
+				configFile.Path = fullPath
+				configFile.Location = location
+				configFile.Archive = archive
+				summary.discovered = append(summary.discovered, configFile)
+			}
+		}
+		reader.Close()
+	}
+	return summary
+}
+
+// classpathEntries will return the classpath roots of an archive in order: the classes of a spring boot jar or
+// war followed by each of its nested dependency jars, or the archive itself for a plain jar
+func classpathEntries(archive string, reader *zip.Reader, summary *scanSummary) []classpathEntry {
+	for _, layout := range packagedLayouts {
+		libraries := make([]*zip.File, 0)
+		isPackaged := false
+		for _, file := range reader.File {
+			if strings.HasPrefix(file.Name, layout.classes) {
+				isPackaged = true
+			}
+			if strings.HasPrefix(file.Name, layout.lib) && strings.HasSuffix(file.Name, ".jar") {
+				libraries = append(libraries, file)
+			}
+		}
+		if !isPackaged && len(libraries) == 0 {
+			continue
+		}
+		entries := []classpathEntry{{path: archive, reader: reader, prefix: layout.classes}}
+		for _, library := range libraries {
+			nested, err := openNestedArchive(library)
+			if err != nil {
+				summary.skipped = append(summary.skipped, skippedPath{path: archive + archiveSeparator + library.Name, reason: fmt.Sprintf("unable to open archive: %v", err)})
+				continue
+			}
+			entries = append(entries, classpathEntry{path: archive + archiveSeparator + library.Name, reader: nested})
+		}
+		return entries
+	}
+	return []classpathEntry{{path: archive, reader: reader}}
+}
+
+func openNestedArchive(file *zip.File) (*zip.Reader, error) {
+	content, err := readZipFile(file)
+	if err != nil {
+		return nil, err
+	}
+	return zip.NewReader(bytes.NewReader(content), int64(len(content)))
+}
+
+func readZipFile(file *zip.File) ([]byte, error) {
+	opened, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer opened.Close()
+	return ioutil.ReadAll(opened)
+}
+
+// readArchiveEntry will read a file packaged in an archive, following each !/ into a nested archive
+func readArchiveEntry(archivePath string) ([]byte, error) {
+	parts := strings.Split(archivePath, archiveSeparator)
+	outer, err := zip.OpenReader(parts[0])
+	if err != nil {
+		return nil, err
+	}
+	defer outer.Close()
+	reader := &outer.Reader
+	for i, name := range parts[1:] {
+		var found *zip.File
+		for _, file := range reader.File {
+			if file.Name == name {
+				found = file
+				break
+			}
+		}
+		if found == nil {
+			return nil, fmt.Errorf("%s is not in %s", name, strings.Join(parts[:i+1], archiveSeparator))
+		}
+		if i == len(parts)-2 {
+			return readZipFile(found)
+		}
+		if reader, err = openNestedArchive(found); err != nil {
+			return nil, err
+		}
+	}
+	return nil, fmt.Errorf("%s does not name a file within an archive", archivePath)
+}
+
+// isReadOnly reports whether a source is packaged in an archive, where it is read but never changed
+func isReadOnly(source model.JavaConfigFileMetadata) bool {
+	return source.Archive != ""
+}
+
+// loadArchiveFiles will add the configuration files packaged in archives to the classpath files
+func (appCtx *Pruner) loadArchiveFiles() {
+	summary := appCtx.scanArchives(appCtx.ConfigFiles[classpathFileKey])
+	if len(summary.discovered) == 0 && len(summary.skipped) == 0 {
+		log.Debugf("No archives found")
+		return
+	}
+	summary.logSummary()
+	appCtx.ConfigFiles[classpathFileKey] = append(appCtx.ConfigFiles[classpathFileKey], expandDocuments(summary.discovered)...)
+}
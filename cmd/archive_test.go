@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"archive/zip"
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// zipContent will build an archive holding the files in the order given
+func zipContent(t *testing.T, files ...string) []byte {
+	var buffer bytes.Buffer
+	writer := zip.NewWriter(&buffer)
+	for i := 0; i < len(files); i += 2 {
+		entry, err := writer.Create(files[i])
+		assert.Nil(t, err)
+		_, err = entry.Write([]byte(files[i+1]))
+		assert.Nil(t, err)
+	}
+	assert.Nil(t, writer.Close())
+	return buffer.Bytes()
+}
+
+func TestArchivesAreReadAsClasspath(t *testing.T) {
+	appCtx, cleanup := newTestPruner(t, map[string]string{
+		"application.yml":     "server:\n  port: 8080\n",
+		"application-dev.yml": "server:\n  port: 8081\n",
+	})
+	defer cleanup()
+	starter := zipContent(t,
+		"META-INF/MANIFEST.MF", "Manifest-Version: 1.0\n",
+		"application.yml", "starter:\n  shadowed: true\n",
+		"config/application-dev.yml", "starter:\n  enabled: true\n  port: 9000\nserver:\n  port: 9001\n",
+		"templates/application.yml", "ignored: true\n",
+	)
+	other := zipContent(t, "config/application-dev.yml", "other:\n  shadowed: true\n")
+	fatJar := zipContent(t,
+		"BOOT-INF/classes/application.yml", "stale: true\n",
+		"BOOT-INF/lib/starter-1.0.jar", string(starter),
+		"BOOT-INF/lib/other-1.0.jar", string(other),
+	)
+	jar := filepath.Join(appCtx.Config.ProjectRoot, "target", "app.jar")
+	assert.Nil(t, os.MkdirAll(filepath.Dir(jar), 0755))
+	assert.Nil(t, os.WriteFile(jar, fatJar, 0644))
+	appCtx.LoadConfigFileMetadata()
+
+	starterDev := jar + "!/BOOT-INF/lib/starter-1.0.jar!/config/application-dev.yml"
+	paths := make([]string, 0)
+	for _, file := range appCtx.ConfigFiles[classpathFileKey] {
+		if isReadOnly(file) {
+			paths = append(paths, file.Path)
+		}
+	}
+	assert.EqualValues(t, []string{starterDev}, paths, "the packaged classes, shadowed files and other directories are skipped")
+
+	properties, err := appCtx.unionProfileAndContext("dev", "application")
+	assert.Nil(t, err)
+	port, _ := properties.get("server.port")
+	assert.Equal(t, 9001, port.value, "classpath:/config/ overrides classpath:/")
+	assert.Equal(t, starterDev, port.source)
+	_, found := properties.get("stale")
+	assert.False(t, found)
+
+	// packaged files are never rewritten
+	assert.Len(t, appCtx.profileSources("dev", "application"), 1)
+	appCtx.Config.InPlace = true
+	assert.Nil(t, appCtx.Prune([]string{"dev"}, []string{"application"}))
+	_, err = readArchiveEntry(starterDev)
+	assert.Nil(t, err)
+	_, err = readArchiveEntry(jar + "!/BOOT-INF/lib/missing.jar!/application.yml")
+	assert.EqualError(t, err, "BOOT-INF/lib/missing.jar is not in "+jar)
+}
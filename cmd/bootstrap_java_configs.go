@@ -0,0 +1,452 @@
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/gkontos/bivalve-chronicles"
+
+	"github.com/gkontos/spiny-dogfish/model"
+)
+
+const (
+	// applicationContext is the main context of a spring application
+	applicationContext = "application"
+	// bootstrapContext is the spring cloud bootstrap context.  It is read before the application context, to locate
+	// remote configuration, and the application context sees every bootstrap property it does not set itself
+	bootstrapContext = "bootstrap"
+)
+
+const (
+	// redundantKey is set to the same value in the bootstrap and application files of a profile
+	redundantKey = "redundant"
+	// overriddenKey is set in both files of a profile and the application value hides the bootstrap value
+	overriddenKey = "overridden"
+	// misplacedKey is only set in the files of the context it does not belong in
+	misplacedKey = "misplaced"
+)
+
+// bootstrapPrefixes are the keys the bootstrap context reads to name the application and to locate and decrypt its
+// remote configuration.  Every other key belongs in the application context
+var bootstrapPrefixes = []string{
+	"spring.application.name",
+	"spring.cloud.bootstrap",
+	"spring.cloud.config",
+	"spring.cloud.vault",
+	"spring.cloud.consul",
+	"spring.cloud.zookeeper",
+	"spring.cloud.kubernetes.config",
+	"spring.cloud.kubernetes.secrets",
+	"spring.cloud.nacos.config",
+	"encrypt",
+}
+
+// inheritanceFinding is a key of a profile's own bootstrap or application files that is repeated across the two
+// contexts or set in the wrong one
+type inheritanceFinding struct {
+	profile string
+	kind    string
+	// bootstrap and application are the values set by the profile's own files; one is nil for a misplaced key
+	bootstrap   *property
+	application *property
+	// home is the context the key belongs in
+	home string
+}
+
+// key is the name of the finding as it is spelled in the files
+func (finding inheritanceFinding) key() string {
+	if finding.bootstrap != nil {
+		return finding.bootstrap.name
+	}
+	return finding.application.name
+}
+
+// value will return the property a context sets for the finding
+func (finding inheritanceFinding) value(context string) *property {
+	if context == bootstrapContext {
+		return finding.bootstrap
+	}
+	return finding.application
+}
+
+// contextProfile names the own files of a profile within a context
+type contextProfile struct {
+	context string
+	profile string
+}
+
+// RunBootstrap will prompt for the profiles and report the keys repeated across the bootstrap and application
+// contexts, optionally moving them to the context they belong in
+func (env *Pruner) RunBootstrap() {
+	runProfile, err := promptOptionalString("Profiles to compare (semi-colon separated list, blank for every profile)")
+	if err != nil {
+		log.Errorf("Error: %v", err)
+		return
+	}
+	move, err := promptOptionalString("Move the keys to the context they belong in (y/N)")
+	if err != nil {
+		log.Errorf("Error: %v", err)
+		return
+	}
+	if err := env.Bootstrap(SplitProfiles(runProfile), strings.EqualFold(strings.TrimSpace(move), "y")); err != nil {
+		log.Errorf("Error: %v", err)
+	}
+}
+
+// Bootstrap will compare the bootstrap and application files of the default profile and each of the profiles.  The
+// application context inherits every bootstrap key, so a key set to the same value in both is redundant, a key set
+// to different values hides the bootstrap value from the application, and a key is misplaced when it is only set in
+// the context it does not belong in.  With move the keys are moved to the context they belong in, or their
+// redundant copy is deleted, as long as the value the application context sees does not change in any profile.
+// Files are rewritten in place after backing them up, unless this is a dry run, and every change is recorded in
+// the change report
+func (env *Pruner) Bootstrap(profiles []string, move bool) (err error) {
+	if _, found := Find(reportFormats, env.Config.ReportFormat); !found && env.Config.ReportFormat != "" {
+		return fmt.Errorf("unknown report format %q, expected one of %s", env.Config.ReportFormat, strings.Join(reportFormats, ", "))
+	}
+	scope := env.scopeProfiles(profiles)
+	findings, err := env.inheritanceFindings(scope)
+	if err != nil {
+		return err
+	}
+	counts := make(map[string]int)
+	log.Infof("BOOTSTRAP INHERITANCE (profiles: %s)", strings.Join(scope, ", "))
+	for _, finding := range findings {
+		counts[finding.kind]++
+		log.Infof("%s", env.describeFinding(finding))
+	}
+	log.Infof("%d keys are redundant, %d are overridden and %d are in the wrong context", counts[redundantKey], counts[overriddenKey], counts[misplacedKey])
+	if !move || len(findings) == 0 {
+		return nil
+	}
+
+	results, err := env.inheritanceMoves(scope, findings)
+	if err != nil {
+		return err
+	}
+	if env.Config.DryRun {
+		return env.previewChanges(results)
+	}
+	backup, err := newBackupSession(env.Config.BackupDirectory, time.Now())
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := backup.close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}()
+	for _, result := range results {
+		if err = writeInPlace(result.profileProperties, result.targets, backup); err != nil {
+			return err
+		}
+	}
+	return outputChangeReport(results, env.Config.OutputDirectory, env.Config.ReportFormat, env.Config.ShowSecrets, time.Now())
+}
+
+// inheritanceFindings will compare the own bootstrap and application files of each profile, key by key
+func (env *Pruner) inheritanceFindings(scope []string) ([]inheritanceFinding, error) {
+	referenced, err := env.bootstrapReferences(scope)
+	if err != nil {
+		return nil, err
+	}
+	findings := make([]inheritanceFinding, 0)
+	for _, profile := range scope {
+		bootstrap, err := loadSources(env.ownSources(profile, bootstrapContext))
+		if err != nil {
+			return nil, err
+		}
+		application, err := loadSources(env.ownSources(profile, applicationContext))
+		if err != nil {
+			return nil, err
+		}
+		keys := bootstrap.keys()
+		for _, key := range application.keys() {
+			if _, found := bootstrap.get(key); !found {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			finding := inheritanceFinding{profile: profile, home: env.keyContext(key, referenced)}
+			b, inBootstrap := bootstrap.get(key)
+			a, inApplication := application.get(key)
+			if inBootstrap {
+				finding.bootstrap = &b
+			}
+			if inApplication {
+				finding.application = &a
+			}
+			switch {
+			case inBootstrap && inApplication && valuesEqual(b.value, a.value):
+				finding.kind = redundantKey
+			case inBootstrap && inApplication:
+				finding.kind = overriddenKey
+			case inBootstrap && finding.home == applicationContext, inApplication && finding.home == bootstrapContext:
+				finding.kind = misplacedKey
+			default:
+				continue
+			}
+			findings = append(findings, finding)
+		}
+	}
+	return findings, nil
+}
+
+// bootstrapReferences will collect the keys that a bootstrap value of any of the profiles reads through a
+// placeholder; the bootstrap context can only resolve them from its own files
+func (env *Pruner) bootstrapReferences(scope []string) (map[string]bool, error) {
+	referenced := make(map[string]bool)
+	for _, profile := range scope {
+		properties, err := loadSources(orderSources(env.ConfigFiles, []string{profile}, bootstrapContext, env.Config.Precedence))
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range properties.keys() {
+			p, _ := properties.get(key)
+			for _, value := range indexedProperties(p) {
+				if text, ok := value.value.(string); ok {
+					for _, name := range placeholderNames(text) {
+						referenced[canonicalName(name)] = true
+					}
+				}
+			}
+		}
+	}
+	return referenced, nil
+}
+
+// keyContext will return the context a canonical key belongs in: bootstrap for the keys that locate remote
+// configuration, the configured bootstrap keys and any key a bootstrap value reads, otherwise application
+func (env *Pruner) keyContext(key string, referenced map[string]bool) string {
+	if referenced[key] {
+		return bootstrapContext
+	}
+	for _, prefix := range append(bootstrapPrefixes, env.Config.BootstrapKeys...) {
+		prefix = canonicalName(prefix)
+		if key == prefix || isBelow(key, prefix) {
+			return bootstrapContext
+		}
+	}
+	return applicationContext
+}
+
+// describeFinding will format a finding along with the files it was read from and the context the key belongs in
+func (env *Pruner) describeFinding(finding inheritanceFinding) string {
+	switch finding.kind {
+	case redundantKey:
+		return fmt.Sprintf("[%s] %s = %v is set in both contexts, from %s and %s; keep it in %s",
+			finding.profile, finding.key(), env.displayed(*finding.bootstrap), sourceLocation(*finding.bootstrap), sourceLocation(*finding.application), finding.home)
+	case overriddenKey:
+		return fmt.Sprintf("[%s] %s = %v from %s overrides %v from %s; it belongs in %s",
+			finding.profile, finding.key(), env.displayed(*finding.application), sourceLocation(*finding.application),
+			env.displayed(*finding.bootstrap), sourceLocation(*finding.bootstrap), finding.home)
+	}
+	p := finding.value(otherContext(finding.home))
+	return fmt.Sprintf("[%s] %s = %v is set in %s but belongs in %s", finding.profile, p.name, env.displayed(*p), sourceLocation(*p), finding.home)
+}
+
+// otherContext will return bootstrap for application and application for bootstrap
+func otherContext(context string) string {
+	if context == bootstrapContext {
+		return applicationContext
+	}
+	return bootstrapContext
+}
+
+// inheritanceMoves will plan the changes for the findings and check them against the view of the application
+// context in every profile.  A key whose value would change in any profile is left where it is and reported as a
+// conflict
+func (env *Pruner) inheritanceMoves(scope []string, findings []inheritanceFinding) ([]prunedContext, error) {
+	// skipped maps each key that is left where it is to the profile it would change
+	skipped := make(map[string]string)
+	for {
+		edits, changes := planInheritance(findings, skipped)
+		for key, profile := range skipped {
+			changes[applicationContext] = append(changes[applicationContext], changeSet{key: key, action: conflictAction,
+				profile: profile, profiles: []string{profile},
+				message: fmt.Sprintf("moving %s would change the value the application context sees in the %s profile", key, profile)})
+		}
+		results, configFiles, edited, err := env.inheritanceResults(edits, changes)
+		if err != nil {
+			return nil, err
+		}
+		changed, err := env.changedKeys(scope, configFiles, edited)
+		if err != nil {
+			return nil, err
+		}
+		if len(changed) == 0 {
+			return results, nil
+		}
+		for key := range changed {
+			if _, found := skipped[key]; found {
+				return nil, fmt.Errorf("%s changes in the %s profile even though it is not moved", key, changed[key])
+			}
+		}
+		for key, profile := range changed {
+			log.Infof("%s is left where it is, moving it would change its value in the %s profile", key, profile)
+			skipped[key] = profile
+		}
+	}
+}
+
+// planInheritance will decide the edits to each profile's own files and the changes reported for each context.
+// A redundant copy is deleted from the context the key does not belong in, a bootstrap value hidden by the
+// application is deleted unless the key belongs in bootstrap, and a misplaced key is moved to the file of the same
+// profile in the other context
+func planInheritance(findings []inheritanceFinding, skipped map[string]string) (map[contextProfile]map[string]changeSet, map[string][]changeSet) {
+	edits := make(map[contextProfile]map[string]changeSet)
+	changes := make(map[string][]changeSet)
+	edit := func(context string, profile string, canonical string, change changeSet) {
+		target := contextProfile{context: context, profile: profile}
+		if edits[target] == nil {
+			edits[target] = make(map[string]changeSet)
+		}
+		edits[target][canonical] = change
+	}
+	for _, finding := range findings {
+		canonical := canonicalName(finding.key())
+		if _, skip := skipped[canonical]; skip {
+			continue
+		}
+		other := otherContext(finding.home)
+		p := finding.value(other)
+		switch {
+		case finding.kind == redundantKey:
+			edit(other, finding.profile, canonical, changeSet{key: p.name, delete: true})
+			changes[other] = append(changes[other], changeSet{key: p.name, action: deleteAction, delete: true, oldValue: p.value,
+				profile: finding.profile, profiles: []string{finding.profile}, source: sourceLocation(*p),
+				message: fmt.Sprintf("%s is set to the same value in the %s files of the %s profile", p.name, finding.home, finding.profile)})
+		case finding.kind == overriddenKey && finding.home == applicationContext:
+			edit(other, finding.profile, canonical, changeSet{key: p.name, delete: true})
+			changes[other] = append(changes[other], changeSet{key: p.name, action: deleteAction, delete: true, oldValue: p.value,
+				profile: finding.profile, profiles: []string{finding.profile}, source: sourceLocation(*p),
+				message: fmt.Sprintf("%s is not a bootstrap key and the application files of the %s profile override it", p.name, finding.profile)})
+		case finding.kind == overriddenKey:
+			changes[bootstrapContext] = append(changes[bootstrapContext], changeSet{key: finding.key(), action: conflictAction,
+				profile: finding.profile, profiles: []string{finding.profile},
+				values:  map[string]interface{}{bootstrapContext: finding.bootstrap.value, applicationContext: finding.application.value},
+				message: fmt.Sprintf("the application files of the %s profile override the %s that the bootstrap context reads", finding.profile, finding.key())})
+		case finding.kind == misplacedKey:
+			edit(other, finding.profile, canonical, changeSet{key: p.name, delete: true})
+			edit(finding.home, finding.profile, canonical, changeSet{key: p.name, newValue: p.value})
+			changes[other] = append(changes[other], changeSet{key: p.name, action: moveAction, oldValue: p.value, newValue: p.value,
+				profile: finding.profile, profiles: []string{finding.profile}, source: sourceLocation(*p),
+				message: fmt.Sprintf("%s belongs in the %s files of the %s profile", p.name, finding.home, finding.profile)})
+		}
+	}
+	return edits, changes
+}
+
+// inheritanceResults will apply the edits to the own files of each profile and find the file each is written to.
+// It also returns the config files and the edited properties of each file, keyed by path, as they would be once
+// the edits are written
+func (env *Pruner) inheritanceResults(edits map[contextProfile]map[string]changeSet, changes map[string][]changeSet) ([]prunedContext, map[int8][]model.JavaConfigFileMetadata, map[string]*propertySet, error) {
+	configFiles := make(map[int8][]model.JavaConfigFileMetadata)
+	for group, files := range env.ConfigFiles {
+		configFiles[group] = files
+	}
+	edited := make(map[string]*propertySet)
+	results := make([]prunedContext, 0)
+	for _, context := range fileNames {
+		profileProperties := make([]profilePropertyPruner, 0)
+		for target, edit := range edits {
+			if target.context != context {
+				continue
+			}
+			sources := env.ownSources(target.profile, context)
+			own, err := loadSources(sources)
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			profileProperties = append(profileProperties, profilePropertyPruner{profile: target.profile, properties: applyChanges(own, edit),
+				changes: edit, sources: sources})
+		}
+		if len(profileProperties) == 0 && len(changes[context]) == 0 {
+			continue
+		}
+		targets, err := env.inPlaceTargets(profileProperties, context)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		for _, properties := range profileProperties {
+			target := targets[properties.profile]
+			edited[target.path] = properties.properties
+			if target.source == nil {
+				// a new file is written to the root of the classpath
+				file, _ := configFileMetadata(filepath.Dir(target.path), filepath.Base(target.path))
+				configFiles[classpathFileKey] = append(append([]model.JavaConfigFileMetadata{}, configFiles[classpathFileKey]...), file)
+			}
+		}
+		results = append(results, prunedContext{context: context, profileProperties: sortedByProfile(profileProperties),
+			changes: changes[context], targets: targets})
+	}
+	return results, configFiles, edited, nil
+}
+
+// changedKeys will compare the view of the application context before and after the edits for every profile and
+// return each canonical key whose value changes, along with the first profile it changes in
+func (env *Pruner) changedKeys(scope []string, configFiles map[int8][]model.JavaConfigFileMetadata, edited map[string]*propertySet) (map[string]string, error) {
+	changed := make(map[string]string)
+	for _, profile := range scope {
+		before, err := env.inheritedView(env.ConfigFiles, profile, nil)
+		if err != nil {
+			return nil, err
+		}
+		after, err := env.inheritedView(configFiles, profile, edited)
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range append(before.keys(), after.keys()...) {
+			if _, seen := changed[key]; seen {
+				continue
+			}
+			b, inBefore := before.get(key)
+			a, inAfter := after.get(key)
+			if inBefore != inAfter || (inBefore && !valuesEqual(b.value, a.value)) {
+				changed[key] = profile
+			}
+		}
+	}
+	return changed, nil
+}
+
+// inheritedView will merge the bootstrap files of a profile under its application files, as the application
+// context sees them.  The properties of a file in edited are used in place of the file itself
+func (env *Pruner) inheritedView(configFiles map[int8][]model.JavaConfigFileMetadata, profile string, edited map[string]*propertySet) (*propertySet, error) {
+	properties := newPropertySet()
+	for _, context := range []string{bootstrapContext, applicationContext} {
+		for _, source := range orderSources(configFiles, []string{profile}, context, env.Config.Precedence) {
+			props, ok := edited[source.Path]
+			if !ok {
+				var err error
+				if props, err = loadFromFile(source); err != nil {
+					return nil, err
+				}
+			}
+			properties = properties.merge(props)
+		}
+	}
+	return properties, nil
+}
+
+// ownSources will return the files of a profile that can be changed: its own files, leaving out those packaged in
+// archives and those from a config server
+func (env *Pruner) ownSources(profile string, context string) []model.JavaConfigFileMetadata {
+	sources := make([]model.JavaConfigFileMetadata, 0)
+	for _, source := range env.profileSources(profile, context) {
+		if !env.isConfigServerFile(source) {
+			sources = append(sources, source)
+		}
+	}
+	return sources
+}
+
+// inheritsBootstrap reports whether the bootstrap files are layered under a context, which is only the case for the
+// application context when inherit_bootstrap is set
+func (appCtx *Pruner) inheritsBootstrap(context string) bool {
+	return appCtx.Config.InheritBootstrap && context == applicationContext
+}
@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newBootstrapPruner(t *testing.T) (*Pruner, func()) {
+	return newTestPruner(t, map[string]string{
+		"bootstrap.yml":        "spring:\n  application:\n    name: orders\n  cloud:\n    config:\n      uri: http://config\nserver:\n  port: 8080\nlogging:\n  level:\n    root: INFO\n",
+		"bootstrap-prod.yml":   "cache:\n  ttl: 5\n",
+		"application.yml":      "spring:\n  application:\n    name: orders\nlogging:\n  level:\n    root: INFO\ncache:\n  ttl: 10\n",
+		"application-dev.yml":  "spring:\n  cloud:\n    config:\n      fail-fast: true\nserver:\n  port: 9090\n",
+		"application-prod.yml": "server:\n  port: 80\n",
+	})
+}
+
+func TestInheritanceFindings(t *testing.T) {
+	appCtx, cleanup := newBootstrapPruner(t)
+	defer cleanup()
+	appCtx.Config.BootstrapKeys = []string{"custom.locator"}
+	assert.Equal(t, bootstrapContext, appCtx.keyContext("custom.locator.url", nil))
+	assert.Equal(t, applicationContext, appCtx.keyContext("server.port", nil))
+
+	findings, err := appCtx.inheritanceFindings([]string{"default", "dev", "prod"})
+	assert.Nil(t, err)
+	found := make(map[string]string)
+	for _, finding := range findings {
+		found[finding.profile+" "+finding.key()] = finding.kind + " " + finding.home
+	}
+	assert.Equal(t, map[string]string{
+		"default spring.application.name":   "redundant bootstrap",
+		"default logging.level.root":        "redundant application",
+		"default server.port":               "misplaced application",
+		"dev spring.cloud.config.fail-fast": "misplaced bootstrap",
+		"prod cache.ttl":                    "misplaced application",
+	}, found)
+
+	// the application context only sees the bootstrap keys when it inherits them
+	properties, _, err := appCtx.effectiveProfile("dev", "application")
+	assert.Nil(t, err)
+	_, inherited := properties.get("spring.cloud.config.uri")
+	assert.False(t, inherited)
+	appCtx.Config.InheritBootstrap = true
+	properties, _, err = appCtx.effectiveProfile("dev", "application")
+	assert.Nil(t, err)
+	uri, _ := properties.get("spring.cloud.config.uri")
+	assert.Equal(t, "http://config", uri.value)
+	port, _ := properties.get("server.port")
+	assert.Equal(t, 9090, port.value)
+}
+
+func TestBootstrapMove(t *testing.T) {
+	appCtx, cleanup := newBootstrapPruner(t)
+	defer cleanup()
+	appCtx.Config.BackupDirectory = filepath.Join(appCtx.Config.ProjectRoot, "backups")
+	assert.Nil(t, appCtx.Bootstrap([]string{"dev", "prod"}, true))
+
+	assertFileContent(t, appCtx, "bootstrap.yml", "spring:\n  application:\n    name: orders\n  cloud:\n    config:\n      uri: http://config\n")
+	assertFileContent(t, appCtx, "application.yml", "logging:\n  level:\n    root: INFO\ncache:\n  ttl: 10\nserver:\n  port: 8080\n")
+	assertFileContent(t, appCtx, "application-dev.yml", "server:\n  port: 9090\n")
+	assertFileContent(t, appCtx, "bootstrap-dev.yml", "spring:\n  cloud:\n    config:\n      fail-fast: true\n")
+	// moving cache.ttl into application-prod.yml would override the 10 the prod profile sees from application.yml
+	assertFileContent(t, appCtx, "bootstrap-prod.yml", "cache:\n  ttl: 5\n")
+	_, err := os.Stat(filepath.Join(appCtx.Config.OutputDirectory, changeReportName+".json"))
+	assert.Nil(t, err)
+}
@@ -0,0 +1,145 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	// JSONReportFormat writes the change report as pruned-changes.json
+	JSONReportFormat = "json"
+	// YAMLReportFormat writes the change report as pruned-changes.yml
+	YAMLReportFormat = "yaml"
+
+	changeReportName = "pruned-changes"
+)
+
+var reportFormats = []string{JSONReportFormat, YAMLReportFormat}
+
+// changeReport lists every change a prune made so that it can be reviewed by other tools
+type changeReport struct {
+	Generated string              `json:"generated" yaml:"generated"`
+	Changes   []changeReportEntry `json:"changes" yaml:"changes"`
+}
+
+// changeReportEntry is a single changeSet along with the context it was made in
+type changeReportEntry struct {
+	Context string `json:"context" yaml:"context"`
+	Key     string `json:"key" yaml:"key"`
+	// Action is one of hoist-to-default, delete, override, conflict, rename or move
+	Action string `json:"action" yaml:"action"`
+	// RenamedTo is the new name of a renamed key
+	RenamedTo string `json:"renamed_to,omitempty" yaml:"renamed_to,omitempty"`
+	// Profile is the profile whose file is changed; Profiles are every profile the change affects
+	Profile  string                 `json:"profile" yaml:"profile"`
+	Profiles []string               `json:"profiles" yaml:"profiles"`
+	OldValue interface{}            `json:"old_value,omitempty" yaml:"old_value,omitempty"`
+	NewValue interface{}            `json:"new_value,omitempty" yaml:"new_value,omitempty"`
+	Values   map[string]interface{} `json:"values,omitempty" yaml:"values,omitempty"`
+	Source   string                 `json:"source,omitempty" yaml:"source,omitempty"`
+	Message  string                 `json:"message" yaml:"message"`
+}
+
+// newChangeReport will collect the changes of every pruned context, ordered by context, key and profile.  Secret
+// values are masked unless showSecrets is set
+func newChangeReport(results []prunedContext, showSecrets bool, now time.Time) changeReport {
+	value := func(key string, value interface{}) interface{} {
+		if !showSecrets {
+			value = maskValue(key, value)
+		}
+		return reportValue(value)
+	}
+	report := changeReport{Generated: now.Format(time.RFC3339), Changes: make([]changeReportEntry, 0)}
+	for _, result := range results {
+		for _, change := range result.changes {
+			entry := changeReportEntry{
+				Context:   result.context,
+				Key:       change.key,
+				Action:    change.action,
+				RenamedTo: change.renamedTo,
+				Profile:   change.profile,
+				Profiles:  make([]string, len(change.profiles)),
+				OldValue:  value(change.key, change.oldValue),
+				NewValue:  value(change.key, change.newValue),
+				Source:    change.source,
+				Message:   change.message,
+			}
+			copy(entry.Profiles, change.profiles)
+			sort.Strings(entry.Profiles)
+			if len(change.values) > 0 {
+				entry.Values = make(map[string]interface{})
+				for profile, profileValue := range change.values {
+					entry.Values[profile] = value(change.key, profileValue)
+				}
+			}
+			report.Changes = append(report.Changes, entry)
+		}
+	}
+	sort.SliceStable(report.Changes, func(i, j int) bool {
+		left, right := report.Changes[i], report.Changes[j]
+		if left.Context != right.Context {
+			return left.Context < right.Context
+		}
+		if left.Key != right.Key {
+			return left.Key < right.Key
+		}
+		// the default profile change leads the deletes it causes
+		if left.Profile == defaultProfileKey || right.Profile == defaultProfileKey {
+			return left.Profile == defaultProfileKey && right.Profile != defaultProfileKey
+		}
+		return left.Profile < right.Profile
+	})
+	return report
+}
+
+// reportValue will convert nested yaml values into plain maps so that they encode as objects in json
+func reportValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case yaml.MapSlice:
+		converted := make(map[string]interface{}, len(v))
+		for _, item := range v {
+			converted[fmt.Sprint(item.Key)] = reportValue(item.Value)
+		}
+		return converted
+	case []interface{}:
+		converted := make([]interface{}, len(v))
+		for i, element := range v {
+			converted[i] = reportValue(element)
+		}
+		return converted
+	}
+	return value
+}
+
+// outputChangeReport will write the change report in the requested format, json when none is given
+func outputChangeReport(results []prunedContext, outputDirectory string, format string, showSecrets bool, now time.Time) error {
+	if err := ensureOutputDirectory(outputDirectory); err != nil {
+		return err
+	}
+	report := newChangeReport(results, showSecrets, now)
+	var (
+		content []byte
+		err     error
+	)
+	fileName := filepath.Join(outputDirectory, changeReportName+".json")
+	if format == YAMLReportFormat {
+		fileName = filepath.Join(outputDirectory, changeReportName+".yml")
+		content, err = yaml.Marshal(report)
+	} else {
+		content, err = json.MarshalIndent(report, "", "  ")
+		content = append(content, '\n')
+	}
+	if err != nil {
+		return fmt.Errorf("unable to format the change report: %v", err)
+	}
+	if err := ioutil.WriteFile(fileName, content, 0644); err != nil {
+		return fmt.Errorf("unable to write %s: %v", fileName, err)
+	}
+	return nil
+}
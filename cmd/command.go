@@ -9,13 +9,17 @@ import (
 // Pruner is the application context; this seems to be used somewhat eradically
 type Pruner struct {
 	Config *config.Application
-	// config files are either classpath or default
+	// config files are classpath, external or from a config server directory
 	ConfigFiles map[int8][]model.JavaConfigFileMetadata
+	// Service is the name of the project in a multi-service config; it is empty for a single project
+	Service string
 }
 
 const (
 	classpathFileKey = 0
 	externalFileKey  = 1
+	// configServerFileKey holds the files of a config server repository, which override the project's own files
+	configServerFileKey = 2
 )
 
 func promptString(name string) (string, error) {
@@ -25,3 +29,11 @@ func promptString(name string) (string, error) {
 	}
 	return prompt.Run()
 }
+
+// promptOptionalString will prompt for a value that may be left blank
+func promptOptionalString(name string) (string, error) {
+	prompt := promptui.Prompt{
+		Label: name,
+	}
+	return prompt.Run()
+}
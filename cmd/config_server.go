@@ -0,0 +1,202 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/gkontos/bivalve-chronicles"
+
+	"github.com/gkontos/spiny-dogfish/model"
+)
+
+const (
+	applicationNameKey = "spring.application.name"
+	// sharedConfigName is the file name a config server shares between every application
+	sharedConfigName = "application"
+	// configServerContext is the application context that config server properties are read into
+	configServerContext = "application"
+	configServerTimeout = 10 * time.Second
+)
+
+// configServerEnvironment is the body of a config server's /{application}/{profile} response.  Property sources
+// are listed from highest to lowest precedence and hold flattened keys such as servers[0].host
+type configServerEnvironment struct {
+	Name            string                 `json:"name"`
+	Profiles        []string               `json:"profiles"`
+	Label           string                 `json:"label"`
+	PropertySources []configPropertySource `json:"propertySources"`
+}
+
+type configPropertySource struct {
+	Name   string                 `json:"name"`
+	Source map[string]interface{} `json:"source"`
+}
+
+// loadConfigServerFiles will scan the config server directory for the shared application files and the files of
+// this application
+func (appCtx *Pruner) loadConfigServerFiles() {
+	directory := appCtx.Config.ConfigServer.Directory
+	if directory == "" {
+		appCtx.ConfigFiles[configServerFileKey] = make([]model.JavaConfigFileMetadata, 0)
+		return
+	}
+	application := appCtx.configServerApplication()
+	if application == "" {
+		log.Infof("No config server application name or %s set; only the shared %s files are read", applicationNameKey, sharedConfigName)
+	}
+	log.Infof("Scanning config server directory %s for application %q", directory, application)
+	summary := scanWith(directory, appCtx.Config.Scan, func(dir string, relativeDir string, fileName string) (model.JavaConfigFileMetadata, string) {
+		return configServerFileMetadata(dir, relativeDir, fileName, application)
+	})
+	summary.logSummary()
+	appCtx.ConfigFiles[configServerFileKey] = expandDocuments(summary.discovered)
+}
+
+// configServerApplication is the {application} name of the service: the configured name, or spring.application.name
+// from the project's own bootstrap files and then its application files
+func (appCtx *Pruner) configServerApplication() string {
+	if appCtx.Config.ConfigServer.Application != "" {
+		return appCtx.Config.ConfigServer.Application
+	}
+	projectFiles := map[int8][]model.JavaConfigFileMetadata{
+		classpathFileKey: appCtx.ConfigFiles[classpathFileKey],
+		externalFileKey:  appCtx.ConfigFiles[externalFileKey],
+	}
+	for _, context := range fileNames {
+		properties, err := loadSources(orderSources(projectFiles, []string{defaultProfileKey}, context, appCtx.Config.Precedence))
+		if err != nil {
+			log.Errorf("Unable to read %s from the %s files: %v", applicationNameKey, context, err)
+			continue
+		}
+		if p, ok := properties.get(applicationNameKey); ok && p.value != nil {
+			return fmt.Sprint(p.value)
+		}
+	}
+	return ""
+}
+
+// configServerFileMetadata will describe a file of a config server repository, or return the reason it is not
+// read for the application.  Files are read from the root of the repository and from a subdirectory named after
+// the application, as the config server's {application} search path does.  Every file belongs to the application
+// context
+func configServerFileMetadata(dir string, relativeDir string, fileName string, application string) (model.JavaConfigFileMetadata, string) {
+	configFile := model.JavaConfigFileMetadata{}
+	if relativeDir != "" && (application == "" || relativeDir != application) {
+		return configFile, "outside of the config server search paths"
+	}
+	extension := strings.TrimPrefix(filepath.Ext(fileName), ".")
+	if _, found := Find(fileTypes, extension); !found {
+		return configFile, "unsupported file type"
+	}
+	baseName := strings.TrimSuffix(fileName, "."+extension)
+	// application names often contain dashes, so the name is matched as a whole rather than split at the first dash
+	name := ""
+	for _, candidate := range []string{application, sharedConfigName} {
+		if candidate != "" && (baseName == candidate || strings.HasPrefix(baseName, candidate+"-")) {
+			name = candidate
+			break
+		}
+	}
+	if name == "" {
+		return configFile, fmt.Sprintf("not an %s or %s file", sharedConfigName, application)
+	}
+	configFile.ConfigurationType = extension
+	configFile.Path = dir + "/" + fileName
+	configFile.Profile = defaultProfileKey
+	if profile := strings.TrimPrefix(baseName, name+"-"); profile != baseName && profile != "" {
+		configFile.Profile = profile
+	}
+	configFile.ApplicationContext = configServerContext
+	if name != sharedConfigName {
+		configFile.Application = name
+	}
+	return configFile, ""
+}
+
+// configServerLayers will request the profiles from the config server url and return its property sources from
+// lowest to highest precedence.  Only the application context reads from a config server
+func (appCtx *Pruner) configServerLayers(profiles []string, context string) ([]*propertySet, error) {
+	server := appCtx.Config.ConfigServer
+	if server.URL == "" || context != configServerContext {
+		return nil, nil
+	}
+	application := appCtx.configServerApplication()
+	if application == "" {
+		return nil, fmt.Errorf("the config server application is not set and no %s was found", applicationNameKey)
+	}
+	environment, err := fetchConfigServerEnvironment(configServerURL(server.URL, application, profiles, server.Label))
+	if err != nil {
+		return nil, err
+	}
+	layers := make([]*propertySet, 0, len(environment.PropertySources))
+	for i := len(environment.PropertySources) - 1; i >= 0; i-- {
+		layers = append(layers, configServerLayer(environment.PropertySources[i]))
+	}
+	return layers, nil
+}
+
+// configServerURL will build the /{application}/{profile}[/{label}] path of a request.  A / within the label is
+// written as (_), which the config server reads back as a /
+func configServerURL(base string, application string, profiles []string, label string) string {
+	address := strings.TrimSuffix(base, "/") + "/" + url.PathEscape(application) + "/" + url.PathEscape(strings.Join(profiles, ","))
+	if label != "" {
+		address += "/" + url.PathEscape(strings.ReplaceAll(label, "/", "(_)"))
+	}
+	return address
+}
+
+func fetchConfigServerEnvironment(address string) (*configServerEnvironment, error) {
+	client := &http.Client{Timeout: configServerTimeout}
+	request, err := http.NewRequest(http.MethodGet, address, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid config server url %s: %v", address, err)
+	}
+	request.Header.Set("Accept", "application/json")
+	log.Debugf("requesting %s", address)
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("unable to reach the config server: %v", err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("config server returned %s for %s", response.Status, address)
+	}
+	environment := &configServerEnvironment{}
+	decoder := json.NewDecoder(response.Body)
+	decoder.UseNumber()
+	if err := decoder.Decode(environment); err != nil {
+		return nil, fmt.Errorf("unable to read the config server response from %s: %v", address, err)
+	}
+	return environment, nil
+}
+
+// configServerLayer will read a single property source.  Numbers are kept as whole numbers where they can be so they
+// compare equal to the values read from yaml
+func configServerLayer(source configPropertySource) *propertySet {
+	layer := newPropertySet()
+	origin := source.Name + " (config server)"
+	// the order of the keys is lost in decoding; sorting keeps runs repeatable
+	names := make([]string, 0, len(source.Source))
+	for name := range source.Source {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		value := source.Source[name]
+		if number, isNumber := value.(json.Number); isNumber {
+			if whole, err := number.Int64(); err == nil {
+				value = int(whole)
+			} else if decimal, err := number.Float64(); err == nil {
+				value = decimal
+			}
+		}
+		layer.set(property{name: name, value: value, source: origin})
+	}
+	return layer
+}
@@ -0,0 +1,111 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfigServerFileMetadata(t *testing.T) {
+	file, reason := configServerFileMetadata("/repo", "", "order-service-dev.yml", "order-service")
+	assert.Equal(t, "", reason)
+	assert.Equal(t, "dev", file.Profile)
+	assert.Equal(t, "order-service", file.Application)
+	assert.Equal(t, "application", file.ApplicationContext)
+
+	file, reason = configServerFileMetadata("/repo", "order-service", "application-my-profile.properties", "order-service")
+	assert.Equal(t, "", reason)
+	assert.Equal(t, "my-profile", file.Profile)
+	assert.Equal(t, "", file.Application)
+
+	_, reason = configServerFileMetadata("/repo", "", "billing-service.yml", "order-service")
+	assert.Equal(t, "not an application or order-service file", reason)
+	_, reason = configServerFileMetadata("/repo", "billing-service", "application.yml", "order-service")
+	assert.Equal(t, "outside of the config server search paths", reason)
+}
+
+func TestConfigServerDirectoryOrder(t *testing.T) {
+	appCtx, cleanup := newTestPruner(t, map[string]string{
+		"bootstrap.yml":   "spring:\n  application:\n    name: order-service\n",
+		"application.yml": "a: local\nlocal: true\n",
+	})
+	defer cleanup()
+	repo := filepath.Join(appCtx.Config.ProjectRoot, "config-repo")
+	for name, content := range map[string]string{
+		"application.yml":                     "a: shared\nb: shared\nc: shared\nd: shared\n",
+		"order-service.yml":                   "b: app\nc: app\nd: app\n",
+		"application-dev.yml":                 "c: shared-dev\nd: shared-dev\n",
+		"order-service/order-service-dev.yml": "d: app-dev\n",
+		"billing-service.yml":                 "a: billing\n",
+	} {
+		assert.Nil(t, os.MkdirAll(filepath.Dir(filepath.Join(repo, name)), 0755))
+		assert.Nil(t, ioutil.WriteFile(filepath.Join(repo, name), []byte(content), 0644))
+	}
+	appCtx.Config.ConfigServer.Directory = repo
+	appCtx.LoadConfigFileMetadata()
+	assert.Len(t, appCtx.ConfigFiles[configServerFileKey], 4)
+
+	properties, _, err := appCtx.effectiveProfile("dev", "application")
+	assert.Nil(t, err)
+	for key, expected := range map[string]interface{}{"a": "shared", "b": "app", "c": "shared-dev", "d": "app-dev", "local": true} {
+		p, _ := properties.get(key)
+		assert.Equal(t, expected, p.value, key)
+	}
+}
+
+func TestConfigServerURL(t *testing.T) {
+	requested := ""
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = r.URL.Path
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"name":"order-service","profiles":["dev"],"label":"main","propertySources":[
+			{"name":"file:/repo/order-service-dev.yml","source":{"server.port":8081,"servers[0].host":"a","ratio":0.5}},
+			{"name":"file:/repo/application.yml","source":{"server.port":8080,"shared":"yes"}}]}`))
+	}))
+	defer server.Close()
+
+	appCtx, cleanup := newTestPruner(t, map[string]string{
+		"application.yml":     "spring:\n  application:\n    name: order-service\nserver:\n  port: 80\nlocal: true\n",
+		"application-dev.yml": "local: false\n",
+	})
+	defer cleanup()
+	appCtx.Config.ConfigServer.URL = server.URL
+	appCtx.Config.ConfigServer.Label = "release/1.0"
+
+	properties, _, err := appCtx.effectiveProfile("dev", "application")
+	assert.Nil(t, err)
+	assert.Equal(t, "/order-service/dev/release(_)1.0", requested)
+	for key, expected := range map[string]interface{}{"server.port": 8081, "shared": "yes", "ratio": 0.5, "local": false} {
+		p, _ := properties.get(key)
+		assert.Equal(t, expected, p.value, key)
+	}
+	servers, _ := properties.get("servers")
+	assert.Len(t, servers.value, 1)
+
+	origins, _, err := appCtx.explainProfileAndContext("dev", "application")
+	assert.Nil(t, err)
+	assert.Len(t, origins["server.port"].chain, 3)
+	assert.Equal(t, "file:/repo/order-service-dev.yml (config server)", origins["server.port"].winner().source)
+
+	// only the application context reads from the config server
+	_, _, err = appCtx.effectiveProfile("dev", "bootstrap")
+	assert.Nil(t, err)
+	assert.Equal(t, "/order-service/dev/release(_)1.0", requested)
+
+	server.Config.Handler = http.NotFoundHandler()
+	_, _, err = appCtx.effectiveProfile("dev", "application")
+	assert.Contains(t, err.Error(), "config server returned 404 Not Found")
+}
+
+func TestConfigServerApplicationRequired(t *testing.T) {
+	appCtx, cleanup := newTestPruner(t, map[string]string{"application.yml": "a: b\n"})
+	defer cleanup()
+	appCtx.Config.ConfigServer.URL = "http://localhost:1"
+	_, err := appCtx.configServerLayers([]string{"dev"}, "application")
+	assert.EqualError(t, err, "the config server application is not set and no spring.application.name was found")
+}
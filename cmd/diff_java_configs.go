@@ -0,0 +1,360 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	log "github.com/gkontos/bivalve-chronicles"
+)
+
+const (
+	patchFileName = "pruned.patch"
+	diffContext   = 3
+
+	ansiReset = "\x1b[0m"
+	ansiBold  = "\x1b[1m"
+	ansiRed   = "\x1b[31m"
+	ansiGreen = "\x1b[32m"
+	ansiCyan  = "\x1b[36m"
+)
+
+// fileDiff is the change an in place prune would make to a single file
+type fileDiff struct {
+	// path is relative to the root of the patch so that the patch applies from there
+	path string
+	// from is the original file a new file is copied from, as each file in the output directory is from the file of
+	// its profile; it is empty when the file is changed in place or created from nothing
+	from     string
+	original []byte
+	updated  []byte
+	existed  bool
+	deleted  bool
+}
+
+// diffLine is a single line of an edit script; kind is ' ', '-' or '+'
+type diffLine struct {
+	kind byte
+	text string
+}
+
+// previewChanges will log a diff of every file an in place prune would change and write the same diff as a patch
+func (env *Pruner) previewChanges(results []prunedContext) error {
+	diffs := make([]fileDiff, 0)
+	for _, result := range results {
+		for _, properties := range sortedByProfile(result.profileProperties) {
+			target := result.targets[properties.profile]
+			diff, err := env.plannedDiff(properties, target)
+			if err != nil {
+				return err
+			}
+			unchanged := diff.existed && !diff.deleted && string(diff.original) == string(diff.updated)
+			if unchanged || (!diff.existed && diff.deleted) {
+				continue
+			}
+			diffs = append(diffs, diff)
+		}
+	}
+	return env.writePreview(diffs)
+}
+
+// previewOutput will log a diff between the original file of each profile and the file a prune would write to the
+// output directory for it, and write the same diff as a patch.  A file rendered from more than one original, or a
+// profile without a file, is shown as a new file
+func (env *Pruner) previewOutput(results []prunedContext) error {
+	diffs := make([]fileDiff, 0)
+	for _, result := range results {
+		files, err := renderOutput(result.profileProperties, result.context, env.Config.OutputLayout, env.Config.OutputFormat)
+		if err != nil {
+			return err
+		}
+		for _, file := range files {
+			diff := fileDiff{path: filepath.Join(env.Config.OutputDirectory, file.name), updated: file.content}
+			if file.source != nil {
+				original, err := ioutil.ReadFile(file.source.Path)
+				if err != nil {
+					return fmt.Errorf("unable to read %s: %v", file.source.Path, err)
+				}
+				diff.from, diff.original, diff.existed = file.source.Path, original, true
+			}
+			diffs = append(diffs, diff)
+		}
+	}
+	return env.writePreview(diffs)
+}
+
+// writePreview will log the diffs, colorized on a terminal and with secrets masked, and write them to the patch file
+func (env *Pruner) writePreview(diffs []fileDiff) error {
+	if len(diffs) == 0 {
+		log.Info("Dry run: no files would change")
+		return nil
+	}
+
+	root := patchRoot(env.Config.ProjectRoot, diffs)
+	patch := formatPatch(diffs)
+	shown := patch
+	if !env.Config.ShowSecrets {
+		shown = maskPatch(patch)
+	}
+	if isTerminal(os.Stdout) {
+		log.Infof("%s", colorizePatch(shown))
+	} else {
+		log.Infof("%s", shown)
+	}
+	if err := ensureOutputDirectory(env.Config.OutputDirectory); err != nil {
+		return err
+	}
+	patchFile := filepath.Join(env.Config.OutputDirectory, patchFileName)
+	if err := ioutil.WriteFile(patchFile, []byte(patch), 0644); err != nil {
+		return fmt.Errorf("unable to write %s: %v", patchFile, err)
+	}
+	log.Infof("Dry run: %d files would change, patch written to %s to apply from %s", len(diffs), patchFile, root)
+	return nil
+}
+
+// plannedDiff will compare the current content of a target with what an in place prune would write to it
+func (env *Pruner) plannedDiff(properties profilePropertyPruner, target inPlaceTarget) (fileDiff, error) {
+	diff := fileDiff{path: target.path}
+	original, err := ioutil.ReadFile(target.path)
+	if err == nil {
+		diff.original = original
+		diff.existed = true
+	} else if !os.IsNotExist(err) {
+		return diff, fmt.Errorf("unable to read %s: %v", target.path, err)
+	}
+	updated, err := plannedContent(properties, target)
+	if err != nil {
+		return diff, err
+	}
+	diff.updated = updated
+	diff.deleted = updated == nil
+	return diff, nil
+}
+
+// patchRoot will find the directory the patch applies from: the project root when every file is below it, otherwise
+// the closest directory above it that holds every file, such as the config server directory next to a service.  The
+// path of each diff is made relative to it
+func patchRoot(projectRoot string, diffs []fileDiff) string {
+	root, err := filepath.Abs(projectRoot)
+	if err != nil {
+		root = projectRoot
+	}
+	for _, diff := range diffs {
+		for _, name := range []string{diff.path, diff.from} {
+			path, err := filepath.Abs(name)
+			if name == "" || err != nil {
+				continue
+			}
+			for !isInside(root, path) && filepath.Dir(root) != root {
+				root = filepath.Dir(root)
+			}
+		}
+	}
+	relative := func(name string) string {
+		if path, err := filepath.Abs(name); name != "" && err == nil {
+			if relative, err := filepath.Rel(root, path); err == nil {
+				return filepath.ToSlash(relative)
+			}
+		}
+		return name
+	}
+	for i := range diffs {
+		diffs[i].path, diffs[i].from = relative(diffs[i].path), relative(diffs[i].from)
+	}
+	return root
+}
+
+// isInside reports whether path is inside the directory
+func isInside(directory string, path string) bool {
+	relative, err := filepath.Rel(directory, path)
+	return err == nil && relative != ".." && !strings.HasPrefix(relative, ".."+string(filepath.Separator))
+}
+
+// formatPatch will write the diffs in the git patch format, which git apply accepts
+func formatPatch(diffs []fileDiff) string {
+	var patch strings.Builder
+	for _, diff := range diffs {
+		if diff.from != "" {
+			patch.WriteString(fmt.Sprintf("diff --git a/%s b/%s\n", diff.from, diff.path))
+			if string(diff.original) == string(diff.updated) {
+				patch.WriteString(fmt.Sprintf("similarity index 100%%\ncopy from %s\ncopy to %s\n", diff.from, diff.path))
+				continue
+			}
+			patch.WriteString(fmt.Sprintf("copy from %s\ncopy to %s\n", diff.from, diff.path))
+			patch.WriteString(fmt.Sprintf("--- a/%s\n+++ b/%s\n", diff.from, diff.path))
+			patch.WriteString(unifiedDiff(splitLines(diff.original), splitLines(diff.updated), diffContext))
+			continue
+		}
+		patch.WriteString(fmt.Sprintf("diff --git a/%s b/%s\n", diff.path, diff.path))
+		oldName, newName := "a/"+diff.path, "b/"+diff.path
+		switch {
+		case !diff.existed:
+			patch.WriteString("new file mode 100644\n")
+			oldName = "/dev/null"
+		case diff.deleted:
+			patch.WriteString("deleted file mode 100644\n")
+			newName = "/dev/null"
+		}
+		patch.WriteString(fmt.Sprintf("--- %s\n+++ %s\n", oldName, newName))
+		patch.WriteString(unifiedDiff(splitLines(diff.original), splitLines(diff.updated), diffContext))
+	}
+	return patch.String()
+}
+
+// splitLines will split content into lines that keep their line ending, so a missing final newline is a difference
+func splitLines(content []byte) []string {
+	lines := make([]string, 0)
+	text := string(content)
+	for text != "" {
+		end := strings.Index(text, "\n")
+		if end < 0 {
+			lines = append(lines, text)
+			break
+		}
+		lines = append(lines, text[:end+1])
+		text = text[end+1:]
+	}
+	return lines
+}
+
+// editScript will find the shortest set of deletions and insertions that turn a into b using the longest common
+// subsequence of their lines
+func editScript(a []string, b []string) []diffLine {
+	common := make([][]int, len(a)+1)
+	for i := range common {
+		common[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				common[i][j] = common[i+1][j+1] + 1
+			} else if common[i+1][j] >= common[i][j+1] {
+				common[i][j] = common[i+1][j]
+			} else {
+				common[i][j] = common[i][j+1]
+			}
+		}
+	}
+	script := make([]diffLine, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			script = append(script, diffLine{kind: ' ', text: a[i]})
+			i++
+			j++
+		case j == len(b) || (i < len(a) && common[i+1][j] >= common[i][j+1]):
+			script = append(script, diffLine{kind: '-', text: a[i]})
+			i++
+		default:
+			script = append(script, diffLine{kind: '+', text: b[j]})
+			j++
+		}
+	}
+	return script
+}
+
+// unifiedDiff will format the hunks that turn a into b, each with up to context unchanged lines around the changes
+func unifiedDiff(a []string, b []string, context int) string {
+	script := editScript(a, b)
+	var out strings.Builder
+	for start := 0; start < len(script); {
+		// find the next change and the end of the hunk it starts; changes closer than two contexts share a hunk
+		first := start
+		for first < len(script) && script[first].kind == ' ' {
+			first++
+		}
+		if first == len(script) {
+			break
+		}
+		last := first
+		for next := first; next < len(script); next++ {
+			if script[next].kind != ' ' {
+				if next-last > 2*context {
+					break
+				}
+				last = next
+			}
+		}
+		from := first - context
+		if from < start {
+			from = start
+		}
+		to := last + context + 1
+		if to > len(script) {
+			to = len(script)
+		}
+
+		oldStart, newStart := 1, 1
+		for _, line := range script[:from] {
+			if line.kind != '+' {
+				oldStart++
+			}
+			if line.kind != '-' {
+				newStart++
+			}
+		}
+		oldCount, newCount := 0, 0
+		for _, line := range script[from:to] {
+			if line.kind != '+' {
+				oldCount++
+			}
+			if line.kind != '-' {
+				newCount++
+			}
+		}
+		// an empty range is numbered by the line before it
+		if oldCount == 0 {
+			oldStart--
+		}
+		if newCount == 0 {
+			newStart--
+		}
+		out.WriteString(fmt.Sprintf("@@ -%d,%d +%d,%d @@\n", oldStart, oldCount, newStart, newCount))
+		for _, line := range script[from:to] {
+			out.WriteByte(line.kind)
+			out.WriteString(line.text)
+			if !strings.HasSuffix(line.text, "\n") {
+				out.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+		start = to
+	}
+	return out.String()
+}
+
+// colorizePatch will highlight a patch for the terminal the way git diff does
+func colorizePatch(patch string) string {
+	lines := strings.SplitAfter(patch, "\n")
+	for i, line := range lines {
+		text := strings.TrimSuffix(line, "\n")
+		if text == "" {
+			continue
+		}
+		color := ""
+		switch {
+		case strings.HasPrefix(text, "diff --git"), strings.HasPrefix(text, "--- "), strings.HasPrefix(text, "+++ "),
+			strings.HasPrefix(text, "new file mode"), strings.HasPrefix(text, "deleted file mode"),
+			strings.HasPrefix(text, "copy from"), strings.HasPrefix(text, "copy to"), strings.HasPrefix(text, "similarity index"):
+			color = ansiBold
+		case strings.HasPrefix(text, "@@"):
+			color = ansiCyan
+		case strings.HasPrefix(text, "-"):
+			color = ansiRed
+		case strings.HasPrefix(text, "+"):
+			color = ansiGreen
+		}
+		if color != "" {
+			lines[i] = color + text + ansiReset + strings.TrimPrefix(line, text)
+		}
+	}
+	return strings.Join(lines, "")
+}
+
+// isTerminal will report whether the file is an interactive terminal rather than a pipe or a file
+func isTerminal(file *os.File) bool {
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gkontos/spiny-dogfish/model"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v2"
+)
+
+func TestParseMultiDocumentYaml(t *testing.T) {
+	content := "server:\n  port: 8080\n" +
+		"---\n" +
+		"spring:\n  config:\n    activate:\n      on-profile: dev\nserver:\n  port: 8081\n" +
+		"---\n" +
+		"spring:\n  profiles: qa, prod\nserver:\n  port: 80\n"
+	documents, err := parseYamlDocuments([]byte(content), "application.yml")
+	assert.Nil(t, err)
+	assert.EqualValues(t, 3, len(documents))
+
+	profiles, err := activationProfiles(documents[0])
+	assert.Nil(t, err)
+	assert.EqualValues(t, 0, len(profiles))
+
+	profiles, err = activationProfiles(documents[1])
+	assert.Nil(t, err)
+	assert.EqualValues(t, []string{"dev"}, profiles)
+	assert.EqualValues(t, []string{"server.port"}, documents[1].keys())
+	port, _ := documents[1].get("server.port")
+	assert.EqualValues(t, 9, port.line)
+
+	profiles, err = activationProfiles(documents[2])
+	assert.Nil(t, err)
+	assert.EqualValues(t, []string{"qa", "prod"}, profiles)
+}
+
+func TestParseMultiDocumentProperties(t *testing.T) {
+	content := "server.port=8080\n#---\nspring.config.activate.on-profile=dev\nserver.port=8081\n!---\nspring.config.activate.on-profile=!prod\n"
+	documents, err := parsePropertiesDocuments([]byte(content), "application.properties")
+	assert.Nil(t, err)
+	assert.EqualValues(t, 3, len(documents))
+	profiles, err := activationProfiles(documents[1])
+	assert.Nil(t, err)
+	assert.EqualValues(t, []string{"dev"}, profiles)
+	_, err = activationProfiles(documents[2])
+	assert.NotNil(t, err)
+}
+
+func TestExpandDocuments(t *testing.T) {
+	root, err := ioutil.TempDir("", "documents")
+	assert.Nil(t, err)
+	defer os.RemoveAll(root)
+	path := filepath.Join(root, "application.yml")
+	content := "a: 1\n---\nspring.config.activate.on-profile: dev\na: 2\n---\nspring.profiles: [qa, prod]\na: 3\n"
+	assert.Nil(t, ioutil.WriteFile(path, []byte(content), 0644))
+
+	file := model.JavaConfigFileMetadata{ConfigurationType: "yml", Path: path, Profile: defaultProfileKey, ApplicationContext: "application"}
+	expanded := expandDocuments([]model.JavaConfigFileMetadata{file})
+	assert.EqualValues(t, 4, len(expanded))
+	expected := []struct {
+		profile  string
+		document int
+		value    int
+	}{{defaultProfileKey, 0, 1}, {"dev", 1, 2}, {"qa", 2, 3}, {"prod", 2, 3}}
+	for i, e := range expected {
+		assert.EqualValues(t, e.profile, expanded[i].Profile)
+		assert.EqualValues(t, e.document, expanded[i].Document)
+		properties, err := loadFromFile(expanded[i])
+		assert.Nil(t, err)
+		assert.EqualValues(t, []string{"a"}, properties.keys())
+		a, _ := properties.get("a")
+		assert.EqualValues(t, e.value, a.value)
+	}
+}
+
+func TestWithActivationProfile(t *testing.T) {
+	properties := newPropertySet()
+	properties.set(property{name: "spring.datasource.url", value: "jdbc:h2:mem"})
+	out, err := yaml.Marshal(withActivationProfile(properties, "dev").nested())
+	assert.Nil(t, err)
+	assert.EqualValues(t, "spring:\n  config:\n    activate:\n      on-profile: dev\n  datasource:\n    url: jdbc:h2:mem\n", string(out))
+	assert.True(t, withActivationProfile(properties, defaultProfileKey) == properties)
+}
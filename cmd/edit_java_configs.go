@@ -0,0 +1,412 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+	yamlv3 "gopkg.in/yaml.v3"
+
+	"github.com/gkontos/spiny-dogfish/model"
+)
+
+// errNotEditable is returned when a file can not be edited line by line, such as a flow style yaml mapping or a
+// multi-document file.  Callers fall back to writing the pruned properties without the original layout
+var errNotEditable = errors.New("the file layout can not be edited in place")
+
+// lineEdit replaces the physical lines from start to end (1 based and inclusive) with lines.  An insertion before
+// line start has end set to start-1
+type lineEdit struct {
+	start int
+	end   int
+	lines []string
+}
+
+// yamlPair is a key and its value within a yaml mapping
+type yamlPair struct {
+	mapping *yamlv3.Node
+	key     *yamlv3.Node
+	value   *yamlv3.Node
+	// name is the full property name of the key, spelled as it is in the file
+	name string
+}
+
+// editConfigFile will apply a profile's changes to the text of its original file so that comments, blank lines
+// and the order of the remaining keys are kept
+func editConfigFile(source model.JavaConfigFileMetadata, changes map[string]changeSet) ([]byte, error) {
+	if source.Document != 0 {
+		return nil, errNotEditable
+	}
+	original, err := ioutil.ReadFile(source.Path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read %s: %v", source.Path, err)
+	}
+	if source.ConfigurationType == "properties" {
+		return editPropertiesConfig(original, sortedChanges(changes))
+	}
+	return editYamlConfig(original, sortedChanges(changes))
+}
+
+// sortedChanges will order a profile's changes by key so that edits are made in the same order on every run
+func sortedChanges(changes map[string]changeSet) []changeSet {
+	keys := make([]string, 0, len(changes))
+	for key := range changes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	sorted := make([]changeSet, 0, len(keys))
+	for _, key := range keys {
+		sorted = append(sorted, changes[key])
+	}
+	return sorted
+}
+
+// isEmptyConfig will report whether content holds no properties, only comments or blank lines
+func isEmptyConfig(content []byte, configType string) (bool, error) {
+	var documents []*propertySet
+	var err error
+	if configType == "properties" {
+		documents, err = parsePropertiesDocuments(content, "")
+	} else {
+		documents, err = parseYamlDocuments(content, "")
+	}
+	if err != nil {
+		return false, err
+	}
+	for _, document := range documents {
+		if document.len() > 0 {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// editYamlConfig will remove the deleted keys from a single document yaml file, replace the values of updated keys
+// and add new keys below the deepest mapping that already exists for them
+func editYamlConfig(original []byte, changes []changeSet) ([]byte, error) {
+	changes = splitRenames(changes)
+	decoder := yamlv3.NewDecoder(bytes.NewReader(original))
+	var document yamlv3.Node
+	documents := 0
+	for {
+		var next yamlv3.Node
+		if err := decoder.Decode(&next); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, err
+		}
+		document = next
+		documents++
+	}
+	if documents > 1 {
+		return nil, errNotEditable
+	}
+	var root *yamlv3.Node
+	if documents == 1 && len(document.Content) > 0 && document.Content[0].Kind == yamlv3.MappingNode {
+		root = document.Content[0]
+		if root.Style&yamlv3.FlowStyle != 0 {
+			return nil, errNotEditable
+		}
+	} else if documents == 1 && len(document.Content) > 0 && document.Content[0].Kind != yamlv3.ScalarNode {
+		return nil, errNotEditable
+	}
+
+	lines := strings.Split(strings.ReplaceAll(string(original), "\r\n", "\n"), "\n")
+	deleted := make(map[*yamlv3.Node]bool)
+	additions := make(map[*yamlv3.Node]yaml.MapSlice)
+	var rootAdditions yaml.MapSlice
+	edits := make([]lineEdit, 0)
+
+	for _, change := range changes {
+		if !change.delete && change.newValue == nil {
+			continue
+		}
+		pair, parent, consumed, err := findYamlPair(root, canonicalName(change.key))
+		if err != nil {
+			return nil, err
+		}
+		if change.delete {
+			if pair != nil {
+				deleted[pair.key] = true
+			}
+			continue
+		}
+		if pair != nil {
+			edits = append(edits, lineEdit{
+				start: pair.key.Line,
+				end:   yamlBlockEnd(lines, *pair),
+				lines: renderYaml(yaml.MapSlice{{Key: pair.key.Value, Value: change.newValue}}, pair.key.Column-1, pair.value.LineComment),
+			})
+			continue
+		}
+		remaining := strings.Split(change.key, ".")[consumed:]
+		if parent == nil {
+			rootAdditions = insertNested(rootAdditions, remaining, change.newValue)
+		} else {
+			additions[parent.value] = insertNested(additions[parent.value], remaining, change.newValue)
+		}
+	}
+
+	if root != nil {
+		markEmptyMappings(root, deleted, additions)
+		edits = append(edits, yamlDeleteEdits(lines, root, "", deleted)...)
+		for _, pair := range yamlPairs(root, "") {
+			edits = append(edits, yamlAdditionEdits(lines, pair, deleted, additions)...)
+		}
+	}
+	if len(rootAdditions) > 0 {
+		indent, position := 0, len(lines)+1
+		if root != nil && len(root.Content) > 0 {
+			last := yamlPairs(root, "")[len(root.Content)/2-1]
+			indent, position = last.key.Column-1, yamlBlockEnd(lines, last)+1
+		} else if lines[len(lines)-1] == "" {
+			position = len(lines)
+		}
+		edits = append(edits, lineEdit{start: position, end: position - 1, lines: renderYaml(rootAdditions, indent, "")})
+	}
+	return []byte(strings.Join(applyLineEdits(lines, edits), "\n")), nil
+}
+
+// splitRenames will replace each rename with the removal of the old key and the addition of the new key, which
+// is nested under its own parent in yaml
+func splitRenames(changes []changeSet) []changeSet {
+	split := make([]changeSet, 0, len(changes))
+	for _, change := range changes {
+		if change.renamedTo == "" {
+			split = append(split, change)
+			continue
+		}
+		split = append(split, changeSet{key: change.key, delete: true}, changeSet{key: change.renamedTo, newValue: change.newValue})
+	}
+	return split
+}
+
+// findYamlPair will find the pair for a canonical property name.  When the key does not exist it returns the
+// deepest existing pair holding a mapping the key belongs in, along with the number of name elements it covers
+func findYamlPair(mapping *yamlv3.Node, canonical string) (*yamlPair, *yamlPair, int, error) {
+	var parent *yamlPair
+	consumed := 0
+	prefix := ""
+	for mapping != nil {
+		var next *yamlPair
+		for _, pair := range yamlPairs(mapping, prefix) {
+			pair := pair
+			name := canonicalName(pair.name)
+			if name == canonical {
+				return &pair, parent, 0, nil
+			}
+			if strings.HasPrefix(canonical, name+".") && pair.value.Kind == yamlv3.MappingNode {
+				next = &pair
+				break
+			}
+		}
+		if next == nil {
+			break
+		}
+		if next.value.Style&yamlv3.FlowStyle != 0 || next.value.Line == next.key.Line {
+			return nil, nil, 0, errNotEditable
+		}
+		parent = next
+		consumed = len(strings.Split(canonicalName(next.name), "."))
+		prefix = next.name
+		mapping = next.value
+	}
+	return nil, parent, consumed, nil
+}
+
+// yamlPairs will list the pairs of a mapping node, naming each key below prefix
+func yamlPairs(mapping *yamlv3.Node, prefix string) []yamlPair {
+	pairs := make([]yamlPair, 0, len(mapping.Content)/2)
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		name := mapping.Content[i].Value
+		if prefix != "" {
+			name = prefix + "." + name
+		}
+		pairs = append(pairs, yamlPair{mapping: mapping, key: mapping.Content[i], value: mapping.Content[i+1], name: name})
+	}
+	return pairs
+}
+
+// markEmptyMappings will mark a key as deleted when every key below it is deleted and nothing is added to it
+func markEmptyMappings(mapping *yamlv3.Node, deleted map[*yamlv3.Node]bool, additions map[*yamlv3.Node]yaml.MapSlice) bool {
+	empty := len(mapping.Content) > 0 && len(additions[mapping]) == 0
+	for _, pair := range yamlPairs(mapping, "") {
+		if !deleted[pair.key] && pair.value.Kind == yamlv3.MappingNode && markEmptyMappings(pair.value, deleted, additions) {
+			deleted[pair.key] = true
+		}
+		empty = empty && deleted[pair.key]
+	}
+	return empty
+}
+
+// yamlDeleteEdits will remove the lines of each deleted pair; the pairs below a deleted pair go with it
+func yamlDeleteEdits(lines []string, mapping *yamlv3.Node, prefix string, deleted map[*yamlv3.Node]bool) []lineEdit {
+	edits := make([]lineEdit, 0)
+	for _, pair := range yamlPairs(mapping, prefix) {
+		if deleted[pair.key] {
+			edits = append(edits, lineEdit{start: pair.key.Line, end: yamlBlockEnd(lines, pair)})
+		} else if pair.value.Kind == yamlv3.MappingNode {
+			edits = append(edits, yamlDeleteEdits(lines, pair.value, pair.name, deleted)...)
+		}
+	}
+	return edits
+}
+
+// yamlAdditionEdits will insert the keys added below a pair, or any pair nested within it, after the pair's last line
+func yamlAdditionEdits(lines []string, pair yamlPair, deleted map[*yamlv3.Node]bool, additions map[*yamlv3.Node]yaml.MapSlice) []lineEdit {
+	if deleted[pair.key] || pair.value.Kind != yamlv3.MappingNode {
+		return nil
+	}
+	edits := make([]lineEdit, 0)
+	if added := additions[pair.value]; len(added) > 0 {
+		indent := pair.key.Column + 1
+		if len(pair.value.Content) > 0 {
+			indent = pair.value.Content[0].Column - 1
+		}
+		position := yamlBlockEnd(lines, pair) + 1
+		edits = append(edits, lineEdit{start: position, end: position - 1, lines: renderYaml(added, indent, "")})
+	}
+	for _, child := range yamlPairs(pair.value, pair.name) {
+		edits = append(edits, yamlAdditionEdits(lines, child, deleted, additions)...)
+	}
+	return edits
+}
+
+// yamlBlockEnd will find the last line of a pair: every following line indented deeper than the key, or a
+// sequence entry at the key's own indent.  Blank and comment lines after the block are left to what follows
+func yamlBlockEnd(lines []string, pair yamlPair) int {
+	last := pair.key.Line
+	column := pair.key.Column - 1
+	for i := pair.key.Line; i < len(lines); i++ {
+		trimmed := strings.TrimSpace(lines[i])
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		indent := len(lines[i]) - len(strings.TrimLeft(lines[i], " "))
+		isSequenceEntry := indent == column && pair.value.Kind == yamlv3.SequenceNode && strings.HasPrefix(trimmed, "-") && trimmed != "---"
+		if indent <= column && !isSequenceEntry {
+			break
+		}
+		last = i + 1
+	}
+	return last
+}
+
+// renderYaml will marshal a tree of properties indented to sit at the given column, keeping a line comment on
+// single line output
+func renderYaml(tree yaml.MapSlice, indent int, lineComment string) []string {
+	content, err := yaml.Marshal(tree)
+	if err != nil {
+		return nil
+	}
+	rendered := strings.Split(strings.TrimSuffix(string(content), "\n"), "\n")
+	for i := range rendered {
+		rendered[i] = strings.Repeat(" ", indent) + rendered[i]
+	}
+	if lineComment != "" && len(rendered) == 1 {
+		rendered[0] += " " + lineComment
+	}
+	return rendered
+}
+
+// applyLineEdits will apply edits from the bottom of the file up so the line numbers of earlier edits stay valid.
+// Insertions at the same line keep the order they were given in
+func applyLineEdits(lines []string, edits []lineEdit) []string {
+	order := make([]int, len(edits))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(i, j int) bool {
+		left, right := edits[order[i]], edits[order[j]]
+		if left.start != right.start {
+			return left.start > right.start
+		}
+		// lines are removed before anything is inserted in their place
+		if leftInsert, rightInsert := left.end < left.start, right.end < right.start; leftInsert != rightInsert {
+			return rightInsert
+		}
+		return order[i] > order[j]
+	})
+	edited := append([]string{}, lines...)
+	for _, index := range order {
+		edit := edits[index]
+		tail := append(append([]string{}, edit.lines...), edited[edit.end:]...)
+		edited = append(edited[:edit.start-1], tail...)
+	}
+	return edited
+}
+
+// editPropertiesConfig will remove the entries of deleted keys from a properties file, replace the entries of
+// updated keys where they are, write renamed keys in place of the old key and append new keys to the end of the file
+func editPropertiesConfig(original []byte, changes []changeSet) ([]byte, error) {
+	content := strings.ReplaceAll(string(original), "\r\n", "\n")
+	lines := strings.Split(content, "\n")
+	entries := make(map[string][]logicalLine)
+	for _, line := range readLogicalLines(content) {
+		trimmed := strings.TrimLeft(line.text, " \t\f")
+		if isPropertiesDocumentSeparator(trimmed) {
+			return nil, errNotEditable
+		}
+		if trimmed == "" || trimmed[0] == '#' || trimmed[0] == '!' {
+			continue
+		}
+		key, _, err := splitPropertiesEntry(trimmed)
+		if err != nil {
+			return nil, err
+		}
+		root := canonicalName(key)
+		if parts := indexedNameRegex.FindStringSubmatch(key); parts != nil {
+			root = canonicalName(parts[1])
+		}
+		entries[root] = append(entries[root], line)
+	}
+
+	edits := make([]lineEdit, 0)
+	appended := make([]string, 0)
+	for _, change := range changes {
+		if !change.delete && change.newValue == nil {
+			continue
+		}
+		existing := entries[canonicalName(change.key)]
+		if change.renamedTo != "" {
+			// a renamed key keeps its place in the file
+			change.key = change.renamedTo
+		}
+		if change.delete {
+			for _, line := range existing {
+				edits = append(edits, lineEdit{start: line.start, end: line.end})
+			}
+			continue
+		}
+		rendered := strings.Split(strings.TrimSuffix(string(formatProperties(singleProperty(change.key, change.newValue))), "\n"), "\n")
+		if len(existing) == 0 {
+			appended = append(appended, rendered...)
+			continue
+		}
+		edits = append(edits, lineEdit{start: existing[0].start, end: existing[0].end, lines: rendered})
+		for _, line := range existing[1:] {
+			edits = append(edits, lineEdit{start: line.start, end: line.end})
+		}
+	}
+	if len(appended) > 0 {
+		position := len(lines) + 1
+		if lines[len(lines)-1] == "" {
+			position = len(lines)
+		}
+		edits = append(edits, lineEdit{start: position, end: position - 1, lines: appended})
+	}
+	return []byte(strings.Join(applyLineEdits(lines, edits), "\n")), nil
+}
+
+// singleProperty will hold one property in a set of its own
+func singleProperty(name string, value interface{}) *propertySet {
+	properties := newPropertySet()
+	properties.set(property{name: name, value: value})
+	return properties
+}
@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEditYamlKeepsCommentsAndOrder(t *testing.T) {
+	original := "# service settings\n" +
+		"server:\n" +
+		"  port: 8080 # the http port\n" +
+		"\n" +
+		"  # shared across profiles\n" +
+		"  name: shared\n" +
+		"spring:\n" +
+		"  datasource:\n" +
+		"    url: jdbc:h2:mem\n" +
+		"\n" +
+		"# logging\n" +
+		"logging:\n" +
+		"  level: info\n"
+	changes := []changeSet{
+		{key: "server.name", delete: true},
+		{key: "spring.datasource.url", delete: true},
+		{key: "server.port", newValue: 9090},
+		{key: "logging.format", newValue: "json"},
+		{key: "management.port", newValue: 8081},
+	}
+
+	edited, err := editYamlConfig([]byte(original), changes)
+	assert.Nil(t, err)
+	assert.Equal(t, "# service settings\n"+
+		"server:\n"+
+		"  port: 9090 # the http port\n"+
+		"\n"+
+		"  # shared across profiles\n"+
+		"\n"+
+		"# logging\n"+
+		"logging:\n"+
+		"  level: info\n"+
+		"  format: json\n"+
+		"management:\n"+
+		"  port: 8081\n", string(edited))
+}
+
+func TestEditYamlDeletesSequencesAndBlockScalars(t *testing.T) {
+	original := "servers:\n- a\n- b\nbanner: |\n  line one\n\n  line two\nkept: true\n"
+	edited, err := editYamlConfig([]byte(original), []changeSet{{key: "servers", delete: true}, {key: "banner", delete: true}})
+	assert.Nil(t, err)
+	assert.Equal(t, "kept: true\n", string(edited))
+
+	_, err = editYamlConfig([]byte("server: {port: 1, name: a}\n"), []changeSet{{key: "server.port", delete: true}})
+	assert.Equal(t, errNotEditable, err)
+}
+
+func TestEditPropertiesKeepsCommentsAndOrder(t *testing.T) {
+	original := "# header\n" +
+		"server.port=8080\n" +
+		"servers[0]=a\n" +
+		"servers[1]=b\n" +
+		"! long value\n" +
+		"description=one \\\n" +
+		"    two\n" +
+		"name=old\n"
+	changes := []changeSet{
+		{key: "servers", delete: true},
+		{key: "description", delete: true},
+		{key: "name", newValue: "new value"},
+		{key: "added", newValue: "a:b"},
+	}
+
+	edited, err := editPropertiesConfig([]byte(original), changes)
+	assert.Nil(t, err)
+	assert.Equal(t, "# header\n"+
+		"server.port=8080\n"+
+		"! long value\n"+
+		"name=new value\n"+
+		"added=a\\:b\n", string(edited))
+
+	empty, err := isEmptyConfig([]byte("# only a comment\n"), "properties")
+	assert.Nil(t, err)
+	assert.True(t, empty)
+}
+
+func TestPruneKeepsLayoutOfSourceFiles(t *testing.T) {
+	appCtx, cleanup := newTestPruner(t, map[string]string{
+		"application.yml":      "# defaults\nserver:\n  port: 8080\n",
+		"application-dev.yml":  "# dev only\nname: shared # same everywhere\n\nlevel: debug\n",
+		"application-prod.yml": "name: shared\nlevel: warn\n",
+	})
+	defer cleanup()
+	appCtx.Config.InPlace = true
+	appCtx.Config.BackupDirectory = appCtx.Config.OutputDirectory + "/backups"
+
+	assert.Nil(t, appCtx.Prune([]string{"dev", "prod"}, []string{"application"}))
+
+	assertFileContent(t, appCtx, "application.yml", "# defaults\nserver:\n  port: 8080\nname: shared\n")
+	assertFileContent(t, appCtx, "application-dev.yml", "# dev only\n\nlevel: debug\n")
+	assertFileContent(t, appCtx, "application-prod.yml", "level: warn\n")
+}
+
+func TestEditYamlAddsAfterDeletedLastKey(t *testing.T) {
+	original := "logging:\n  level: info\n  format: text\nname: a\n"
+	changes := []changeSet{{key: "logging.format", delete: true}, {key: "logging.pattern", newValue: "%m"}, {key: "name", delete: true}, {key: "other", newValue: 1}}
+	edited, err := editYamlConfig([]byte(original), changes)
+	assert.Nil(t, err)
+	assert.Equal(t, "logging:\n  level: info\n  pattern: '%m'\nother: 1\n", string(edited))
+}
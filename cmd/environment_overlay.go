@@ -0,0 +1,215 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	log "github.com/gkontos/bivalve-chronicles"
+)
+
+const (
+	processEnvironmentSource = "the process environment"
+	systemPropertySource     = "-D system property"
+)
+
+// environmentOverride is a value set by the environment along with the configuration file value it replaced
+type environmentOverride struct {
+	property property
+	// overridden is the value from the configuration files; it is nil when only the environment sets the key
+	overridden *property
+}
+
+// effectiveProfile will merge a profile the way unionProfileAndContext does, over the bootstrap files when the
+// context inherits them, add the property sources of a config server url and then layer the environment over it,
+// returning each key the environment set
+func (appCtx *Pruner) effectiveProfile(profile string, context string) (*propertySet, []environmentOverride, error) {
+	properties, err := appCtx.unionProfileAndContext(profile, context)
+	if err != nil {
+		return nil, nil, err
+	}
+	profiles, err := appCtx.activeProfiles(profile, context)
+	if err != nil {
+		return nil, nil, err
+	}
+	if appCtx.inheritsBootstrap(context) {
+		bootstrap, err := loadSources(orderSources(appCtx.ConfigFiles, profiles, bootstrapContext, appCtx.Config.Precedence))
+		if err != nil {
+			return nil, nil, err
+		}
+		properties = bootstrap.merge(properties)
+	}
+	remote, err := appCtx.configServerLayers(profiles, context)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, layer := range remote {
+		properties = properties.merge(layer)
+	}
+	layers, err := appCtx.environmentLayers(properties)
+	if err != nil {
+		return nil, nil, err
+	}
+	overrides := make([]environmentOverride, 0)
+	found := make(map[string]int)
+	for _, layer := range layers {
+		for _, key := range layer.keys() {
+			p, _ := layer.get(key)
+			if index, seen := found[key]; seen {
+				overrides[index].property = p
+				continue
+			}
+			override := environmentOverride{property: p}
+			if existing, ok := properties.get(key); ok {
+				override.overridden = &existing
+			}
+			found[key] = len(overrides)
+			overrides = append(overrides, override)
+		}
+		properties = properties.merge(layer)
+	}
+	return properties, overrides, nil
+}
+
+// environmentLayers will read the environment from lowest to highest precedence: the process environment, each
+// environment file in order and then the system properties.  Only process variables that belong to a namespace the
+// configuration files use are kept, so PATH and HOME do not show up as properties
+func (appCtx *Pruner) environmentLayers(configured *propertySet) ([]*propertySet, error) {
+	layers := make([]*propertySet, 0)
+	if appCtx.Config.ProcessEnvironment {
+		namespaces := make(map[string]bool)
+		for _, key := range configured.keys() {
+			namespaces[strings.SplitN(key, ".", 2)[0]] = true
+		}
+		layer := newPropertySet()
+		for _, variable := range os.Environ() {
+			name, value, _ := splitEnvironmentEntry(variable)
+			if namespaces[strings.SplitN(canonicalName(name), ".", 2)[0]] {
+				layer.set(environmentProperty(name, value, processEnvironmentSource, 0))
+			}
+		}
+		layers = append(layers, layer)
+	}
+	explicit, err := appCtx.configuredEnvironmentLayers()
+	if err != nil {
+		return nil, err
+	}
+	return append(layers, explicit...), nil
+}
+
+// configuredEnvironmentLayers will read the environment the configuration names explicitly, each environment file in
+// order and then the system properties, leaving out the process environment
+func (appCtx *Pruner) configuredEnvironmentLayers() ([]*propertySet, error) {
+	layers := make([]*propertySet, 0)
+	for _, path := range appCtx.Config.EnvironmentFiles {
+		layer, err := readEnvironmentFile(path)
+		if err != nil {
+			return nil, err
+		}
+		layers = append(layers, layer)
+	}
+	if len(appCtx.Config.SystemProperties) > 0 {
+		layer := newPropertySet()
+		for _, entry := range appCtx.Config.SystemProperties {
+			name, value, ok := splitEnvironmentEntry(strings.TrimPrefix(entry, "-D"))
+			if !ok {
+				return nil, fmt.Errorf("invalid system property %q, expected -Dname=value", entry)
+			}
+			layer.set(environmentProperty(name, value, systemPropertySource, 0))
+		}
+		layers = append(layers, layer)
+	}
+	return layers, nil
+}
+
+// layeredEnvironment will look a placeholder up in the environment layers, the highest layer that sets it winning.
+// Names are matched with relaxed binding, so that db.host also finds DB_HOST
+func layeredEnvironment(layers []*propertySet) environmentLookup {
+	merged := newPropertySet()
+	for _, layer := range layers {
+		merged = merged.merge(layer)
+	}
+	return func(name string) (string, bool) {
+		value, ok := lookupProperty(merged, name)
+		if !ok || isContainer(value) {
+			return "", false
+		}
+		return propertiesValue(value), true
+	}
+}
+
+// resolveView will resolve the placeholders of a merged profile against the same environment layers the view
+// applies over it, so that ${x} and x always show the same value
+func (appCtx *Pruner) resolveView(properties *propertySet) (*propertySet, []placeholderProblem, error) {
+	layers, err := appCtx.environmentLayers(properties)
+	if err != nil {
+		return nil, nil, err
+	}
+	resolved, problems := resolvePlaceholders(properties, layeredEnvironment(layers))
+	return resolved, problems, nil
+}
+
+// pruneEnvironment is the environment placeholders are resolved against when values are compared resolved: only the
+// environment files and system properties of the configuration, so that a prune never depends on the shell it runs in
+func (appCtx *Pruner) pruneEnvironment() (environmentLookup, error) {
+	layers, err := appCtx.configuredEnvironmentLayers()
+	if err != nil {
+		return nil, err
+	}
+	return layeredEnvironment(layers), nil
+}
+
+// readEnvironmentFile will read a .env or docker style env file of NAME=value lines.  Blank lines, # comments and a
+// leading export are skipped and a value wrapped in matching quotes is unwrapped
+func readEnvironmentFile(path string) (*propertySet, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read environment file %s: %v", path, err)
+	}
+	layer := newPropertySet()
+	for i, line := range strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, value, ok := splitEnvironmentEntry(strings.TrimPrefix(line, "export "))
+		if !ok {
+			return nil, fmt.Errorf("%s:%d: expected NAME=value", path, i+1)
+		}
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		layer.set(environmentProperty(strings.TrimSpace(name), value, path, i+1))
+	}
+	log.Debugf("read %d variables from %s", layer.len(), path)
+	return layer, nil
+}
+
+func splitEnvironmentEntry(entry string) (string, string, bool) {
+	i := strings.Index(entry, "=")
+	if i <= 0 {
+		return entry, "", false
+	}
+	return entry[:i], entry[i+1:], true
+}
+
+// environmentProperty will name an environment variable by its relaxed binding form, so that MY_SERVERS_0_HOST sets
+// an element of the my.servers list, and record the name as it was written in the source
+func environmentProperty(name string, value string, origin string, line int) property {
+	key := name
+	if isEnvironmentForm(name) {
+		key = canonicalName(name)
+	}
+	return property{name: key, value: value, source: fmt.Sprintf("%s in %s", name, origin), line: line}
+}
+
+// describeOverride will format a key the environment sets along with the configuration value it replaced
+func (appCtx *Pruner) describeOverride(override environmentOverride) string {
+	description := fmt.Sprintf("%s = %v\n    from %s", override.property.name, appCtx.displayed(override.property), sourceLocation(override.property))
+	if override.overridden == nil {
+		return description + "\n    not set in the configuration files"
+	}
+	return fmt.Sprintf("%s\n    overrides %v from %s", description, appCtx.displayed(*override.overridden), sourceLocation(*override.overridden))
+}
@@ -0,0 +1,108 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v2"
+)
+
+func TestReadEnvironmentFile(t *testing.T) {
+	file, err := ioutil.TempFile("", "env")
+	assert.Nil(t, err)
+	defer os.Remove(file.Name())
+	_, err = file.WriteString("# database\nexport SPRING_DATASOURCE_URL=\"jdbc:h2:mem\"\n\nAPP_SERVERS_0_HOST='a'\napp.name=plain=text\n")
+	assert.Nil(t, err)
+	file.Close()
+
+	layer, err := readEnvironmentFile(file.Name())
+	assert.Nil(t, err)
+	url, _ := layer.get("spring.datasource.url")
+	assert.Equal(t, "jdbc:h2:mem", url.value)
+	assert.Equal(t, "SPRING_DATASOURCE_URL in "+file.Name()+":2", sourceLocation(url))
+	servers, _ := layer.get("app.servers")
+	assert.EqualValues(t, []interface{}{yaml.MapSlice{{Key: "host", Value: "a"}}}, servers.value)
+	name, _ := layer.get("app.name")
+	assert.Equal(t, "plain=text", name.value)
+
+	assert.Nil(t, ioutil.WriteFile(file.Name(), []byte("NOT A VARIABLE\n"), 0644))
+	_, err = readEnvironmentFile(file.Name())
+	assert.EqualError(t, err, file.Name()+":1: expected NAME=value")
+}
+
+func TestEnvironmentOverridesConfiguration(t *testing.T) {
+	appCtx, cleanup := newTestPruner(t, map[string]string{
+		"application.yml":     "spring:\n  datasource:\n    url: jdbc:h2:mem\n    username: sa\nserver:\n  port: 8080\n",
+		"application-dev.yml": "server:\n  port: 8081\n",
+		"external/.env":       "SPRING_DATASOURCE_URL=jdbc:postgresql://db/app\nSERVER_PORT=9000\nAPP_MODE=blue\n",
+	})
+	defer cleanup()
+	os.Setenv("SPRING_DATASOURCE_USERNAME", "from-process")
+	os.Setenv("UNRELATED_VARIABLE", "ignored")
+	defer os.Unsetenv("SPRING_DATASOURCE_USERNAME")
+	defer os.Unsetenv("UNRELATED_VARIABLE")
+	envFile := filepath.Join(appCtx.Config.ProjectRoot, "external/.env")
+	appCtx.Config.ProcessEnvironment = true
+	appCtx.Config.EnvironmentFiles = []string{envFile}
+	appCtx.Config.SystemProperties = []string{"-Dserver.port=9100"}
+
+	properties, overrides, err := appCtx.effectiveProfile("dev", "application")
+	assert.Nil(t, err)
+	for key, expected := range map[string]string{
+		"spring.datasource.url":      "jdbc:postgresql://db/app",
+		"spring.datasource.username": "from-process",
+		"server.port":                "9100",
+		"app.mode":                   "blue",
+	} {
+		p, _ := properties.get(key)
+		assert.EqualValues(t, expected, p.value, key)
+	}
+	_, found := properties.get("unrelated.variable")
+	assert.False(t, found, "process variables outside the configured namespaces are skipped")
+
+	described := make(map[string]string)
+	for _, override := range overrides {
+		described[override.property.name] = appCtx.describeOverride(override)
+	}
+	assert.Len(t, described, 4)
+	assert.Equal(t, "server.port = 9100\n    from server.port in -D system property\n    overrides 8081 from "+
+		filepath.Join(appCtx.Config.ProjectRoot, javaClasspathResourcePath, "application-dev.yml")+":2", described["server.port"])
+	assert.Equal(t, "app.mode = blue\n    from APP_MODE in "+envFile+":3\n    not set in the configuration files", described["app.mode"])
+
+	origins, _, err := appCtx.explainProfileAndContext("dev", "application")
+	assert.Nil(t, err)
+	assert.Len(t, origins["server.port"].chain, 4, "application.yml, application-dev.yml, .env and -D")
+}
+
+func TestResolveViewUsesEnvironmentLayers(t *testing.T) {
+	appCtx, cleanup := newTestPruner(t, map[string]string{
+		"application.yml": "server:\n  port: 8080\n  url: http://localhost:${server.port}\n",
+		"external/.env":   "SERVER_PORT=9000\n",
+	})
+	defer cleanup()
+	os.Setenv("SERVER_PORT", "from-process")
+	defer os.Unsetenv("SERVER_PORT")
+	appCtx.Config.EnvironmentFiles = []string{filepath.Join(appCtx.Config.ProjectRoot, "external/.env")}
+
+	properties, _, err := appCtx.effectiveProfile("", "application")
+	assert.Nil(t, err)
+	resolved, problems, err := appCtx.resolveView(properties)
+	assert.Nil(t, err)
+	assert.Empty(t, problems)
+	url, _ := resolved.get("server.url")
+	assert.EqualValues(t, "http://localhost:9000", url.value, "the process environment is only used when it is turned on")
+
+	appCtx.Config.ProcessEnvironment = true
+	appCtx.Config.SystemProperties = []string{"-Dserver.port=9100"}
+	properties, _, err = appCtx.effectiveProfile("", "application")
+	assert.Nil(t, err)
+	resolved, _, err = appCtx.resolveView(properties)
+	assert.Nil(t, err)
+	port, _ := resolved.get("server.port")
+	url, _ = resolved.get("server.url")
+	assert.EqualValues(t, "9100", port.value)
+	assert.EqualValues(t, "http://localhost:9100", url.value, "a placeholder shows the same value as the key it names")
+}
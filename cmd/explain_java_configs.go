@@ -0,0 +1,139 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	log "github.com/gkontos/bivalve-chronicles"
+)
+
+// propertyOrigin is the resolved value of a key along with every value it shadowed
+type propertyOrigin struct {
+	// chain holds each value set for the key from lowest to highest precedence; the last entry wins
+	chain []property
+}
+
+func (origin propertyOrigin) winner() property {
+	return origin.chain[len(origin.chain)-1]
+}
+
+// RunExplain will prompt for a profile and an optional key and explain where each resolved value came from
+func (appCtx *Pruner) RunExplain() {
+	runProfile, err := promptString("Spring Profile (single profile or a comma separated list)")
+	if err != nil {
+		log.Errorf("Error: %v", err)
+		return
+	}
+	key, err := promptOptionalString("Property to explain (blank for every property)")
+	if err != nil {
+		log.Errorf("Error: %v", err)
+		return
+	}
+	if err := appCtx.Explain(runProfile, fileNames, key); err != nil {
+		log.Errorf("Error: %v", err)
+	}
+}
+
+// Explain will list the winning source file and line for every resolved key, or only those at or below key, along
+// with the values from lower precedence sources that were overridden
+func (appCtx *Pruner) Explain(runProfile string, contexts []string, key string) error {
+	for _, context := range contexts {
+		origins, order, err := appCtx.explainProfileAndContext(runProfile, context)
+		if err != nil {
+			return err
+		}
+		log.Infof("ORIGINS FOR %s (profiles: %s)", context, runProfile)
+		found := false
+		for _, canonical := range order {
+			if key != "" && !keyMatches(canonical, key) {
+				continue
+			}
+			found = true
+			origin := origins[canonical]
+			for i, p := range origin.chain {
+				origin.chain[i].value = appCtx.displayed(p)
+			}
+			log.Infof("%s", describeOrigin(origin))
+		}
+		if !found && key != "" {
+			log.Infof("%s is not set in the %s context", key, context)
+		}
+	}
+	return nil
+}
+
+// keyMatches reports whether a canonical key is the requested key, or is nested below it
+func keyMatches(canonical string, key string) bool {
+	requested := canonicalName(key)
+	return canonical == requested || strings.HasPrefix(canonical, requested+".") || strings.HasPrefix(canonical, requested+"[")
+}
+
+// explainProfileAndContext will merge the sources for the profiles the way effectiveProfile does, keeping every value
+// set for each key.  The returned order is the order of the merged keys
+func (appCtx *Pruner) explainProfileAndContext(profile string, context string) (map[string]propertyOrigin, []string, error) {
+	profiles, err := appCtx.activeProfiles(profile, context)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	origins := make(map[string]propertyOrigin)
+	merged := newPropertySet()
+	applicationMetadata, err := appCtx.getConfigFileMetaByProfileAndContext(profiles, context)
+	if err != nil {
+		log.Errorf("Error loading %s profile, %v", profile, err)
+		return origins, merged.keys(), nil
+	}
+	addLayer := func(props *propertySet) {
+		for _, key := range props.keys() {
+			p, _ := props.get(key)
+			origin := origins[key]
+			origin.chain = append(origin.chain, p)
+			origins[key] = origin
+		}
+		merged = merged.merge(props)
+	}
+	if appCtx.inheritsBootstrap(context) {
+		applicationMetadata = append(orderSources(appCtx.ConfigFiles, profiles, bootstrapContext, appCtx.Config.Precedence), applicationMetadata...)
+	}
+	for _, fileMetadata := range applicationMetadata {
+		props, err := loadFromFile(fileMetadata)
+		if err != nil {
+			return nil, nil, err
+		}
+		addLayer(props)
+	}
+	remote, err := appCtx.configServerLayers(profiles, context)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, layer := range remote {
+		addLayer(layer)
+	}
+	layers, err := appCtx.environmentLayers(merged)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, layer := range layers {
+		addLayer(layer)
+	}
+	return origins, merged.keys(), nil
+}
+
+// describeOrigin will format the winning value of a key followed by each value it overrode, highest precedence first
+func describeOrigin(origin propertyOrigin) string {
+	var description strings.Builder
+	winner := origin.winner()
+	description.WriteString(fmt.Sprintf("%s = %v\n    from %s", winner.name, winner.value, sourceLocation(winner)))
+	for i := len(origin.chain) - 2; i >= 0; i-- {
+		shadowed := origin.chain[i]
+		description.WriteString(fmt.Sprintf("\n    overrides %s = %v from %s", shadowed.name, shadowed.value, sourceLocation(shadowed)))
+	}
+	return description.String()
+}
+
+func sourceLocation(p property) string {
+	if p.line > 0 {
+		return fmt.Sprintf("%s:%d", p.source, p.line)
+	}
+	return p.source
+}
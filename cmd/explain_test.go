@@ -0,0 +1,43 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExplainProfileAndContext(t *testing.T) {
+	appCtx, cleanup := newTestPruner(t, map[string]string{
+		"application.yml":              "spring:\n  datasource:\n    maxPoolSize: 10\n    url: jdbc:h2:mem\n",
+		"application-dev.properties":   "server.port=8081\nspring.datasource.max-pool-size=5\n",
+		"external/application-dev.yml": "spring:\n  datasource:\n    max_pool_size: 2\n",
+	})
+	defer cleanup()
+
+	origins, order, err := appCtx.explainProfileAndContext("dev", "application")
+	assert.Nil(t, err)
+	assert.EqualValues(t, []string{"spring.datasource.maxpoolsize", "spring.datasource.url", "server.port"}, order)
+
+	pool := origins["spring.datasource.maxpoolsize"]
+	assert.EqualValues(t, 3, len(pool.chain))
+	assert.EqualValues(t, 2, pool.winner().value)
+	assert.True(t, strings.HasSuffix(pool.winner().source, "external/application-dev.yml"))
+	assert.EqualValues(t, 3, pool.winner().line)
+	assert.EqualValues(t, "5", pool.chain[1].value)
+	assert.EqualValues(t, 2, pool.chain[1].line)
+	assert.EqualValues(t, 10, pool.chain[0].value)
+
+	description := describeOrigin(pool)
+	lines := strings.Split(description, "\n")
+	assert.EqualValues(t, 4, len(lines))
+	assert.EqualValues(t, "spring.datasource.max_pool_size = 2", lines[0])
+	assert.True(t, strings.HasSuffix(lines[3], "application.yml:3"))
+	assert.EqualValues(t, 1, len(origins["server.port"].chain))
+}
+
+func TestKeyMatches(t *testing.T) {
+	assert.True(t, keyMatches("spring.datasource.maxpoolsize", "spring.datasource.max-pool-size"))
+	assert.True(t, keyMatches("spring.datasource.maxpoolsize", "spring.dataSource"))
+	assert.False(t, keyMatches("spring.datasourcex.url", "spring.datasource"))
+}
@@ -0,0 +1,43 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gkontos/spiny-dogfish/config"
+	"github.com/gkontos/spiny-dogfish/model"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestPruner will write a spring project to a temporary directory and load its config file metadata.  Paths
+// are relative to src/main/resources unless they start with external/
+func newTestPruner(t *testing.T, files map[string]string) (*Pruner, func()) {
+	root, err := ioutil.TempDir("", "pruner")
+	assert.Nil(t, err)
+	for name, content := range files {
+		fullPath := filepath.Join(root, javaClasspathResourcePath, name)
+		if filepath.HasPrefix(name, "external/") {
+			fullPath = filepath.Join(root, name)
+		}
+		assert.Nil(t, os.MkdirAll(filepath.Dir(fullPath), 0755))
+		assert.Nil(t, ioutil.WriteFile(fullPath, []byte(content), 0644))
+	}
+	appCtx := &Pruner{}
+	appCtx.Config = &config.Application{
+		ProjectRoot:           root,
+		ExternalConfiguration: filepath.Join(root, "external"),
+		OutputDirectory:       filepath.Join(root, "out"),
+	}
+	appCtx.ConfigFiles = make(map[int8][]model.JavaConfigFileMetadata)
+	appCtx.LoadConfigFileMetadata()
+	return appCtx, func() { os.RemoveAll(root) }
+}
+
+// assertFileContent will compare a file below src/main/resources with the expected content
+func assertFileContent(t *testing.T, appCtx *Pruner, name string, expected string) {
+	content, err := ioutil.ReadFile(filepath.Join(appCtx.Config.ProjectRoot, javaClasspathResourcePath, name))
+	assert.Nil(t, err)
+	assert.Equal(t, expected, string(content), name)
+}
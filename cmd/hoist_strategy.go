@@ -0,0 +1,251 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// StrictHoisting only hoists a value that every pruned profile shares
+	StrictHoisting = "strict"
+	// MajorityHoisting hoists a value shared by more than half of the pruned profiles, and sets the value each of
+	// the others inherited from the default profile in its own files
+	MajorityHoisting = "majority"
+	// ThresholdHoisting hoists a value shared by at least hoist_threshold percent of the pruned profiles
+	ThresholdHoisting = "threshold"
+)
+
+var hoistStrategies = []string{StrictHoisting, MajorityHoisting, ThresholdHoisting}
+
+// hoistStrategy decides which values shared by the pruned profiles may be hoisted to the default profile
+type hoistStrategy struct {
+	name string
+	// threshold is the percentage of the pruned profiles that must share a value for the threshold strategy
+	threshold int
+	// keepDefault leaves the value of every key in the default profile as it is, which is the case when the
+	// default profile is one of the pruned profiles
+	keepDefault bool
+}
+
+// hoistStrategy will return the strategy set by hoist_strategy and hoist_threshold; majority is used when none is set
+func (env *Pruner) hoistStrategy(profiles []string) (hoistStrategy, error) {
+	strategy := hoistStrategy{name: env.Config.HoistStrategy, threshold: env.Config.HoistThreshold}
+	if strategy.name == "" {
+		strategy.name = MajorityHoisting
+	}
+	if _, found := Find(hoistStrategies, strategy.name); !found {
+		return strategy, fmt.Errorf("unknown hoist strategy %q, expected one of %s", strategy.name, strings.Join(hoistStrategies, ", "))
+	}
+	if strategy.name == ThresholdHoisting && (strategy.threshold < 1 || strategy.threshold > 100) {
+		return strategy, fmt.Errorf("hoist_threshold must be a percentage between 1 and 100, not %d", strategy.threshold)
+	}
+	_, strategy.keepDefault = Find(profiles, defaultProfileKey)
+	return strategy, nil
+}
+
+// allows reports whether a value shared by matches of the pruned profiles may be hoisted
+func (strategy hoistStrategy) allows(matches int, profiles int) bool {
+	if strategy.keepDefault {
+		return false
+	}
+	switch strategy.name {
+	case MajorityHoisting:
+		return matches*2 > profiles
+	case ThresholdHoisting:
+		return matches*100 >= strategy.threshold*profiles
+	}
+	return matches == profiles
+}
+
+// bestLayout will choose the value of a key in the default profile that takes the fewest lines across the default
+// profile and the own files of the pruned profiles.  Leaving the default profile as it is costs its current value,
+// if it has one, plus each profile's value that differs from it.  Hoisting a shared value the strategy allows costs
+// that value plus each profile's value that differs from it, as those profiles keep or gain their own copy.  The
+// shared value to hoist is returned, or nil when the default profile is best left as it is, which also wins a tie
+func (strategy hoistStrategy) bestLayout(matchingValues []matchingKeys, current interface{}, inDefault bool) *matchingKeys {
+	profiles := 0
+	for _, match := range matchingValues {
+		profiles += len(match.profileMatches)
+	}
+	lines := func(defaultValue interface{}, hasDefault bool) int {
+		total := 0
+		if hasDefault {
+			total = valueLines(defaultValue)
+		}
+		for _, match := range matchingValues {
+			if !hasDefault || !valuesEqual(match.sharedValue, defaultValue) {
+				total += len(match.profileMatches) * valueLines(match.sharedValue)
+			}
+		}
+		return total
+	}
+
+	var best *matchingKeys
+	fewest := lines(current, inDefault)
+	for i, match := range matchingValues {
+		if !strategy.allows(len(match.profileMatches), profiles) || (inDefault && valuesEqual(match.sharedValue, current)) {
+			continue
+		}
+		if total := lines(match.sharedValue, true); total < fewest {
+			best, fewest = &matchingValues[i], total
+		}
+	}
+	return best
+}
+
+// valueLines is the number of lines a value takes in a properties file, one for each scalar it holds
+func valueLines(value interface{}) int {
+	return len(indexedProperties(property{value: value}))
+}
+
+// comparedValue will return the value of a key in a profile as it is compared: resolved when values are compared
+// resolved, otherwise as it is written
+func comparedValue(profileProperty profilePropertyPruner, key string) (interface{}, bool) {
+	if profileProperty.resolved != nil {
+		if p, ok := profileProperty.resolved.get(key); ok {
+			return p.value, true
+		}
+	}
+	p, ok := profileProperty.properties.get(key)
+	return p.value, ok
+}
+
+// valueDifference is a key whose effective value in a profile is not the same once the profiles are pruned
+type valueDifference struct {
+	profile string
+	key     string
+	// before and after are nil when the profile does not see the key
+	before *property
+	after  *property
+}
+
+// verifiedViews will merge each profile a prune must leave as it is: every profile the files name, other than the
+// default profile, which takes the hoisted values, unless the default profile is pruned itself.  Placeholders are
+// resolved against the profile and the configured environment when values are compared resolved
+func (env *Pruner) verifiedViews(context string, strategy hoistStrategy) (map[string]*propertySet, error) {
+	environment, err := env.pruneEnvironment()
+	if err != nil {
+		return nil, err
+	}
+	views := make(map[string]*propertySet)
+	for _, profile := range uniqueProfiles(env.ConfigFiles) {
+		if profile == defaultProfileKey && !strategy.keepDefault {
+			continue
+		}
+		// the files are merged the way unionProfileAndContext merges them, without logging a context a profile has no files in
+		active, err := env.activeProfiles(profile, context)
+		if err != nil {
+			return nil, err
+		}
+		properties, err := loadSources(orderSources(env.ConfigFiles, active, context, env.Config.Precedence))
+		if err != nil {
+			return nil, err
+		}
+		if env.Config.Compare == ResolvedComparison {
+			properties, _ = resolvePlaceholders(properties, environment)
+		}
+		views[profile] = properties
+	}
+	return views, nil
+}
+
+// prunedDifferences will merge each of the views again with pruned in place of the own files of each pruned profile
+// and return every key whose value differs, ordered by profile and then by key
+func (env *Pruner) prunedDifferences(views map[string]*propertySet, context string, pruned map[string]*propertySet) ([]valueDifference, error) {
+	environment, err := env.pruneEnvironment()
+	if err != nil {
+		return nil, err
+	}
+	differences := make([]valueDifference, 0)
+	for _, profile := range uniqueProfiles(env.ConfigFiles) {
+		before, ok := views[profile]
+		if !ok {
+			continue
+		}
+		after, err := env.prunedView(profile, context, pruned)
+		if err != nil {
+			return nil, err
+		}
+		if env.Config.Compare == ResolvedComparison {
+			after, _ = resolvePlaceholders(after, environment)
+		}
+		seen := make(map[string]bool)
+		for _, key := range append(before.keys(), after.keys()...) {
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			b, inBefore := before.get(key)
+			a, inAfter := after.get(key)
+			if inBefore == inAfter && (!inBefore || valuesEqual(b.value, a.value)) {
+				continue
+			}
+			difference := valueDifference{profile: profile, key: key}
+			if inBefore {
+				difference.before = &b
+			}
+			if inAfter {
+				difference.after = &a
+			}
+			differences = append(differences, difference)
+		}
+	}
+	return differences, nil
+}
+
+// prunedChanges will merge each of the views again with the changes applied to the own files of every pruned
+// profile, and return each canonical key whose value changes along with the first profile it changes in
+func (env *Pruner) prunedChanges(profileProperties []profilePropertyPruner, context string, views map[string]*propertySet) (map[string]string, error) {
+	pruned := make(map[string]*propertySet)
+	for _, profileProperty := range profileProperties {
+		pruned[profileProperty.profile] = applyChanges(newPropertySet().merge(profileProperty.own), profileProperty.changes)
+	}
+	differences, err := env.prunedDifferences(views, context, pruned)
+	if err != nil {
+		return nil, err
+	}
+	changed := make(map[string]string)
+	for _, difference := range differences {
+		if _, seen := changed[difference.key]; !seen {
+			changed[difference.key] = difference.profile
+		}
+	}
+	return changed, nil
+}
+
+// prunedView will merge the files of a profile the way unionProfileAndContext does, with the properties in pruned
+// used in place of the own files of their profile.  They are merged where the first of those files is
+func (env *Pruner) prunedView(profile string, context string, pruned map[string]*propertySet) (*propertySet, error) {
+	profiles, err := env.activeProfiles(profile, context)
+	if err != nil {
+		return nil, err
+	}
+	properties := newPropertySet()
+	merged := make(map[string]bool)
+	if props, ok := pruned[defaultProfileKey]; ok && len(env.profileSources(defaultProfileKey, context)) == 0 {
+		// the default profile gains a new file, which every profile inherits
+		properties = properties.merge(props)
+		merged[defaultProfileKey] = true
+	}
+	for _, source := range orderSources(env.ConfigFiles, profiles, context, env.Config.Precedence) {
+		if props, ok := pruned[source.Profile]; ok && !isReadOnly(source) {
+			if !merged[source.Profile] {
+				properties = properties.merge(props)
+				merged[source.Profile] = true
+			}
+			continue
+		}
+		props, err := loadFromFile(source)
+		if err != nil {
+			return nil, err
+		}
+		properties = properties.merge(props)
+	}
+	// any other profile without files of its own gains a new one, which is merged after the files it inherits
+	for _, active := range profiles {
+		if props, ok := pruned[active]; ok && !merged[active] {
+			properties = properties.merge(props)
+		}
+	}
+	return properties, nil
+}
@@ -3,9 +3,6 @@ package cmd
 import (
 	"errors"
 	"fmt"
-	"io/ioutil"
-	"os"
-	"reflect"
 	"regexp"
 	"sort"
 	"strings"
@@ -13,7 +10,6 @@ import (
 	log "github.com/gkontos/bivalve-chronicles"
 
 	"github.com/gkontos/spiny-dogfish/model"
-	"github.com/spf13/viper"
 	"gopkg.in/yaml.v2"
 )
 
@@ -30,40 +26,105 @@ var fileNames = []string{"application", "bootstrap"}
 // RunInitialLoad will pull in configurations from the configured locations
 func (appCtx *Pruner) RunInitialLoad() {
 
+	appCtx.logProfiles()
+	if runProfile, err := promptString("Spring Profile (single profile or a comma separated list)"); err != nil {
+		log.Errorf("Error: %v", err)
+	} else if err := appCtx.displayCombinedProfile(runProfile, fileNames); err != nil {
+		log.Errorf("Error: %v", err)
+	}
+}
+
+// ViewProfile will display the combined configuration for a profile (or comma separated list of profiles) in each of the requested contexts
+func (appCtx *Pruner) ViewProfile(runProfile string, contexts []string) error {
+	appCtx.logProfiles()
+	return appCtx.displayCombinedProfile(runProfile, contexts)
+}
+
+// ParseContexts will split a comma separated list of application contexts.  An empty value selects every context
+func ParseContexts(value string) ([]string, error) {
+	if strings.TrimSpace(value) == "" {
+		return fileNames, nil
+	}
+	contexts := make([]string, 0)
+	for _, context := range strings.Split(value, ",") {
+		context = strings.TrimSpace(context)
+		if _, found := Find(fileNames, context); !found {
+			return nil, fmt.Errorf("unknown context %q, expected one of %s", context, strings.Join(fileNames, ", "))
+		}
+		contexts = append(contexts, context)
+	}
+	return contexts, nil
+}
+
+func (appCtx *Pruner) logProfiles() {
 	for _, profile := range uniqueProfiles(appCtx.ConfigFiles) {
 		log.Infof("found profile: %v", profile)
 	}
-	appCtx.displayCombinedProfile()
 }
 
 // LoadConfigFileMetadata will load the file metadata for configs
 func (appCtx *Pruner) LoadConfigFileMetadata() {
+	if _, found := Find(precedenceModels, appCtx.Config.Precedence); !found && appCtx.Config.Precedence != "" {
+		log.Errorf("Unknown precedence %q, expected one of %s.  Using %s", appCtx.Config.Precedence, strings.Join(precedenceModels, ", "), CurrentPrecedence)
+	}
 	configClassPathLocation := appCtx.Config.ProjectRoot + "/" + javaClasspathResourcePath
 	log.Infof("Scanning %s", configClassPathLocation)
-	files := make([]model.JavaConfigFileMetadata, 0)
-	configFiles := appCtx.getFiles(configClassPathLocation, files)
-	appCtx.ConfigFiles[classpathFileKey] = configFiles
+	summary := scanDirectory(configClassPathLocation, appCtx.Config.Scan)
+	summary.logSummary()
+	appCtx.ConfigFiles[classpathFileKey] = expandDocuments(summary.discovered)
+	appCtx.loadArchiveFiles()
+
+	if appCtx.Config.ExternalConfiguration == "" {
+		log.Infof("No external configuration directory set")
+		appCtx.ConfigFiles[externalFileKey] = make([]model.JavaConfigFileMetadata, 0)
+	} else {
+		log.Infof("Scanning %s", appCtx.Config.ExternalConfiguration)
+		summary = scanDirectory(appCtx.Config.ExternalConfiguration, appCtx.Config.Scan)
+		summary.logSummary()
+		appCtx.ConfigFiles[externalFileKey] = expandDocuments(summary.discovered)
+	}
 
-	log.Infof("Scanning %s", appCtx.Config.ExternalConfiguration)
-	files = make([]model.JavaConfigFileMetadata, 0)
-	configFiles = appCtx.getFiles(appCtx.Config.ExternalConfiguration, files)
-	appCtx.ConfigFiles[externalFileKey] = configFiles
+	// the application name may come from the project's own files, so the config server is scanned last
+	appCtx.loadConfigServerFiles()
 }
 
-func (appCtx *Pruner) displayCombinedProfile() {
-	if runProfile, err := promptString("Spring Profile (single profile or a comma separated list)"); err != nil {
-		log.Errorf("Error: %v", err)
-	} else {
-		for _, context := range fileNames {
-			profileProperties := appCtx.unionProfileAndContext(runProfile, context)
-			d, err := yaml.Marshal(&profileProperties)
-			if err != nil {
-				panic(fmt.Sprintf("error: %v", err))
+func (appCtx *Pruner) displayCombinedProfile(runProfile string, contexts []string) error {
+	for _, context := range contexts {
+		active, err := appCtx.activeProfiles(runProfile, context)
+		if err != nil {
+			return err
+		}
+		log.Infof("ACTIVE PROFILES FOR %s: %s", context, strings.Join(active, ", "))
+		profileProperties, overrides, err := appCtx.effectiveProfile(runProfile, context)
+		if err != nil {
+			return err
+		}
+		if appCtx.Config.ResolvePlaceholders {
+			var problems []placeholderProblem
+			if profileProperties, problems, err = appCtx.resolveView(profileProperties); err != nil {
+				return err
+			}
+			for _, problem := range problems {
+				log.Errorf("Unresolved placeholder: %s", problem)
+			}
+		}
+		if !appCtx.Config.ShowSecrets {
+			profileProperties = maskSecrets(profileProperties)
+		}
+		d, err := yaml.Marshal(profileProperties.nested())
+		if err != nil {
+			return fmt.Errorf("unable to marshal %s configuration: %v", context, err)
+		}
+		log.Infof("CONFIGURATION FOR %s", context)
+		log.Infof("--- t dump:\n%s\n\n", string(d))
+		if len(overrides) > 0 {
+			log.Infof("SET BY THE ENVIRONMENT FOR %s", context)
+			for _, override := range overrides {
+				log.Infof("%s", appCtx.describeOverride(override))
 			}
-			log.Infof("CONFIGURATION FOR %s", context)
-			log.Infof("--- t dump:\n%s\n\n", string(d))
 		}
 	}
+	return nil
 }
 
 func validateEmptyInput(input string) error {
@@ -73,45 +134,6 @@ func validateEmptyInput(input string) error {
 	return nil
 }
 
-// getFiles will recursively crawl the search directory and return a list of the configuration files at that location
-func (appCtx *Pruner) getFiles(searchDir string, files []model.JavaConfigFileMetadata) []model.JavaConfigFileMetadata {
-	var fileInfo []os.FileInfo
-	var err error
-	log.Infof("Scanning directory %s ", searchDir)
-	if fileInfo, err = ioutil.ReadDir(searchDir); err != nil {
-		log.Errorf("Unable to read directory at %s: %v", searchDir, err)
-		return files
-	}
-	for _, file := range fileInfo {
-		if file.IsDir() {
-			log.Infof("Directory Found %s ", file.Name())
-			return appCtx.getFiles(searchDir+"/"+file.Name(), files)
-
-		}
-		parts := strings.Split(file.Name(), ".")
-		if len(parts) > 1 {
-			if _, found := Find(fileTypes, parts[1]); found {
-				fileNameParts := strings.Split(parts[0], "-")
-				if _, isJavaConfig := Find(fileNames, fileNameParts[0]); isJavaConfig {
-					configFile := model.JavaConfigFileMetadata{}
-					configFile.ConfigurationType = parts[len(parts)-1]
-					configFile.Path = searchDir + "/" + file.Name()
-					if len(fileNameParts) > 1 {
-						configFile.Profile = fileNameParts[len(fileNameParts)-1]
-					} else {
-						configFile.Profile = defaultProfileKey
-					}
-					configFile.ApplicationContext = fileNameParts[0]
-
-					files = append(files, configFile)
-				}
-			}
-		}
-	}
-
-	return files
-}
-
 // Find will return the index of an item within a slice if it exists.  If the element is not in the slice, Find will return -1
 func Find(slice []string, val string) (int, bool) {
 	for i, item := range slice {
@@ -138,102 +160,95 @@ func uniqueProfiles(files map[int8][]model.JavaConfigFileMetadata) []string {
 	return uniqueProfiles
 }
 
-func (appCtx *Pruner) unionProfileAndContext(profile string, context string) map[string]interface{} {
+// scopeProfiles will return the default profile followed by the requested profiles, or by the configured profiles
+// when none are requested, or by every profile the files name when none are configured
+func (appCtx *Pruner) scopeProfiles(profiles []string) []string {
+	if len(profiles) == 0 {
+		profiles = appCtx.Config.Profiles
+	}
+	if len(profiles) == 0 {
+		profiles = uniqueProfiles(appCtx.ConfigFiles)
+	}
+	if _, found := Find(profiles, defaultProfileKey); !found {
+		profiles = append([]string{defaultProfileKey}, profiles...)
+	}
+	return profiles
+}
 
-	commaRegex := regexp.MustCompile(`,\s+`)
-	profiles := commaRegex.Split(profile, -1)
-	profiles = append([]string{defaultProfileKey}, profiles...)
+// unionProfileAndContext will merge every document that applies to a profile (or comma separated list of profiles),
+// along with the profiles they include or group with it, in spring boot's precedence order.  See activeProfiles and
+// rankSource for the rules that are applied
+func (appCtx *Pruner) unionProfileAndContext(profile string, context string) (*propertySet, error) {
 
-	profileProperties := make(map[string]interface{})
-	// for each profiles, create a union of the configuration
-	for _, profile := range profiles {
-		if applicationMetadata, err := appCtx.getConfigFileMetaByProfileAndContext(profile, context); err != nil {
-			log.Errorf("Error loading %s profile, %v", profile, err)
+	profiles, err := appCtx.activeProfiles(profile, context)
+	if err != nil {
+		return nil, err
+	}
 
-		} else {
-			// To store the keys in slice in sorted order
-			var keys []int
-			for k := range applicationMetadata {
-				keys = append(keys, int(k))
-			}
-			sort.Ints(keys)
-			log.Debugf("keys:%+v", keys)
-
-			// To perform the opertion you want
-			// THINK ABOUT THIS.  ESP the order.  this is doing default classpath, default external, profile classpath, profile external
-			props := make(map[string]interface{}, 0)
-			for _, k := range keys {
-				log.Debugf("merging key:%d", k)
-				log.Debugf("%+v", applicationMetadata[int8(k)])
-				props = loadFromFile(applicationMetadata[int8(k)])
-				log.Debugf("props : %+v", props)
-				if len(profileProperties) == 0 {
-					profileProperties = props
-				} else {
-					profileProperties = mergeMaps(profileProperties, props)
-				}
-			}
-		}
+	applicationMetadata, err := appCtx.getConfigFileMetaByProfileAndContext(profiles, context)
+	if err != nil {
+		log.Errorf("Error loading %s profile, %v", profile, err)
+		return newPropertySet(), nil
 	}
-	return profileProperties
+	return loadSources(applicationMetadata)
 
 }
 
-func loadFromFile(fileMetadata model.JavaConfigFileMetadata) map[string]interface{} {
-
-	pathParts := strings.Split(fileMetadata.Path, "/")
-	configName := strings.Split(pathParts[len(pathParts)-1], ".")[0]
-	pathParts = pathParts[:len(pathParts)-1]
-	path := strings.Join(pathParts, "/")
-	v := viper.New()
-	v.SetConfigName(configName)                     // name of config file (without extension)
-	v.SetConfigType(fileMetadata.ConfigurationType) // REQUIRED if the config file does not have the extension in the name
-	v.AddConfigPath(path)                           // path to look for the config file in
-	err := v.ReadInConfig()                         // Find and read the config file
-	if err != nil {                                 // Handle errors reading the config file
-		panic(fmt.Errorf("fatal error config file: %s ", err))
+// profileSources will return the sources that belong to a profile itself, rather than those it inherits from the
+// default profile, in the order they are merged.  Files packaged in archives can not be changed and are left out
+func (appCtx *Pruner) profileSources(profile string, context string) []model.JavaConfigFileMetadata {
+	sources := make([]model.JavaConfigFileMetadata, 0)
+	for _, fileMetadata := range orderSources(appCtx.ConfigFiles, []string{profile}, context, appCtx.Config.Precedence) {
+		if fileMetadata.Profile == profile && !isReadOnly(fileMetadata) {
+			sources = append(sources, fileMetadata)
+		}
 	}
-	return v.AllSettings()
+	return sources
 }
 
-func (appCtx *Pruner) getConfigFileMetaByProfileAndContext(profile string, context string) (map[int8]model.JavaConfigFileMetadata, error) {
-	profileConfigFiles := make(map[int8]model.JavaConfigFileMetadata)
-	for loadOrder, fileList := range appCtx.ConfigFiles {
-		log.Debugf("load order :%d, files : %+v", loadOrder, fileList)
-		for _, file := range fileList {
+// loadSources will merge the sources in order, each overriding the ones before it
+func loadSources(sources []model.JavaConfigFileMetadata) (*propertySet, error) {
+	properties := newPropertySet()
+	for _, fileMetadata := range sources {
+		log.Debugf("merging %s document %d", fileMetadata.Path, fileMetadata.Document)
+		props, err := loadFromFile(fileMetadata)
+		if err != nil {
+			return nil, err
+		}
+		log.Debugf("props : %+v", props.keys())
+		properties = properties.merge(props)
+	}
+	return properties, nil
+}
 
-			if file.ApplicationContext == context && file.Profile == profile {
-				profileConfigFiles[loadOrder] = file
-			}
+func splitProfileList(profile string) []string {
+	commaRegex := regexp.MustCompile(`\s*,\s*`)
+	return commaRegex.Split(strings.TrimSpace(profile), -1)
+}
 
-		}
+// loadFromFile will read a single document of a configuration file into a flat property set, keeping the key
+// spelling used in the file.  Profile activation keys are not part of the returned properties
+func loadFromFile(fileMetadata model.JavaConfigFileMetadata) (*propertySet, error) {
+	documents, err := readDocuments(fileMetadata)
+	if err != nil {
+		return nil, err
 	}
-	if len(profileConfigFiles) > 0 {
-		log.Debugf("configFiles : %+v", profileConfigFiles)
-		return profileConfigFiles, nil
+	if fileMetadata.Document >= len(documents) {
+		return nil, fmt.Errorf("%s has no document %d", fileMetadata.Path, fileMetadata.Document+1)
 	}
-	return nil, fmt.Errorf("config not found for profile:%s and context:%s ", profile, context)
+	document := documents[fileMetadata.Document]
+	if _, err := activationProfiles(document); err != nil {
+		return nil, err
+	}
+	return document, nil
 }
 
-// mergeMaps will merge map m2 onto map m1
-func mergeMaps(m1 map[string]interface{}, m2 map[string]interface{}) map[string]interface{} {
-	m3 := make(map[string]interface{})
-	for k, v := range m1 {
-		m3[k] = v
-	}
-	for k, v := range m2 {
-		// if the key exists within the map
-		if _, ok := m3[k]; ok {
-			if reflect.TypeOf(m3[k]).Kind() == reflect.Map {
-				//  if the value is a map, we need to merge the maps found
-				m3[k] = mergeMaps(m3[k].(map[string]interface{}), v.(map[string]interface{}))
-			} else {
-				//  if the value is not a map we will overwrite the existing value with that found in m2
-				m3[k] = v
-			}
-		} else {
-			m3[k] = v
-		}
+// getConfigFileMetaByProfileAndContext will return the documents for the active profiles from lowest to highest precedence
+func (appCtx *Pruner) getConfigFileMetaByProfileAndContext(profiles []string, context string) ([]model.JavaConfigFileMetadata, error) {
+	profileConfigFiles := orderSources(appCtx.ConfigFiles, profiles, context, appCtx.Config.Precedence)
+	if len(profileConfigFiles) > 0 {
+		log.Debugf("configFiles : %+v", profileConfigFiles)
+		return profileConfigFiles, nil
 	}
-	return m3
+	return nil, fmt.Errorf("config not found for profile:%s and context:%s ", strings.Join(profiles, ","), context)
 }
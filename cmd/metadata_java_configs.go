@@ -0,0 +1,312 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	log "github.com/gkontos/bivalve-chronicles"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	unknownKeyProblem   = "unknown"
+	typeMismatchProblem = "type"
+	deprecatedProblem   = "deprecated"
+	defaultValueProblem = "default"
+)
+
+// metadataFileNames are written by the spring boot configuration processor, the second holding hand written hints
+var metadataFileNames = []string{"spring-configuration-metadata.json", "additional-spring-configuration-metadata.json"}
+
+// metadataBuildDirectories are searched below the project root for metadata generated by maven and gradle builds
+var metadataBuildDirectories = []string{"target/classes", "build"}
+
+var (
+	durationRegex       = regexp.MustCompile(`(?i)^[-+]?\d+\s*(ns|us|ms|s|m|h|d)?$`)
+	isoDurationRegex    = regexp.MustCompile(`(?i)^[-+]?P`)
+	dataSizeRegex       = regexp.MustCompile(`(?i)^[-+]?\d+\s*(B|KB|MB|GB|TB)?$`)
+	booleanTypes        = []string{"boolean", "java.lang.Boolean"}
+	booleanValues       = []string{"true", "false", "on", "off", "yes", "no", "1", "0"}
+	integerTypes        = []string{"int", "long", "short", "byte", "java.lang.Integer", "java.lang.Long", "java.lang.Short", "java.lang.Byte", "java.math.BigInteger"}
+	decimalTypes        = []string{"double", "float", "java.lang.Double", "java.lang.Float", "java.math.BigDecimal"}
+	textTypes           = []string{"char", "java.lang.String", "java.lang.Character", "java.nio.charset.Charset", "java.util.Locale"}
+	collectionTypes     = []string{"java.util.List", "java.util.Set", "java.util.Collection"}
+	mapTypes            = []string{"java.util.Map"}
+	durationTypes       = []string{"java.time.Duration"}
+	dataSizeTypes       = []string{"org.springframework.util.unit.DataSize"}
+	metadataSearchSkips = []string{"node_modules", ".git", "tmp"}
+)
+
+// metadataProperty is a single entry of the properties list in spring-configuration-metadata.json
+type metadataProperty struct {
+	Name         string               `json:"name"`
+	Type         string               `json:"type"`
+	DefaultValue interface{}          `json:"defaultValue"`
+	Deprecated   bool                 `json:"deprecated"`
+	Deprecation  *metadataDeprecation `json:"deprecation"`
+}
+
+type metadataDeprecation struct {
+	Level       string `json:"level"`
+	Reason      string `json:"reason"`
+	Replacement string `json:"replacement"`
+}
+
+type metadataGroup struct {
+	Name string `json:"name"`
+}
+
+type metadataFile struct {
+	Groups     []metadataGroup    `json:"groups"`
+	Properties []metadataProperty `json:"properties"`
+}
+
+// configurationMetadata is every known property keyed by canonical name, merged from all metadata files found
+type configurationMetadata struct {
+	properties map[string]metadataProperty
+	// namespaces are the first element of every documented name; keys outside of them are not reported as unknown
+	namespaces map[string]bool
+	files      []string
+}
+
+// metadataProblem is a property that does not agree with the metadata
+type metadataProblem struct {
+	kind     string
+	property property
+	message  string
+}
+
+func (problem metadataProblem) String() string {
+	return fmt.Sprintf("%s: %s = %v\n    from %s\n    %s", problem.kind, problem.property.name, problem.property.value,
+		sourceLocation(problem.property), problem.message)
+}
+
+// RunValidate will prompt for a profile and validate its properties against the spring configuration metadata
+func (appCtx *Pruner) RunValidate() {
+	runProfile, err := promptString("Spring Profile (single profile or a comma separated list)")
+	if err != nil {
+		log.Errorf("Error: %v", err)
+		return
+	}
+	if err := appCtx.Validate(runProfile, fileNames); err != nil {
+		log.Errorf("Error: %v", err)
+	}
+}
+
+// Validate will check the merged properties of a profile against spring-configuration-metadata.json, listing unknown
+// keys, values that can not be bound to the documented type, deprecated keys and values that restate the default
+func (appCtx *Pruner) Validate(runProfile string, contexts []string) error {
+	metadata, err := loadConfigurationMetadata(appCtx.metadataDirectories())
+	if err != nil {
+		return err
+	}
+	if len(metadata.files) == 0 {
+		return fmt.Errorf("no %s found below %s", metadataFileNames[0], strings.Join(appCtx.metadataDirectories(), ", "))
+	}
+	log.Infof("validating against %d documented properties from %s", len(metadata.properties), strings.Join(metadata.files, ", "))
+	for _, context := range contexts {
+		properties, _, err := appCtx.effectiveProfile(runProfile, context)
+		if err != nil {
+			return err
+		}
+		problems := metadata.validate(properties)
+		log.Infof("METADATA PROBLEMS FOR %s (profiles: %s)", context, runProfile)
+		for _, problem := range problems {
+			problem.property.value = appCtx.displayed(problem.property)
+			log.Infof("%s", problem)
+		}
+		log.Infof("%d problems in %d properties of %s", len(problems), properties.len(), context)
+	}
+	return nil
+}
+
+// metadataDirectories are the build output directories of the project followed by those from the config
+func (appCtx *Pruner) metadataDirectories() []string {
+	directories := make([]string, 0)
+	for _, directory := range metadataBuildDirectories {
+		directories = append(directories, filepath.Join(appCtx.Config.ProjectRoot, directory))
+	}
+	return append(directories, appCtx.Config.MetadataDirectories...)
+}
+
+// loadConfigurationMetadata will read every metadata file below the directories.  When a property is documented
+// more than once the first one found is kept
+func loadConfigurationMetadata(directories []string) (*configurationMetadata, error) {
+	metadata := &configurationMetadata{properties: make(map[string]metadataProperty), namespaces: make(map[string]bool), files: make([]string, 0)}
+	for _, directory := range directories {
+		if _, err := os.Stat(directory); os.IsNotExist(err) {
+			continue
+		}
+		err := filepath.Walk(directory, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() {
+				// the directory itself is searched whatever its name, as it was configured
+				if _, skip := Find(metadataSearchSkips, info.Name()); skip && path != directory {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if _, found := Find(metadataFileNames, info.Name()); !found || filepath.Base(filepath.Dir(path)) != "META-INF" {
+				return nil
+			}
+			return metadata.read(path)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("unable to read metadata from %s: %v", directory, err)
+		}
+	}
+	return metadata, nil
+}
+
+// read will add the properties and groups of a single metadata file
+func (metadata *configurationMetadata) read(path string) error {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var file metadataFile
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	// numbers are kept as written so that a default of 1000000 is not compared as 1e+06
+	decoder.UseNumber()
+	if err := decoder.Decode(&file); err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	for _, group := range file.Groups {
+		metadata.namespaces[strings.SplitN(canonicalName(group.Name), ".", 2)[0]] = true
+	}
+	for _, documented := range file.Properties {
+		canonical := canonicalName(documented.Name)
+		metadata.namespaces[strings.SplitN(canonical, ".", 2)[0]] = true
+		if _, exists := metadata.properties[canonical]; !exists {
+			metadata.properties[canonical] = documented
+		}
+	}
+	metadata.files = append(metadata.files, path)
+	log.Debugf("read %d properties from %s", len(file.Properties), path)
+	return nil
+}
+
+// validate will compare each property with its documentation
+func (metadata *configurationMetadata) validate(properties *propertySet) []metadataProblem {
+	problems := make([]metadataProblem, 0)
+	for _, key := range properties.keys() {
+		p, _ := properties.get(key)
+		documented, found := metadata.properties[key]
+		if !found {
+			if !metadata.covers(key) && metadata.namespaces[strings.SplitN(key, ".", 2)[0]] {
+				problems = append(problems, metadataProblem{kind: unknownKeyProblem, property: p, message: "is not a documented property"})
+			}
+			continue
+		}
+		if documented.Deprecated || documented.Deprecation != nil {
+			problems = append(problems, metadataProblem{kind: deprecatedProblem, property: p, message: deprecationMessage(documented)})
+		}
+		if expected, mismatch := typeMismatch(documented.Type, p.value); mismatch {
+			problems = append(problems, metadataProblem{kind: typeMismatchProblem, property: p,
+				message: fmt.Sprintf("can not be bound to %s, expected %s", documented.Type, expected)})
+		} else if documented.DefaultValue != nil && valuesEqual(p.value, documented.DefaultValue) {
+			problems = append(problems, metadataProblem{kind: defaultValueProblem, property: p,
+				message: fmt.Sprintf("restates the default %v and can be removed", documented.DefaultValue)})
+		}
+	}
+	return problems
+}
+
+// covers will report whether a key sits below a documented map, collection or nested object, whose entries are not
+// documented individually
+func (metadata *configurationMetadata) covers(key string) bool {
+	for name, documented := range metadata.properties {
+		if isBelow(key, name) && !isScalarType(documented.Type) {
+			return true
+		}
+	}
+	return false
+}
+
+func deprecationMessage(documented metadataProperty) string {
+	message := "is deprecated"
+	deprecation := documented.Deprecation
+	if deprecation == nil {
+		return message
+	}
+	if deprecation.Level == "error" {
+		message = "is no longer supported"
+	}
+	if deprecation.Replacement != "" {
+		message = fmt.Sprintf("%s, use %s instead", message, deprecation.Replacement)
+	}
+	if deprecation.Reason != "" {
+		message = fmt.Sprintf("%s (%s)", message, deprecation.Reason)
+	}
+	return message
+}
+
+// javaBaseType will strip the generic arguments from a type such as java.util.Map<java.lang.String,java.lang.String>
+func javaBaseType(javaType string) string {
+	if i := strings.Index(javaType, "<"); i >= 0 {
+		return javaType[:i]
+	}
+	return javaType
+}
+
+func isScalarType(javaType string) bool {
+	base := javaBaseType(javaType)
+	for _, types := range [][]string{booleanTypes, integerTypes, decimalTypes, textTypes, durationTypes, dataSizeTypes} {
+		if _, found := Find(types, base); found {
+			return true
+		}
+	}
+	return false
+}
+
+// typeMismatch will check whether spring could bind a value to the documented java type, returning a description
+// of the expected value when it can not.  Values holding placeholders and types that are not known are not checked
+func typeMismatch(javaType string, value interface{}) (string, bool) {
+	base := javaBaseType(javaType)
+	if _, found := Find(collectionTypes, base); found || strings.HasSuffix(base, "[]") {
+		_, isMap := value.(yaml.MapSlice)
+		return "a list or a comma separated value", isMap
+	}
+	if _, found := Find(mapTypes, base); found {
+		_, isMap := value.(yaml.MapSlice)
+		return "a map of keys to values", !isMap
+	}
+	if !isScalarType(javaType) {
+		return "", false
+	}
+	if isContainer(value) {
+		return "a single value", true
+	}
+	text := strings.TrimSpace(fmt.Sprint(value))
+	if value == nil || strings.Contains(text, placeholderPrefix) {
+		return "", false
+	}
+	if _, found := Find(booleanTypes, base); found {
+		_, found := Find(booleanValues, strings.ToLower(text))
+		return "true, false, on, off, yes, no, 1 or 0", !found
+	}
+	if _, found := Find(integerTypes, base); found {
+		_, err := strconv.ParseInt(text, 10, 64)
+		return "a whole number", err != nil
+	}
+	if _, found := Find(decimalTypes, base); found {
+		_, err := strconv.ParseFloat(text, 64)
+		return "a number", err != nil
+	}
+	if _, found := Find(durationTypes, base); found {
+		return "a duration such as 30s or PT30S", !durationRegex.MatchString(text) && !isoDurationRegex.MatchString(text)
+	}
+	if _, found := Find(dataSizeTypes, base); found {
+		return "a data size such as 10MB", !dataSizeRegex.MatchString(text)
+	}
+	return "", false
+}
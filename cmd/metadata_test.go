@@ -0,0 +1,100 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testMetadata = `{
+  "groups": [{"name": "server", "type": "org.springframework.boot.autoconfigure.web.ServerProperties"}],
+  "properties": [
+    {"name": "server.port", "type": "java.lang.Integer", "defaultValue": 8080},
+    {"name": "server.compression.enabled", "type": "java.lang.Boolean", "defaultValue": false},
+    {"name": "server.servlet.session.timeout", "type": "java.time.Duration", "defaultValue": "30m"},
+    {"name": "server.max-http-header-size", "type": "org.springframework.util.unit.DataSize"},
+    {"name": "server.tomcat.mbeanregistry", "type": "java.lang.Boolean", "deprecated": true,
+     "deprecation": {"level": "warning", "replacement": "server.tomcat.mbeanregistry.enabled", "reason": "renamed"}},
+    {"name": "logging.level", "type": "java.util.Map<java.lang.String,java.lang.String>"}
+  ]
+}`
+
+func TestValidateAgainstMetadata(t *testing.T) {
+	appCtx, cleanup := newTestPruner(t, map[string]string{
+		"application.yml": "server:\n" +
+			"  port: 8080\n" +
+			"  maxHttpHeaderSize: 16KB\n" +
+			"  compression:\n    enabled: maybe\n" +
+			"  servlet:\n    session:\n      timeout: ${SESSION_TIMEOUT:30m}\n" +
+			"  tomcat:\n    mbeanregistry: true\n" +
+			"  prot: 9090\n" +
+			"logging:\n  level:\n    root: warn\n" +
+			"app:\n  name: mine\n",
+	})
+	defer cleanup()
+	metadataPath := filepath.Join(appCtx.Config.ProjectRoot, "target/classes/META-INF/spring-configuration-metadata.json")
+	assert.Nil(t, os.MkdirAll(filepath.Dir(metadataPath), 0755))
+	assert.Nil(t, ioutil.WriteFile(metadataPath, []byte(testMetadata), 0644))
+
+	metadata, err := loadConfigurationMetadata(appCtx.metadataDirectories())
+	assert.Nil(t, err)
+	assert.EqualValues(t, []string{metadataPath}, metadata.files)
+	properties, err := appCtx.unionProfileAndContext("", "application")
+	assert.Nil(t, err)
+
+	found := make(map[string]string)
+	for _, problem := range metadata.validate(properties) {
+		found[problem.property.name] = problem.kind + ": " + problem.message
+	}
+	assert.EqualValues(t, map[string]string{
+		"server.port":                 "default: restates the default 8080 and can be removed",
+		"server.compression.enabled":  "type: can not be bound to java.lang.Boolean, expected true, false, on, off, yes, no, 1 or 0",
+		"server.tomcat.mbeanregistry": "deprecated: is deprecated, use server.tomcat.mbeanregistry.enabled instead (renamed)",
+		"server.prot":                 "unknown: is not a documented property",
+	}, found)
+}
+
+func TestTypeMismatch(t *testing.T) {
+	for _, check := range []struct {
+		javaType string
+		value    interface{}
+		mismatch bool
+	}{
+		{"java.lang.Integer", 10, false},
+		{"int", "ten", true},
+		{"java.lang.Double", "0.75", false},
+		{"java.lang.Boolean", "on", false},
+		{"boolean", "No", false},
+		{"java.lang.Boolean", "maybe", true},
+		{"java.time.Duration", "PT30S", false},
+		{"java.time.Duration", "10 minutes", true},
+		{"org.springframework.util.unit.DataSize", "10MB", false},
+		{"java.util.List<java.lang.String>", "a,b", false},
+		{"java.util.List<java.lang.String>", []interface{}{"a"}, false},
+		{"java.lang.String", []interface{}{"a"}, true},
+		{"com.example.Mode", "anything", false},
+	} {
+		_, mismatch := typeMismatch(check.javaType, check.value)
+		assert.Equal(t, check.mismatch, mismatch, "%s %v", check.javaType, check.value)
+	}
+}
+
+func TestMetadataDirectoryNamedLikeASkip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "metadata")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	configured := filepath.Join(dir, "tmp")
+	metadataPath := filepath.Join(configured, "META-INF", "spring-configuration-metadata.json")
+	skippedPath := filepath.Join(configured, "node_modules", "META-INF", "spring-configuration-metadata.json")
+	for _, path := range []string{metadataPath, skippedPath} {
+		assert.Nil(t, os.MkdirAll(filepath.Dir(path), 0755))
+		assert.Nil(t, ioutil.WriteFile(path, []byte(testMetadata), 0644))
+	}
+
+	metadata, err := loadConfigurationMetadata([]string{configured})
+	assert.Nil(t, err)
+	assert.EqualValues(t, []string{metadataPath}, metadata.files, "only directories below the configured one are skipped")
+}
@@ -0,0 +1,454 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/gkontos/bivalve-chronicles"
+	"gopkg.in/yaml.v2"
+
+	"github.com/gkontos/spiny-dogfish/model"
+)
+
+// renameWildcard marks a rename of every key below a prefix, as in spring.redis.* -> spring.data.redis.*
+const renameWildcard = ".*"
+
+// propertyRename renames a single key, or every key below a prefix when both names end with .*
+type propertyRename struct {
+	from string
+	to   string
+}
+
+// migrationDocument is a single document of a profile being migrated, with the edits and renames decided for it
+type migrationDocument struct {
+	source     model.JavaConfigFileMetadata
+	properties *propertySet
+	rank       precedenceRank
+	edits      map[string]changeSet
+	renames    []changeSet
+}
+
+// migrationCandidate is a key of a document that ends up with a new name, or the key already using that name
+type migrationCandidate struct {
+	document *migrationDocument
+	property property
+	newName  string
+	renamed  bool
+}
+
+// bootRenames are the keys renamed by a spring boot release
+type bootRenames struct {
+	version string
+	renames []propertyRename
+}
+
+// builtinRenames are the renames from the spring boot release notes that keep the value as it is.  Within a release
+// single keys are listed before the prefixes that would otherwise match them
+var builtinRenames = []bootRenames{
+	{version: "2.0", renames: []propertyRename{
+		{"security.user.role", "spring.security.user.roles"},
+		{"security.user.*", "spring.security.user.*"},
+		{"server.context-path", "server.servlet.context-path"},
+		{"server.servlet-path", "server.servlet.path"},
+		{"server.context-parameters.*", "server.servlet.context-parameters.*"},
+		{"server.session.*", "server.servlet.session.*"},
+		{"server.jsp-servlet.*", "server.servlet.jsp.*"},
+		{"management.port", "management.server.port"},
+		{"management.address", "management.server.address"},
+		{"management.context-path", "management.server.servlet.context-path"},
+		{"management.ssl.*", "management.server.ssl.*"},
+		{"spring.http.multipart.*", "spring.servlet.multipart.*"},
+		{"flyway.*", "spring.flyway.*"},
+		{"liquibase.*", "spring.liquibase.*"},
+	}},
+	{version: "2.3", renames: []propertyRename{
+		{"spring.http.encoding.*", "server.servlet.encoding.*"},
+		{"spring.http.log-request-details", "spring.mvc.log-request-details"},
+		{"spring.http.converters.preferred-json-mapper", "spring.mvc.converters.preferred-json-mapper"},
+	}},
+	{version: "2.4", renames: []propertyRename{
+		{"management.server.servlet.context-path", "management.server.base-path"},
+	}},
+	{version: "2.5", renames: []propertyRename{
+		{"spring.datasource.initialization-mode", "spring.sql.init.mode"},
+		{"spring.datasource.schema", "spring.sql.init.schema-locations"},
+		{"spring.datasource.data", "spring.sql.init.data-locations"},
+		{"spring.datasource.platform", "spring.sql.init.platform"},
+		{"spring.datasource.continue-on-error", "spring.sql.init.continue-on-error"},
+		{"spring.datasource.separator", "spring.sql.init.separator"},
+		{"spring.datasource.sql-script-encoding", "spring.sql.init.encoding"},
+	}},
+	{version: "2.6", renames: []propertyRename{
+		{"spring.elasticsearch.rest.uris", "spring.elasticsearch.uris"},
+		{"spring.elasticsearch.rest.username", "spring.elasticsearch.username"},
+		{"spring.elasticsearch.rest.password", "spring.elasticsearch.password"},
+		{"spring.elasticsearch.rest.connection-timeout", "spring.elasticsearch.connection-timeout"},
+		{"spring.elasticsearch.rest.read-timeout", "spring.elasticsearch.socket-timeout"},
+	}},
+	{version: "3.0", renames: []propertyRename{
+		{"spring.redis.*", "spring.data.redis.*"},
+		{"spring.data.cassandra.*", "spring.cassandra.*"},
+		{"server.max-http-header-size", "server.max-http-request-header-size"},
+		{"management.metrics.export.prometheus.*", "management.prometheus.metrics.export.*"},
+		{"management.metrics.export.datadog.*", "management.datadog.metrics.export.*"},
+		{"management.metrics.export.graphite.*", "management.graphite.metrics.export.*"},
+		{"management.metrics.export.influx.*", "management.influx.metrics.export.*"},
+	}},
+}
+
+// RunMigrate will prompt for the spring boot versions and rename the deprecated keys in every configuration file
+func (env *Pruner) RunMigrate() {
+	from, err := promptOptionalString("Spring Boot version migrating from (blank for the oldest)")
+	if err != nil {
+		log.Errorf("Error: %v", err)
+		return
+	}
+	to, err := promptOptionalString("Spring Boot version migrating to (blank for the latest)")
+	if err != nil {
+		log.Errorf("Error: %v", err)
+		return
+	}
+	env.Config.MigrateFrom, env.Config.MigrateTo = from, to
+	if err := env.Migrate(fileNames); err != nil {
+		log.Errorf("Error: %v", err)
+	}
+}
+
+// Migrate will rename the keys of every configuration file in the contexts using the rename table file followed by
+// the built in renames of each spring boot release after MigrateFrom up to MigrateTo.  Files are rewritten in
+// place, after backing them up, unless this is a dry run.  Each rename is recorded in the change report
+func (env *Pruner) Migrate(contexts []string) (err error) {
+	if _, found := Find(reportFormats, env.Config.ReportFormat); !found && env.Config.ReportFormat != "" {
+		return fmt.Errorf("unknown report format %q, expected one of %s", env.Config.ReportFormat, strings.Join(reportFormats, ", "))
+	}
+	tables, err := env.renameTables()
+	if err != nil {
+		return err
+	}
+
+	results := make([]prunedContext, 0)
+	for _, context := range contexts {
+		documents, err := env.migrationDocuments(context, tables)
+		if err != nil {
+			return err
+		}
+		profiles := make([]string, 0, len(documents))
+		for profile := range documents {
+			profiles = append(profiles, profile)
+		}
+		sort.Strings(profiles)
+		for _, profile := range profiles {
+			migrationChanges(documents[profile], tables)
+			for _, document := range documents[profile] {
+				if len(document.edits) == 0 {
+					continue
+				}
+				source := document.source
+				migrated := profilePropertyPruner{profile: source.Profile, properties: applyChanges(document.properties, document.edits),
+					changes: document.edits, sources: []model.JavaConfigFileMetadata{source}}
+				results = append(results, prunedContext{
+					context:           context,
+					profileProperties: []profilePropertyPruner{migrated},
+					changes:           document.renames,
+					targets:           map[string]inPlaceTarget{source.Profile: {path: source.Path, configType: source.ConfigurationType, source: &source}},
+				})
+			}
+		}
+	}
+	if len(results) == 0 {
+		log.Info("No keys need to be renamed")
+		return nil
+	}
+
+	if env.Config.DryRun {
+		return env.previewChanges(results)
+	}
+	backup, err := newBackupSession(env.Config.BackupDirectory, time.Now())
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := backup.close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}()
+	for _, result := range results {
+		if err = writeInPlace(result.profileProperties, result.targets, backup); err != nil {
+			return err
+		}
+	}
+	return outputChangeReport(results, env.Config.OutputDirectory, env.Config.ReportFormat, env.Config.ShowSecrets, time.Now())
+}
+
+// migrationDocuments will read every document of a context that may be edited, grouped by profile and ranked for
+// that profile.  Only the profiles with a key to rename are returned.  A multi-document file can not be edited in
+// place, so one with a key to rename is skipped with a warning and the other files are still migrated
+func (env *Pruner) migrationDocuments(context string, tables [][]propertyRename) (map[string][]*migrationDocument, error) {
+	documents := make(map[string][]*migrationDocument)
+	renaming := make(map[string]bool)
+	skipped := make(map[string]bool)
+	for _, group := range []int8{classpathFileKey, externalFileKey, configServerFileKey} {
+		for _, source := range env.ConfigFiles[group] {
+			if source.ApplicationContext != context || isReadOnly(source) || skipped[source.Path] {
+				continue
+			}
+			properties, err := loadFromFile(source)
+			if err != nil {
+				return nil, err
+			}
+			renamed := hasRenamedKey(properties, tables)
+			all, err := readDocuments(source)
+			if err != nil {
+				return nil, err
+			}
+			if len(all) > 1 {
+				if renamed {
+					log.Errorf("Skipping %s: the keys of a multi-document file are not renamed", source.Path)
+					skipped[source.Path] = true
+				}
+				continue
+			}
+			renaming[source.Profile] = renaming[source.Profile] || renamed
+			documents[source.Profile] = append(documents[source.Profile], &migrationDocument{source: source, properties: properties,
+				rank: rankSource(source, group, []string{source.Profile}, env.Config.Precedence)})
+		}
+	}
+	for profile := range documents {
+		if !renaming[profile] {
+			delete(documents, profile)
+		}
+	}
+	return documents, nil
+}
+
+func hasRenamedKey(properties *propertySet, tables [][]propertyRename) bool {
+	for _, key := range properties.keys() {
+		p, _ := properties.get(key)
+		if _, renamed := renamedKey(p.name, tables); renamed {
+			return true
+		}
+	}
+	return false
+}
+
+// contextSources will return every document of a context, classpath first
+func (env *Pruner) contextSources(context string) []model.JavaConfigFileMetadata {
+	sources := make([]model.JavaConfigFileMetadata, 0)
+	for _, key := range []int8{classpathFileKey, externalFileKey, configServerFileKey} {
+		for _, fileMetadata := range env.ConfigFiles[key] {
+			if fileMetadata.ApplicationContext == context {
+				sources = append(sources, fileMetadata)
+			}
+		}
+	}
+	return sources
+}
+
+// renameTables will return the user's rename file, when one is set, followed by the built in renames of each release
+// in the requested range, oldest first.  A key is passed through every table in order so renames chain
+func (env *Pruner) renameTables() ([][]propertyRename, error) {
+	tables := make([][]propertyRename, 0)
+	if env.Config.RenameFile != "" {
+		renames, err := readRenameFile(env.Config.RenameFile)
+		if err != nil {
+			return nil, err
+		}
+		tables = append(tables, renames)
+	}
+	for _, version := range []string{env.Config.MigrateFrom, env.Config.MigrateTo} {
+		if _, err := parseVersion(version); err != nil {
+			return nil, err
+		}
+	}
+	for _, release := range builtinRenames {
+		if compareVersions(release.version, env.Config.MigrateFrom) <= 0 && env.Config.MigrateFrom != "" {
+			continue
+		}
+		if compareVersions(release.version, env.Config.MigrateTo) > 0 && env.Config.MigrateTo != "" {
+			continue
+		}
+		tables = append(tables, release.renames)
+	}
+	return tables, nil
+}
+
+// readRenameFile will read a yaml mapping of old names to new names, applied in the order they are written
+func readRenameFile(path string) ([]propertyRename, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read rename file %s: %v", path, err)
+	}
+	var mapping yaml.MapSlice
+	if err := yaml.Unmarshal(data, &mapping); err != nil {
+		return nil, fmt.Errorf("unable to read rename file %s: %v", path, err)
+	}
+	renames := make([]propertyRename, 0, len(mapping))
+	for _, item := range mapping {
+		rename := propertyRename{from: fmt.Sprint(item.Key), to: fmt.Sprint(item.Value)}
+		if strings.HasSuffix(rename.from, renameWildcard) != strings.HasSuffix(rename.to, renameWildcard) {
+			return nil, fmt.Errorf("rename file %s: %s and %s must both end with %s, or neither", path, rename.from, rename.to, renameWildcard)
+		}
+		renames = append(renames, rename)
+	}
+	return renames, nil
+}
+
+func parseVersion(version string) ([]int, error) {
+	parts := make([]int, 0)
+	if version == "" {
+		return parts, nil
+	}
+	for _, element := range strings.Split(version, ".") {
+		number, err := strconv.Atoi(element)
+		if err != nil {
+			return nil, fmt.Errorf("invalid spring boot version %q, expected a version such as 2.7", version)
+		}
+		parts = append(parts, number)
+	}
+	return parts, nil
+}
+
+// compareVersions will compare two valid dotted versions, treating missing elements as 0
+func compareVersions(a string, b string) int {
+	left, _ := parseVersion(a)
+	right, _ := parseVersion(b)
+	for i := 0; i < len(left) || i < len(right); i++ {
+		l, r := 0, 0
+		if i < len(left) {
+			l = left[i]
+		}
+		if i < len(right) {
+			r = right[i]
+		}
+		if l != r {
+			if l < r {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// apply will return the new name for a property, keeping the spelling of the elements below a renamed prefix.  A
+// name in the environment form, such as SPRING_REDIS_HOST, has no dots to keep, so its canonical elements are used
+func (rename propertyRename) apply(name string) (string, bool) {
+	canonical := canonicalName(name)
+	if !strings.HasSuffix(rename.from, renameWildcard) {
+		return rename.to, canonical == canonicalName(rename.from)
+	}
+	from := canonicalName(strings.TrimSuffix(rename.from, renameWildcard))
+	to := strings.TrimSuffix(rename.to, renameWildcard)
+	if canonical == from {
+		return to, true
+	}
+	if !isBelow(canonical, from) {
+		return "", false
+	}
+	if isEnvironmentForm(name) {
+		return to + canonical[len(from):], true
+	}
+	elements := len(strings.Split(from, "."))
+	parts := strings.SplitN(name, ".", elements+1)
+	if len(parts) > elements {
+		return to + "." + parts[elements], true
+	}
+	last := parts[len(parts)-1]
+	return to + last[strings.Index(last, "["):], true
+}
+
+// renamedKey will pass a name through each table, applying the first rename in a table that matches
+func renamedKey(name string, tables [][]propertyRename) (string, bool) {
+	renamed := false
+	for _, table := range tables {
+		for _, rename := range table {
+			if to, ok := rename.apply(name); ok {
+				if canonicalName(to) != canonicalName(name) {
+					name, renamed = to, true
+				}
+				break
+			}
+		}
+	}
+	return name, renamed
+}
+
+// migrationChanges will decide the edits and renames of the documents of one profile.  When several keys end up with
+// the same name, in one document or across them, they are merged by the precedence rules: the value from the document
+// ranked highest wins, and within a document the entry written last, as it would if the document repeated a key.
+// Each document holding one of those keys is left with a single key of the new name holding the winning value
+func migrationChanges(documents []*migrationDocument, tables [][]propertyRename) {
+	candidates := make(map[string][]migrationCandidate)
+	order := make([]string, 0)
+	for _, document := range documents {
+		document.edits = make(map[string]changeSet)
+		document.renames = make([]changeSet, 0)
+		for _, key := range document.properties.keys() {
+			p, _ := document.properties.get(key)
+			newName, renamed := renamedKey(p.name, tables)
+			if !renamed {
+				continue
+			}
+			target := canonicalName(newName)
+			if _, seen := candidates[target]; !seen {
+				order = append(order, target)
+			}
+			candidates[target] = append(candidates[target], migrationCandidate{document: document, property: p, newName: newName, renamed: true})
+		}
+	}
+	for _, target := range order {
+		for _, document := range documents {
+			if existing, ok := document.properties.get(target); ok {
+				candidates[target] = append(candidates[target], migrationCandidate{document: document, property: existing})
+			}
+		}
+	}
+	sort.Strings(order)
+
+	for _, target := range order {
+		winner := candidates[target][0]
+		for _, candidate := range candidates[target][1:] {
+			if winner.document.rank.less(candidate.document.rank) ||
+				(!candidate.document.rank.less(winner.document.rank) && candidate.property.line > winner.property.line) {
+				winner = candidate
+			}
+		}
+		for _, document := range documents {
+			existing, exists := document.properties.get(target)
+			if exists && !valuesEqual(existing.value, winner.property.value) {
+				document.edits[target] = changeSet{key: existing.name, newValue: winner.property.value}
+			}
+			// the last renamed key of a document without the new name is renamed in place, the others are deleted
+			var kept *migrationCandidate
+			for i, candidate := range candidates[target] {
+				if candidate.document == document && candidate.renamed && !exists && (kept == nil || candidate.property.line > kept.property.line) {
+					kept = &candidates[target][i]
+				}
+			}
+			for i, candidate := range candidates[target] {
+				if candidate.document != document || !candidate.renamed {
+					continue
+				}
+				p, source := candidate.property, document.source
+				change := changeSet{key: p.name, action: renameAction, renamedTo: candidate.newName, oldValue: p.value, newValue: winner.property.value,
+					profile: source.Profile, profiles: []string{source.Profile}, source: sourceLocation(p)}
+				change.message = fmt.Sprintf("renamed %s to %s", p.name, candidate.newName)
+				if len(candidates[target]) > 1 {
+					change.message = fmt.Sprintf("%s; %s is set more than once, keeping %v from %s", change.message, candidate.newName,
+						maskValue(candidate.newName, winner.property.value), sourceLocation(winner.property))
+				}
+				document.renames = append(document.renames, change)
+
+				edit := changeSet{key: p.name, delete: true}
+				if kept == &candidates[target][i] {
+					edit = changeSet{key: p.name, renamedTo: candidate.newName, newValue: winner.property.value}
+				}
+				document.edits[canonicalName(p.name)] = edit
+			}
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package cmd
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/gkontos/spiny-dogfish/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRenamedKey(t *testing.T) {
+	appCtx := &Pruner{}
+	appCtx.Config = &config.Application{}
+	tables, err := appCtx.renameTables()
+	assert.Nil(t, err)
+
+	for name, expected := range map[string]string{
+		"spring.redis.sentinel.masterName":     "spring.data.redis.sentinel.masterName",
+		"spring.redis":                         "spring.data.redis",
+		"management.context-path":              "management.server.base-path",
+		"SPRING_DATASOURCE_INITIALIZATIONMODE": "spring.sql.init.mode",
+		"security.user.role":                   "spring.security.user.roles",
+		"spring.redisson.file":                 "spring.redisson.file",
+		"SPRING_REDIS_HOST":                    "spring.data.redis.host",
+		"SPRING_REDIS_SENTINEL_NODES_0":        "spring.data.redis.sentinel.nodes[0]",
+	} {
+		renamed, _ := renamedKey(name, tables)
+		assert.Equal(t, expected, renamed, name)
+	}
+
+	appCtx.Config.MigrateFrom, appCtx.Config.MigrateTo = "2.0", "2.5"
+	tables, err = appCtx.renameTables()
+	assert.Nil(t, err)
+	renamed, _ := renamedKey("management.context-path", tables)
+	assert.Equal(t, "management.context-path", renamed, "the 2.0 rename is not applied when migrating from 2.0")
+	renamed, _ = renamedKey("spring.redis.host", tables)
+	assert.Equal(t, "spring.redis.host", renamed, "the 3.0 rename is not applied when migrating to 2.5")
+
+	appCtx.Config.MigrateTo = "latest"
+	_, err = appCtx.renameTables()
+	assert.NotNil(t, err)
+}
+
+func TestMigrateRenamesKeysInPlace(t *testing.T) {
+	appCtx, cleanup := newTestPruner(t, map[string]string{
+		"application.yml": "# datasource\n" +
+			"spring:\n" +
+			"  datasource:\n" +
+			"    url: jdbc:h2:mem\n" +
+			"    initialization-mode: always # seed the db\n" +
+			"  redis:\n" +
+			"    host: cache\n",
+		"application-dev.properties": "# dev\nserver.context-path=/dev\nname=dev\n",
+		"application-prod.yml":       "server:\n  servlet:\n    context-path: /new\n  context-path: /old\n",
+		"renames.yml":                "name: app.name\n",
+	})
+	defer cleanup()
+	appCtx.Config.BackupDirectory = filepath.Join(appCtx.Config.OutputDirectory, "backups")
+	appCtx.Config.RenameFile = filepath.Join(appCtx.Config.ProjectRoot, javaClasspathResourcePath, "renames.yml")
+
+	assert.Nil(t, appCtx.Migrate([]string{"application"}))
+
+	assertFileContent(t, appCtx, "application.yml", "# datasource\n"+
+		"spring:\n"+
+		"  datasource:\n"+
+		"    url: jdbc:h2:mem\n"+
+		"  sql:\n"+
+		"    init:\n"+
+		"      mode: always\n"+
+		"  data:\n"+
+		"    redis:\n"+
+		"      host: cache\n")
+	assertFileContent(t, appCtx, "application-dev.properties", "# dev\nserver.servlet.context-path=/dev\napp.name=dev\n")
+	assertFileContent(t, appCtx, "application-prod.yml", "server:\n  servlet:\n    context-path: /old\n")
+
+	data, err := ioutil.ReadFile(filepath.Join(appCtx.Config.OutputDirectory, "pruned-changes.json"))
+	assert.Nil(t, err)
+	report := changeReport{}
+	assert.Nil(t, json.Unmarshal(data, &report))
+	renamed := make(map[string]string)
+	for _, entry := range report.Changes {
+		assert.Equal(t, renameAction, entry.Action)
+		renamed[entry.Profile+" "+entry.Key] = entry.RenamedTo
+	}
+	assert.Equal(t, map[string]string{
+		"default spring.datasource.initialization-mode": "spring.sql.init.mode",
+		"default spring.redis.host":                     "spring.data.redis.host",
+		"dev name":                                      "app.name",
+		"dev server.context-path":                       "server.servlet.context-path",
+		"prod server.context-path":                      "server.servlet.context-path",
+	}, renamed)
+
+	assert.Nil(t, Rollback(appCtx.Config.BackupDirectory, ""))
+	assertFileContent(t, appCtx, "application-dev.properties", "# dev\nserver.context-path=/dev\nname=dev\n")
+}
+
+func TestMigrateMergesConflictsByPrecedence(t *testing.T) {
+	multiDocument := "spring:\n  redis:\n    host: base\n---\nspring:\n  config:\n    activate:\n      on-profile: qa\nname: qa\n"
+	appCtx, cleanup := newTestPruner(t, map[string]string{
+		"application.yml":            multiDocument,
+		"application-dev.yml":        "spring:\n  data:\n    redis:\n      host: low\n",
+		"config/application-dev.yml": "spring:\n  redis:\n    host: high\n",
+	})
+	defer cleanup()
+	appCtx.Config.BackupDirectory = filepath.Join(appCtx.Config.OutputDirectory, "backups")
+
+	assert.Nil(t, appCtx.Migrate([]string{"application"}), "a multi-document file does not stop the migration")
+
+	assertFileContent(t, appCtx, "application.yml", multiDocument)
+	assertFileContent(t, appCtx, "config/application-dev.yml", "spring:\n  data:\n    redis:\n      host: high\n")
+	assertFileContent(t, appCtx, "application-dev.yml", "spring:\n  data:\n    redis:\n      host: high\n")
+}
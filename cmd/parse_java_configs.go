@@ -0,0 +1,246 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+
+	"gopkg.in/yaml.v2"
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// logicalLine is a properties file entry after backslash line continuations have been joined
+type logicalLine struct {
+	text string
+	// start and end are the first and last physical lines (1 based) that make up the entry
+	start int
+	end   int
+}
+
+// parsePropertiesDocuments will read java properties syntax, keeping each key exactly as it was written.  A line
+// holding only #--- or !--- starts a new document, as it does for spring boot
+func parsePropertiesDocuments(data []byte, source string) ([]*propertySet, error) {
+	documents := []*propertySet{newPropertySet()}
+	for _, line := range readLogicalLines(string(data)) {
+		trimmed := strings.TrimLeft(line.text, " \t\f")
+		if isPropertiesDocumentSeparator(trimmed) {
+			documents = append(documents, newPropertySet())
+			continue
+		}
+		if trimmed == "" || trimmed[0] == '#' || trimmed[0] == '!' {
+			continue
+		}
+		key, value, err := splitPropertiesEntry(trimmed)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", source, line.start, err)
+		}
+		documents[len(documents)-1].set(property{name: key, value: value, source: source, line: line.start})
+	}
+	return documents, nil
+}
+
+func isPropertiesDocumentSeparator(line string) bool {
+	line = strings.TrimRight(line, " \t\f")
+	return line == "#---" || line == "!---"
+}
+
+// readLogicalLines will split properties file content into entries, joining lines that end in an odd number of backslashes
+func readLogicalLines(content string) []logicalLine {
+	physical := strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n")
+	lines := make([]logicalLine, 0, len(physical))
+	for i := 0; i < len(physical); i++ {
+		current := logicalLine{start: i + 1, end: i + 1}
+		text := physical[i]
+		trimmed := strings.TrimLeft(text, " \t\f")
+		isComment := len(trimmed) > 0 && (trimmed[0] == '#' || trimmed[0] == '!')
+		for !isComment && continues(text) && i+1 < len(physical) {
+			i++
+			text = text[:len(text)-1] + strings.TrimLeft(physical[i], " \t\f")
+			current.end = i + 1
+		}
+		current.text = text
+		lines = append(lines, current)
+	}
+	return lines
+}
+
+// continues reports whether a physical line ends in an unescaped backslash
+func continues(line string) bool {
+	count := 0
+	for i := len(line) - 1; i >= 0 && line[i] == '\\'; i-- {
+		count++
+	}
+	return count%2 == 1
+}
+
+// splitPropertiesEntry will separate the key from the value at the first unescaped '=', ':' or whitespace
+func splitPropertiesEntry(entry string) (string, string, error) {
+	keyEnd := len(entry)
+	for i := 0; i < len(entry); i++ {
+		if entry[i] == '\\' {
+			i++
+			continue
+		}
+		if entry[i] == '=' || entry[i] == ':' || entry[i] == ' ' || entry[i] == '\t' || entry[i] == '\f' {
+			keyEnd = i
+			break
+		}
+	}
+	rest := strings.TrimLeft(entry[keyEnd:], " \t\f")
+	if len(rest) > 0 && (rest[0] == '=' || rest[0] == ':') {
+		rest = strings.TrimLeft(rest[1:], " \t\f")
+	}
+	key, err := unescapeProperties(entry[:keyEnd])
+	if err != nil {
+		return "", "", err
+	}
+	value, err := unescapeProperties(rest)
+	if err != nil {
+		return "", "", err
+	}
+	return key, value, nil
+}
+
+// unescapeProperties will decode the backslash escapes allowed in java properties files
+func unescapeProperties(text string) (string, error) {
+	if !strings.Contains(text, "\\") {
+		return text, nil
+	}
+	var out strings.Builder
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		if c != '\\' || i+1 == len(text) {
+			out.WriteByte(c)
+			continue
+		}
+		i++
+		switch text[i] {
+		case 't':
+			out.WriteByte('\t')
+		case 'n':
+			out.WriteByte('\n')
+		case 'r':
+			out.WriteByte('\r')
+		case 'f':
+			out.WriteByte('\f')
+		case 'u':
+			if i+4 >= len(text) {
+				return "", fmt.Errorf("malformed \\u escape in %q", text)
+			}
+			r, err := strconv.ParseUint(text[i+1:i+5], 16, 32)
+			if err != nil {
+				return "", fmt.Errorf("malformed \\u escape in %q", text)
+			}
+			i += 4
+			// characters outside the basic plane are written as a surrogate pair of escapes
+			if utf16.IsSurrogate(rune(r)) && i+6 < len(text) && text[i+1:i+3] == "\\u" {
+				if low, err := strconv.ParseUint(text[i+3:i+7], 16, 32); err == nil {
+					if combined := utf16.DecodeRune(rune(r), rune(low)); combined != unicode.ReplacementChar {
+						out.WriteRune(combined)
+						i += 6
+						continue
+					}
+				}
+			}
+			out.WriteRune(rune(r))
+		default:
+			out.WriteByte(text[i])
+		}
+	}
+	return out.String(), nil
+}
+
+// parseYamlDocuments will flatten each document of a yaml stream, keeping each key exactly as it was written
+func parseYamlDocuments(data []byte, source string) ([]*propertySet, error) {
+	documents := make([]*propertySet, 0)
+	decoder := yamlv3.NewDecoder(bytes.NewReader(data))
+	for {
+		var document yamlv3.Node
+		if err := decoder.Decode(&document); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, fmt.Errorf("%s: %v", source, err)
+		}
+		properties := newPropertySet()
+		if len(document.Content) > 0 {
+			if err := flattenYamlNode(properties, "", document.Content[0], source); err != nil {
+				return nil, err
+			}
+		}
+		documents = append(documents, properties)
+	}
+	if len(documents) == 0 {
+		documents = append(documents, newPropertySet())
+	}
+	return documents, nil
+}
+
+func flattenYamlNode(properties *propertySet, prefix string, node *yamlv3.Node, source string) error {
+	if node.Kind == yamlv3.AliasNode {
+		node = node.Alias
+	}
+	if node.Kind == yamlv3.MappingNode {
+		if len(node.Content) == 0 && prefix != "" {
+			properties.set(property{name: prefix, value: nil, source: source, line: node.Line})
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			name := node.Content[i].Value
+			if prefix != "" {
+				name = prefix + "." + name
+			}
+			if err := flattenYamlNode(properties, name, node.Content[i+1], source); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if prefix == "" {
+		if node.Tag == "!!null" {
+			return nil
+		}
+		return fmt.Errorf("%s:%d: expected a mapping at the top of the document", source, node.Line)
+	}
+	value, err := yamlNodeValue(node)
+	if err != nil {
+		return fmt.Errorf("%s:%d: %v", source, node.Line, err)
+	}
+	properties.set(property{name: prefix, value: value, source: source, line: node.Line})
+	return nil
+}
+
+// yamlNodeValue will convert a scalar or sequence node into a property value.  Sequences become lists and any
+// mappings within them keep their key order and spelling
+func yamlNodeValue(node *yamlv3.Node) (interface{}, error) {
+	switch node.Kind {
+	case yamlv3.AliasNode:
+		return yamlNodeValue(node.Alias)
+	case yamlv3.SequenceNode:
+		list := make([]interface{}, 0, len(node.Content))
+		for _, child := range node.Content {
+			value, err := yamlNodeValue(child)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, value)
+		}
+		return list, nil
+	case yamlv3.MappingNode:
+		tree := yaml.MapSlice{}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			value, err := yamlNodeValue(node.Content[i+1])
+			if err != nil {
+				return nil, err
+			}
+			tree = append(tree, yaml.MapItem{Key: node.Content[i].Value, Value: value})
+		}
+		return tree, nil
+	}
+	var value interface{}
+	err := node.Decode(&value)
+	return value, err
+}
@@ -0,0 +1,217 @@
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	placeholderPrefix = "${"
+	placeholderSuffix = "}"
+
+	// RawComparison compares property values as they are written
+	RawComparison = "raw"
+	// ResolvedComparison compares property values after their ${...} placeholders are resolved
+	ResolvedComparison = "resolved"
+)
+
+var comparisonModes = []string{RawComparison, ResolvedComparison}
+
+// environmentLookup finds a value outside of the configuration files, such as an environment variable
+type environmentLookup func(name string) (string, bool)
+
+// placeholderProblem is a reference that could not be resolved; the value keeps the placeholder as it was written
+type placeholderProblem struct {
+	property property
+	// reference is the placeholder name that failed
+	reference string
+	reason    string
+}
+
+func (problem placeholderProblem) String() string {
+	return fmt.Sprintf("%s in %s: %s %s", problem.property.name, sourceLocation(problem.property), problem.reference, problem.reason)
+}
+
+// placeholderResolver evaluates ${name} and ${name:default} references against the environment and then a merged
+// property set, as the environment outranks the config files in spring
+type placeholderResolver struct {
+	properties  *propertySet
+	environment environmentLookup
+	problems    []placeholderProblem
+}
+
+// resolvePlaceholders will return a copy of the properties with every placeholder resolved, along with each
+// reference that was circular or could not be found
+func resolvePlaceholders(properties *propertySet, environment environmentLookup) (*propertySet, []placeholderProblem) {
+	resolver := &placeholderResolver{properties: properties, environment: environment, problems: make([]placeholderProblem, 0)}
+	resolved := newPropertySet()
+	for _, key := range properties.keys() {
+		p, _ := properties.get(key)
+		p.value = resolver.resolveValue(p, p.value, []string{key})
+		resolved.set(p)
+	}
+	return resolved, resolver.problems
+}
+
+// resolveValue will resolve every string within a value, including the elements of lists and nested maps
+func (r *placeholderResolver) resolveValue(owner property, value interface{}, chain []string) interface{} {
+	switch v := value.(type) {
+	case string:
+		return r.resolveString(owner, v, chain)
+	case []interface{}:
+		resolved := make([]interface{}, len(v))
+		for i, element := range v {
+			resolved[i] = r.resolveValue(owner, element, chain)
+		}
+		return resolved
+	case yaml.MapSlice:
+		resolved := make(yaml.MapSlice, len(v))
+		for i, item := range v {
+			resolved[i] = yaml.MapItem{Key: item.Key, Value: r.resolveValue(owner, item.Value, chain)}
+		}
+		return resolved
+	}
+	return value
+}
+
+// resolveString will replace each placeholder in text.  chain holds the canonical names being resolved so that a
+// reference back to any of them is reported as circular rather than followed forever
+func (r *placeholderResolver) resolveString(owner property, text string, chain []string) string {
+	var out strings.Builder
+	for {
+		start := strings.Index(text, placeholderPrefix)
+		if start < 0 {
+			out.WriteString(text)
+			return out.String()
+		}
+		end := placeholderEnd(text, start)
+		if end < 0 {
+			out.WriteString(text)
+			return out.String()
+		}
+		out.WriteString(text[:start])
+		out.WriteString(r.resolvePlaceholder(owner, text[start:end+1], chain))
+		text = text[end+1:]
+	}
+}
+
+// resolvePlaceholder will resolve a single ${name:default} placeholder.  The name and the default may hold
+// placeholders of their own
+func (r *placeholderResolver) resolvePlaceholder(owner property, placeholder string, chain []string) string {
+	body := placeholder[len(placeholderPrefix) : len(placeholder)-len(placeholderSuffix)]
+	name, defaultValue, hasDefault := splitPlaceholder(body)
+	name = r.resolveString(owner, name, chain)
+
+	canonical := canonicalName(name)
+	for _, resolving := range chain {
+		if resolving == canonical {
+			r.problems = append(r.problems, placeholderProblem{property: owner, reference: placeholder,
+				reason: fmt.Sprintf("is a circular reference (%s -> %s)", strings.Join(chain, " -> "), canonical)})
+			return placeholder
+		}
+	}
+	if value, ok := r.environment(name); ok {
+		return value
+	}
+	if value, ok := lookupProperty(r.properties, name); ok && !isContainer(value) {
+		return r.resolveString(owner, propertiesValue(value), append(append([]string{}, chain...), canonical))
+	}
+	if hasDefault {
+		return r.resolveString(owner, defaultValue, chain)
+	}
+	r.problems = append(r.problems, placeholderProblem{property: owner, reference: placeholder, reason: "is not set"})
+	return placeholder
+}
+
+// placeholderEnd will find the } closing the placeholder that opens at start, skipping over nested placeholders
+func placeholderEnd(text string, start int) int {
+	depth := 0
+	for i := start; i < len(text); i++ {
+		switch {
+		case strings.HasPrefix(text[i:], placeholderPrefix):
+			depth++
+			i++
+		case text[i] == '}':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// splitPlaceholder will separate the name from the default at the first : that is not inside a nested placeholder
+func splitPlaceholder(body string) (string, string, bool) {
+	depth := 0
+	for i := 0; i < len(body); i++ {
+		switch {
+		case strings.HasPrefix(body[i:], placeholderPrefix):
+			depth++
+			i++
+		case body[i] == '}':
+			depth--
+		case body[i] == ':' && depth == 0:
+			return body[:i], body[i+1:], true
+		}
+	}
+	return body, "", false
+}
+
+// lookupProperty will find a property by name, including a single element of a list such as servers[0].host
+func lookupProperty(properties *propertySet, name string) (interface{}, bool) {
+	if p, ok := properties.get(name); ok {
+		return p.value, true
+	}
+	parts := indexedNameRegex.FindStringSubmatch(name)
+	if parts == nil {
+		return nil, false
+	}
+	p, ok := properties.get(parts[1])
+	if !ok {
+		return nil, false
+	}
+	return valueAtPath(p.value, parts[2])
+}
+
+// valueAtPath will walk a path such as [0].host through nested lists and maps
+func valueAtPath(value interface{}, path string) (interface{}, bool) {
+	if path == "" {
+		return value, true
+	}
+	if path[0] == '[' {
+		end := strings.Index(path, "]")
+		index, err := strconv.Atoi(path[1:end])
+		list, ok := value.([]interface{})
+		if err != nil || !ok || index >= len(list) {
+			return nil, false
+		}
+		return valueAtPath(list[index], path[end+1:])
+	}
+	path = strings.TrimPrefix(path, ".")
+	end := strings.IndexAny(path, ".[")
+	if end < 0 {
+		end = len(path)
+	}
+	tree, ok := value.(yaml.MapSlice)
+	if !ok {
+		return nil, false
+	}
+	for _, item := range tree {
+		if canonicalElement(fmt.Sprint(item.Key)) == canonicalElement(path[:end]) {
+			return valueAtPath(item.Value, path[end:])
+		}
+	}
+	return nil, false
+}
+
+func isContainer(value interface{}) bool {
+	switch value.(type) {
+	case []interface{}, yaml.MapSlice:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,145 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testEnvironment(values map[string]string) environmentLookup {
+	layer := newPropertySet()
+	for name, value := range values {
+		layer.set(environmentProperty(name, value, "the test", 0))
+	}
+	return layeredEnvironment([]*propertySet{layer})
+}
+
+func TestResolvePlaceholders(t *testing.T) {
+	properties := parseYamlDocument(t, []byte(
+		"db:\n"+
+			"  host: localhost\n"+
+			"  name: app\n"+
+			"url: jdbc:postgresql://${db.host}:${db.port:5432}/${db.name}\n"+
+			"nested: ${missing.key:${db.host}}\n"+
+			"indirect: ${${selector}}\n"+
+			"selector: db.name\n"+
+			"servers:\n"+
+			"- ${db.host}\n"+
+			"first: ${servers[0]}\n"+
+			"user: ${APP_USER}\n"+
+			"port: 8080\n"), "application.yml")
+
+	resolved, problems := resolvePlaceholders(properties, testEnvironment(map[string]string{"APP_USER": "admin"}))
+	assert.Empty(t, problems)
+	expected := map[string]interface{}{
+		"url":      "jdbc:postgresql://localhost:5432/app",
+		"nested":   "localhost",
+		"indirect": "app",
+		"servers":  []interface{}{"localhost"},
+		"first":    "localhost",
+		"user":     "admin",
+		"port":     8080,
+	}
+	for key, value := range expected {
+		p, ok := resolved.get(key)
+		assert.True(t, ok, key)
+		assert.EqualValues(t, value, p.value, key)
+	}
+	raw, _ := properties.get("url")
+	assert.EqualValues(t, "jdbc:postgresql://${db.host}:${db.port:5432}/${db.name}", raw.value, "resolving does not change the original set")
+}
+
+func TestResolvePlaceholdersPrefersEnvironment(t *testing.T) {
+	properties := parseYamlDocument(t, []byte(
+		"db:\n"+
+			"  host: localhost\n"+
+			"url: jdbc:postgresql://${db.host}/app\n"), "application.yml")
+
+	resolved, problems := resolvePlaceholders(properties, testEnvironment(map[string]string{"DB_HOST": "db.internal"}))
+	assert.Empty(t, problems)
+	p, ok := resolved.get("url")
+	assert.True(t, ok)
+	assert.EqualValues(t, "jdbc:postgresql://db.internal/app", p.value, "the environment outranks the configuration files")
+}
+
+func TestResolvePlaceholdersReportsProblems(t *testing.T) {
+	properties := parseYamlDocument(t, []byte(
+		"a: ${b}\n"+
+			"b: x${a}\n"+
+			"self: ${self}\n"+
+			"unset: before ${not.there} after\n"), "application.yml")
+
+	resolved, problems := resolvePlaceholders(properties, testEnvironment(nil))
+	messages := make([]string, 0)
+	for _, problem := range problems {
+		messages = append(messages, problem.String())
+	}
+	assert.EqualValues(t, []string{
+		"a in application.yml:1: ${a} is a circular reference (a -> b -> a)",
+		"b in application.yml:2: ${b} is a circular reference (b -> a -> b)",
+		"self in application.yml:3: ${self} is a circular reference (self -> self)",
+		"unset in application.yml:4: ${not.there} is not set",
+	}, messages)
+	unset, _ := resolved.get("unset")
+	assert.EqualValues(t, "before ${not.there} after", unset.value)
+}
+
+func TestPruneComparesResolvedValues(t *testing.T) {
+	files := map[string]string{
+		"application.yml":      "host: localhost\n",
+		"application-dev.yml":  "url: http://${host}/api\n",
+		"application-prod.yml": "url: http://localhost/api\n",
+	}
+	appCtx, cleanup := newTestPruner(t, files)
+	defer cleanup()
+
+	_, changes, err := appCtx.intersectProfileAndContext([]string{"dev", "prod"}, "application")
+	assert.Nil(t, err)
+	assert.EqualValues(t, conflictAction, changeFor(changes, "url", defaultProfileKey).action, "raw values differ")
+
+	appCtx.Config.Compare = ResolvedComparison
+	_, changes, err = appCtx.intersectProfileAndContext([]string{"dev", "prod"}, "application")
+	assert.Nil(t, err)
+	hoist := changeFor(changes, "url", defaultProfileKey)
+	assert.EqualValues(t, hoistToDefaultAction, hoist.action)
+	assert.EqualValues(t, "http://localhost/api", hoist.newValue)
+	assert.EqualValues(t, "http://${host}/api", changeFor(changes, "url", "dev").oldValue)
+}
+
+func TestPruneIgnoresProcessEnvironment(t *testing.T) {
+	appCtx, cleanup := newTestPruner(t, map[string]string{
+		"application.yml":      "name: base\n",
+		"application-dev.yml":  "url: http://${SPINY_TEST_HOST:dev}/api\n",
+		"application-prod.yml": "url: http://${SPINY_TEST_HOST:prod}/api\n",
+	})
+	defer cleanup()
+	os.Setenv("SPINY_TEST_HOST", "shell")
+	defer os.Unsetenv("SPINY_TEST_HOST")
+	appCtx.Config.Compare = ResolvedComparison
+	appCtx.Config.ProcessEnvironment = true
+
+	_, changes, err := appCtx.intersectProfileAndContext([]string{"dev", "prod"}, "application")
+	assert.Nil(t, err)
+	assert.EqualValues(t, conflictAction, changeFor(changes, "url", defaultProfileKey).action, "the shell running the prune does not decide it")
+
+	envFile := filepath.Join(appCtx.Config.ProjectRoot, "test.env")
+	assert.Nil(t, ioutil.WriteFile(envFile, []byte("SPINY_TEST_HOST=configured\n"), 0644))
+	appCtx.Config.EnvironmentFiles = []string{envFile}
+	_, changes, err = appCtx.intersectProfileAndContext([]string{"dev", "prod"}, "application")
+	assert.Nil(t, err)
+	hoist := changeFor(changes, "url", defaultProfileKey)
+	assert.EqualValues(t, hoistToDefaultAction, hoist.action, "a configured environment file is used")
+	assert.EqualValues(t, "http://configured/api", hoist.newValue)
+}
+
+func changeFor(changes []changeSet, key string, profile string) changeSet {
+	for _, change := range changes {
+		if change.key == key && change.profile == profile {
+			return change
+		}
+	}
+	return changeSet{}
+}
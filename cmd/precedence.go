@@ -0,0 +1,167 @@
+package cmd
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/gkontos/spiny-dogfish/model"
+)
+
+const (
+	// CurrentPrecedence is the config data ordering used by spring boot 2.4 and later
+	CurrentPrecedence = "current"
+	// LegacyPrecedence is the ordering used by spring boot 2.3 and earlier
+	LegacyPrecedence = "legacy"
+)
+
+var precedenceModels = []string{CurrentPrecedence, LegacyPrecedence}
+
+// Spring boot searches these locations, listed from lowest to highest precedence.  The classpath locations are
+// relative to src/main/resources and the file locations are relative to the external configuration directory.
+//
+//	classpath:/              classpathRootLocation
+//	classpath:/config/       classpathConfigLocation
+//	file:./                  fileRootLocation
+//	file:./config/           fileConfigLocation
+//	file:./config/*/         fileConfigSubdirectoryLocation
+//
+// Files the scan finds anywhere else are not read by spring; they are ranked with the root of their directory so
+// they still take part in the merge.
+const (
+	classpathRootLocation = iota
+	classpathConfigLocation
+	fileRootLocation
+	fileConfigLocation
+	fileConfigSubdirectoryLocation
+)
+
+// precedenceRank orders a single config document.  Ranks are compared field by field and a source with a higher
+// rank overrides one with a lower rank
+type precedenceRank []int
+
+// searchLocation will map a config file onto the spring boot location it would be loaded from
+func searchLocation(group int8, location string) int {
+	if group == classpathFileKey {
+		if location == "config" {
+			return classpathConfigLocation
+		}
+		return classpathRootLocation
+	}
+	if location == "config" {
+		return fileConfigLocation
+	}
+	if strings.HasPrefix(location, "config/") && !strings.Contains(strings.TrimPrefix(location, "config/"), "/") {
+		return fileConfigSubdirectoryLocation
+	}
+	return fileRootLocation
+}
+
+// isProfileSpecificFile reports whether the file name itself names a profile, ie application-dev.yml.  A gated
+// document inside application.yml is not profile specific by name
+func isProfileSpecificFile(file model.JavaConfigFileMetadata) bool {
+	baseName := strings.TrimSuffix(filepath.Base(file.Path), filepath.Ext(file.Path))
+	return strings.Contains(baseName, "-")
+}
+
+// rankSource will rank a config document for the active profiles.
+//
+// Spring boot 2.4 and later (current) applies, from lowest to highest precedence:
+//  1. files packaged on the classpath, then files outside of the jar
+//  2. within each of those, application.yml before application-{profile}.yml
+//  3. the search locations in the order listed above, so config/ overrides the root
+//  4. for profile specific files, the profiles in the order they were activated; the last profile wins
+//  5. at the same location .properties overrides .yml, which overrides .yaml
+//  6. later documents in a multi-document file override earlier ones
+//
+// Spring boot 2.3 and earlier (legacy) loads all non profile files before any profile specific source, and gated
+// documents count as profile specific.  The last profile wins over every location, then classpath before file and
+// the search locations apply as above.
+//
+// Files from a config server override every file of the project under either model.  Among themselves the config
+// server's own order applies: profile specific files and gated documents over the rest, the last profile winning,
+// then {application} files over the shared application files.
+func rankSource(file model.JavaConfigFileMetadata, group int8, profiles []string, precedenceModel string) precedenceRank {
+	profileIndex := 0
+	for i, profile := range profiles {
+		if profile == file.Profile {
+			profileIndex = i + 1
+		}
+	}
+	// spring tries .properties, then .yml, then .yaml and the first extension found wins
+	extension := 0
+	switch file.ConfigurationType {
+	case "properties":
+		extension = 2
+	case "yml":
+		extension = 1
+	}
+	if group == configServerFileKey {
+		// the group leads so these ranks sort after the legacy ranks too, whose first field is at most 1
+		profileSpecific := boolRank(file.Profile != defaultProfileKey)
+		return precedenceRank{int(group), profileSpecific, profileIndex, boolRank(file.Application != ""), extension, file.Document}
+	}
+	location := searchLocation(group, file.Location)
+	if precedenceModel == LegacyPrecedence {
+		profileSpecific := boolRank(file.Profile != defaultProfileKey)
+		return precedenceRank{profileSpecific, profileIndex, int(group), location, extension, file.Document}
+	}
+	profileSpecific := boolRank(isProfileSpecificFile(file))
+	if profileSpecific == 0 {
+		// a gated document keeps the position of its file; only the document order separates it from its neighbours
+		profileIndex = 0
+	}
+	return precedenceRank{int(group), profileSpecific, location, profileIndex, extension, file.Document}
+}
+
+func boolRank(value bool) int {
+	if value {
+		return 1
+	}
+	return 0
+}
+
+func (rank precedenceRank) less(other precedenceRank) bool {
+	for i := range rank {
+		if rank[i] != other[i] {
+			return rank[i] < other[i]
+		}
+	}
+	return false
+}
+
+// orderSources will select the documents for a context that apply to the active profiles and return them from
+// lowest to highest precedence.  Documents that are not profile specific always apply
+func orderSources(configFiles map[int8][]model.JavaConfigFileMetadata, profiles []string, context string, precedenceModel string) []model.JavaConfigFileMetadata {
+	type rankedSource struct {
+		file model.JavaConfigFileMetadata
+		rank precedenceRank
+	}
+	ranked := make([]rankedSource, 0)
+	for group, files := range configFiles {
+		for _, file := range files {
+			if file.ApplicationContext != context {
+				continue
+			}
+			if _, active := Find(profiles, file.Profile); file.Profile != defaultProfileKey && !active {
+				continue
+			}
+			ranked = append(ranked, rankedSource{file: file, rank: rankSource(file, group, profiles, precedenceModel)})
+		}
+	}
+	sort.SliceStable(ranked, func(i, j int) bool {
+		if ranked[i].rank.less(ranked[j].rank) {
+			return true
+		}
+		if ranked[j].rank.less(ranked[i].rank) {
+			return false
+		}
+		// sources with an equal rank (files outside the standard locations) are ordered by path so runs are repeatable
+		return ranked[i].file.Path < ranked[j].file.Path
+	})
+	ordered := make([]model.JavaConfigFileMetadata, 0, len(ranked))
+	for _, source := range ranked {
+		ordered = append(ordered, source.file)
+	}
+	return ordered
+}
@@ -0,0 +1,114 @@
+package cmd
+
+import (
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/gkontos/spiny-dogfish/model"
+	"github.com/stretchr/testify/assert"
+)
+
+// testSource describes a config document as group:location/file.ext#document, ie classpath:config/application-dev.yml
+func testSource(description string) (int8, model.JavaConfigFileMetadata) {
+	group := int8(classpathFileKey)
+	if strings.HasPrefix(description, "file:") {
+		group = externalFileKey
+	}
+	description = description[strings.Index(description, ":")+1:]
+	document := 0
+	profile := ""
+	if i := strings.Index(description, "#"); i >= 0 {
+		document = int(description[i+1] - '0')
+		if strings.Contains(description[i:], "@") {
+			profile = description[strings.Index(description, "@")+1:]
+		}
+		description = description[:i]
+	}
+	location, fileName := path.Split(description)
+	configFile, _ := configFileMetadata(strings.TrimSuffix(location, "/"), fileName)
+	configFile.Location = strings.TrimSuffix(location, "/")
+	configFile.Path = description
+	configFile.Document = document
+	if profile != "" {
+		configFile.Profile = profile
+	}
+	return group, configFile
+}
+
+func TestPrecedenceMatrix(t *testing.T) {
+	cases := []struct {
+		rule     string
+		model    string
+		profiles []string
+		// expected lists sources from lowest to highest precedence
+		expected []string
+	}{
+		{"classpath config/ overrides the classpath root", CurrentPrecedence, []string{defaultProfileKey},
+			[]string{"classpath:application.yml", "classpath:config/application.yml"}},
+		{"file ./ overrides the classpath", CurrentPrecedence, []string{defaultProfileKey},
+			[]string{"classpath:config/application.yml", "file:application.yml"}},
+		{"file ./config/ overrides file ./", CurrentPrecedence, []string{defaultProfileKey},
+			[]string{"file:application.yml", "file:config/application.yml"}},
+		{"file ./config/*/ overrides file ./config/", CurrentPrecedence, []string{defaultProfileKey},
+			[]string{"file:config/application.yml", "file:config/service/application.yml"}},
+		{"profile files override non profile files in the same group", CurrentPrecedence, []string{"dev"},
+			[]string{"classpath:config/application.yml", "classpath:application-dev.yml"}},
+		{"external non profile files override packaged profile files", CurrentPrecedence, []string{"dev"},
+			[]string{"classpath:config/application-dev.yml", "file:application.yml"}},
+		{"last profile wins", CurrentPrecedence, []string{"dev", "cloud"},
+			[]string{"classpath:application-dev.yml", "classpath:application-cloud.yml"}},
+		{"location is considered before the profile order", CurrentPrecedence, []string{"dev", "cloud"},
+			[]string{"classpath:application-cloud.yml", "classpath:config/application-dev.yml"}},
+		{"properties override yaml in the same location", CurrentPrecedence, []string{defaultProfileKey},
+			[]string{"classpath:application.yaml", "classpath:application.yml", "classpath:application.properties"}},
+		{"yaml in a higher location overrides properties", CurrentPrecedence, []string{defaultProfileKey},
+			[]string{"classpath:application.properties", "classpath:config/application.yml"}},
+		{"later documents override earlier documents", CurrentPrecedence, []string{"dev"},
+			[]string{"classpath:application.yml#0", "classpath:application.yml#1@dev", "classpath:application.yml#2"}},
+		{"gated documents keep the position of their file", CurrentPrecedence, []string{"dev"},
+			[]string{"classpath:application.yml#1@dev", "classpath:config/application.yml", "classpath:application-dev.yml"}},
+		{"inactive profiles are not loaded", CurrentPrecedence, []string{"dev"},
+			[]string{"classpath:application.yml", "classpath:application-dev.yml"}},
+		{"legacy: profile files override every non profile file", LegacyPrecedence, []string{"dev"},
+			[]string{"file:config/application.yml", "classpath:application-dev.yml"}},
+		{"legacy: external profile files override packaged profile files", LegacyPrecedence, []string{"dev"},
+			[]string{"classpath:config/application-dev.yml", "file:application-dev.yml"}},
+		{"legacy: last profile wins over every location", LegacyPrecedence, []string{"dev", "cloud"},
+			[]string{"file:config/application-dev.yml", "classpath:application-cloud.yml"}},
+		{"legacy: gated documents are profile specific", LegacyPrecedence, []string{"dev"},
+			[]string{"file:config/application.yml", "classpath:application.yml#1@dev"}},
+	}
+	for _, c := range cases {
+		configFiles := make(map[int8][]model.JavaConfigFileMetadata)
+		// add the sources in reverse so the expected order has to come from the ranking
+		for i := len(c.expected) - 1; i >= 0; i-- {
+			group, file := testSource(c.expected[i])
+			configFiles[group] = append(configFiles[group], file)
+		}
+		if c.rule == "inactive profiles are not loaded" {
+			group, file := testSource("file:application-prod.yml")
+			configFiles[group] = append(configFiles[group], file)
+		}
+		ordered := orderSources(configFiles, c.profiles, "application", c.model)
+		actual := make([]string, 0, len(ordered))
+		for _, file := range ordered {
+			actual = append(actual, file.Path)
+		}
+		expected := make([]string, 0, len(c.expected))
+		for _, description := range c.expected {
+			_, file := testSource(description)
+			expected = append(expected, file.Path)
+		}
+		assert.EqualValues(t, expected, actual, c.rule)
+	}
+}
+
+func TestSearchLocation(t *testing.T) {
+	assert.EqualValues(t, classpathRootLocation, searchLocation(classpathFileKey, ""))
+	assert.EqualValues(t, classpathConfigLocation, searchLocation(classpathFileKey, "config"))
+	assert.EqualValues(t, fileRootLocation, searchLocation(externalFileKey, ""))
+	assert.EqualValues(t, fileConfigLocation, searchLocation(externalFileKey, "config"))
+	assert.EqualValues(t, fileConfigSubdirectoryLocation, searchLocation(externalFileKey, "config/service"))
+	assert.EqualValues(t, fileRootLocation, searchLocation(externalFileKey, "config/service/nested"))
+}
@@ -0,0 +1,108 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	log "github.com/gkontos/bivalve-chronicles"
+
+	"github.com/gkontos/spiny-dogfish/model"
+)
+
+const (
+	activateOnProfileKey = "spring.config.activate.on-profile"
+	// legacyProfilesKey is the pre spring boot 2.4 way of gating a document on a profile
+	legacyProfilesKey = "spring.profiles"
+)
+
+// readDocuments will parse every document of a configuration file
+func readDocuments(fileMetadata model.JavaConfigFileMetadata) ([]*propertySet, error) {
+	var (
+		data []byte
+		err  error
+	)
+	if isReadOnly(fileMetadata) {
+		data, err = readArchiveEntry(fileMetadata.Path)
+	} else {
+		data, err = ioutil.ReadFile(fileMetadata.Path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("fatal error config file %s: %s ", fileMetadata.Path, err)
+	}
+	if fileMetadata.ConfigurationType == "properties" {
+		return parsePropertiesDocuments(data, fileMetadata.Path)
+	}
+	return parseYamlDocuments(data, fileMetadata.Path)
+}
+
+// activationProfiles will return the profiles a document is gated on, removing the activation keys from the
+// document.  A document without activation keys returns no profiles
+func activationProfiles(document *propertySet) ([]string, error) {
+	profiles := make([]string, 0)
+	for _, key := range []string{activateOnProfileKey, legacyProfilesKey} {
+		p, ok := document.get(key)
+		if !ok {
+			continue
+		}
+		document.remove(key)
+		values := []interface{}{p.value}
+		if list, isList := p.value.([]interface{}); isList {
+			values = list
+		}
+		for _, value := range values {
+			for _, profile := range strings.Split(fmt.Sprint(value), ",") {
+				profile = strings.TrimSpace(profile)
+				if strings.ContainsAny(profile, "!&|()") {
+					return nil, fmt.Errorf("profile expression %q in %s:%d is not supported", profile, p.source, p.line)
+				}
+				if profile != "" {
+					profiles = append(profiles, profile)
+				}
+			}
+		}
+	}
+	return profiles, nil
+}
+
+// expandDocuments will split multi-document files into one entry per document and activating profile, so a
+// document gated on spring.config.activate.on-profile is treated as a profile specific source
+func expandDocuments(files []model.JavaConfigFileMetadata) []model.JavaConfigFileMetadata {
+	expanded := make([]model.JavaConfigFileMetadata, 0, len(files))
+	for _, file := range files {
+		documents, err := readDocuments(file)
+		if err != nil {
+			log.Errorf("Unable to read %s: %v", file.Path, err)
+			expanded = append(expanded, file)
+			continue
+		}
+		for i, document := range documents {
+			profiles, err := activationProfiles(document)
+			if err != nil {
+				log.Errorf("Skipping document %d of %s: %v", i+1, file.Path, err)
+				continue
+			}
+			if len(profiles) == 0 {
+				if i > 0 && document.len() == 0 {
+					continue
+				}
+				source := file
+				source.Document = i
+				expanded = append(expanded, source)
+				continue
+			}
+			for _, profile := range profiles {
+				if file.Profile != defaultProfileKey && profile != file.Profile {
+					log.Errorf("Skipping document %d of %s: it is only active when both %s and %s are active", i+1, file.Path, file.Profile, profile)
+					continue
+				}
+				source := file
+				source.Document = i
+				source.Profile = profile
+				log.Infof("found %s document %d for profile %s", file.Path, i+1, profile)
+				expanded = append(expanded, source)
+			}
+		}
+	}
+	return expanded
+}
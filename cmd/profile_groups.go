@@ -0,0 +1,149 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	log "github.com/gkontos/bivalve-chronicles"
+)
+
+const (
+	// includeProfilesKey activates more profiles along with the active ones
+	includeProfilesKey = "spring.profiles.include"
+	// profileGroupKey is the prefix of spring.profiles.group.<name>, the profiles activated along with <name>
+	profileGroupKey = "spring.profiles.group"
+)
+
+// profileDeclarations are the profiles the files of a context include and the groups they declare
+type profileDeclarations struct {
+	include []string
+	groups  map[string][]string
+	// profileIncludes holds the includes of each profile's own documents, which only legacy precedence reads
+	profileIncludes map[string][]string
+}
+
+// activeProfiles will expand the requested profiles (or comma separated list of profiles) the way spring boot
+// activates them.  The profiles included by the default documents come first, followed by the requested profiles,
+// so a requested profile wins over an included one.  Each profile is then followed by the members of its group, and
+// theirs in turn, depth first.  Legacy precedence has no groups, and instead follows each profile with the profiles
+// its own documents include.  A profile is only activated once, and a group or include that leads back to a profile
+// that is being expanded is an error.  The default profile is returned when nothing else is active
+func (appCtx *Pruner) activeProfiles(profile string, context string) ([]string, error) {
+	declarations, err := appCtx.profileDeclarations(context)
+	if err != nil {
+		return nil, err
+	}
+	requested := append([]string{}, declarations.include...)
+	for _, name := range splitProfileList(profile) {
+		if name != "" && name != defaultProfileKey {
+			requested = append(requested, name)
+		}
+	}
+	children := declarations.groups
+	if appCtx.Config.Precedence == LegacyPrecedence {
+		children = declarations.profileIncludes
+	}
+	active, err := expandProfiles(requested, children)
+	if err != nil {
+		return nil, err
+	}
+	if len(active) == 0 {
+		return []string{defaultProfileKey}, nil
+	}
+	log.Debugf("profiles %s activate %s in %s", profile, strings.Join(active, ", "), context)
+	return active, nil
+}
+
+// expandProfiles will follow each profile with its children, depth first, keeping the first activation of a profile
+func expandProfiles(profiles []string, children map[string][]string) ([]string, error) {
+	expanded := make([]string, 0)
+	activated := make(map[string]bool)
+	var visit func(profile string, path []string) error
+	visit = func(profile string, path []string) error {
+		for i, ancestor := range path {
+			if ancestor == profile {
+				cycle := append(append([]string{}, path[i:]...), profile)
+				return fmt.Errorf("profile cycle: %s", strings.Join(cycle, " -> "))
+			}
+		}
+		if activated[profile] {
+			return nil
+		}
+		activated[profile] = true
+		expanded = append(expanded, profile)
+		path = append(append([]string{}, path...), profile)
+		for _, child := range children[profile] {
+			if err := visit(child, path); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for _, profile := range profiles {
+		if err := visit(profile, nil); err != nil {
+			return nil, err
+		}
+	}
+	return expanded, nil
+}
+
+// profileDeclarations will read spring.profiles.include and spring.profiles.group.* from the merged default
+// documents of a context.  Spring boot 2.4 and later rejects both in a profile specific document, so
+// spring.profiles.include is only read from the documents of each profile with legacy precedence
+func (appCtx *Pruner) profileDeclarations(context string) (profileDeclarations, error) {
+	declarations := profileDeclarations{groups: make(map[string][]string), profileIncludes: make(map[string][]string)}
+	defaults, err := loadSources(orderSources(appCtx.ConfigFiles, []string{defaultProfileKey}, context, appCtx.Config.Precedence))
+	if err != nil {
+		return declarations, err
+	}
+	if p, ok := defaults.get(includeProfilesKey); ok {
+		declarations.include = profileNames(p.value)
+	}
+	for _, key := range defaults.keys() {
+		if !isBelow(key, profileGroupKey) {
+			continue
+		}
+		p, _ := defaults.get(key)
+		elements := strings.SplitN(p.name, ".", 4)
+		declarations.groups[elements[len(elements)-1]] = profileNames(p.value)
+	}
+
+	if appCtx.Config.Precedence != LegacyPrecedence {
+		return declarations, nil
+	}
+	for _, profile := range uniqueProfiles(appCtx.ConfigFiles) {
+		if profile == defaultProfileKey {
+			continue
+		}
+		for _, source := range orderSources(appCtx.ConfigFiles, []string{profile}, context, appCtx.Config.Precedence) {
+			if source.Profile != profile {
+				continue
+			}
+			properties, err := loadFromFile(source)
+			if err != nil {
+				return declarations, err
+			}
+			if p, ok := properties.get(includeProfilesKey); ok {
+				declarations.profileIncludes[profile] = append(declarations.profileIncludes[profile], profileNames(p.value)...)
+			}
+		}
+	}
+	return declarations, nil
+}
+
+// profileNames will read a list of profiles written as a comma separated string or as a list
+func profileNames(value interface{}) []string {
+	values := []interface{}{value}
+	if list, isList := value.([]interface{}); isList {
+		values = list
+	}
+	names := make([]string, 0)
+	for _, value := range values {
+		for _, name := range strings.Split(fmt.Sprint(value), ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
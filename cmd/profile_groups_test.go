@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExpandProfiles(t *testing.T) {
+	groups := map[string][]string{"prod": {"db", "mq"}, "db": {"postgres"}}
+	expanded, err := expandProfiles([]string{"metrics", "prod", "mq"}, groups)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"metrics", "prod", "db", "postgres", "mq"}, expanded)
+
+	groups["postgres"] = []string{"prod"}
+	_, err = expandProfiles([]string{"prod"}, groups)
+	assert.EqualError(t, err, "profile cycle: prod -> db -> postgres -> prod")
+}
+
+func TestActiveProfiles(t *testing.T) {
+	appCtx, cleanup := newTestPruner(t, map[string]string{
+		"application.yml":         "spring:\n  profiles:\n    include: metrics\n    group:\n      prod:\n        - db\n        - mq\nport: 1\n",
+		"application-metrics.yml": "port: 2\nmetrics: true\n",
+		"application-prod.yml":    "port: 3\n",
+		"application-db.yml":      "port: 4\ndb: true\n",
+		"application-mq.yml":      "mq: true\n",
+		"bootstrap.yml":           "a: b\n",
+		"application-legacy.yml":  "spring:\n  profiles:\n    include: db\n",
+		"application-cyclic.yml":  "spring:\n  profiles:\n    include: loop\n",
+		"application-loop.yml":    "spring:\n  profiles:\n    include: cyclic\n",
+	})
+	defer cleanup()
+
+	active, err := appCtx.activeProfiles("prod", "application")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"metrics", "prod", "db", "mq"}, active)
+	active, err = appCtx.activeProfiles("default", "bootstrap")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"default"}, active)
+
+	// the last profile wins, so the group member db overrides prod, which overrides the included metrics
+	properties, err := appCtx.unionProfileAndContext("prod", "application")
+	assert.Nil(t, err)
+	for key, expected := range map[string]interface{}{"port": 4, "metrics": true, "db": true, "mq": true} {
+		p, _ := properties.get(key)
+		assert.Equal(t, expected, p.value, key)
+	}
+
+	// profile specific includes are only read by spring boot 2.3 and earlier
+	active, err = appCtx.activeProfiles("legacy", "application")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"metrics", "legacy"}, active)
+	appCtx.Config.Precedence = LegacyPrecedence
+	active, err = appCtx.activeProfiles("legacy", "application")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"metrics", "legacy", "db"}, active)
+	_, err = appCtx.unionProfileAndContext("cyclic", "application")
+	assert.EqualError(t, err, "profile cycle: cyclic -> loop -> cyclic")
+}
@@ -0,0 +1,279 @@
+package cmd
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// property is a single leaf value as it was read from a configuration file
+type property struct {
+	// name is the key exactly as it was spelled in the source file
+	name  string
+	value interface{}
+	// source is the path of the file the value was read from
+	source string
+	// line is the line within the source file that holds the value
+	line int
+}
+
+// propertySet is an ordered collection of flattened properties.  Keys are compared using spring's relaxed binding
+// rules, so maxPoolSize, max-pool-size, max_pool_size and MAXPOOLSIZE all address the same property
+type propertySet struct {
+	// order holds the canonical names in the order they were first seen
+	order  []string
+	values map[string]property
+}
+
+var envIndexRegex = regexp.MustCompile(`^[0-9]+$`)
+
+// indexedNameRegex splits a name such as servers[0].host into its list root and the path within the list
+var indexedNameRegex = regexp.MustCompile(`^(.+?)(\[[0-9]+\].*)$`)
+
+func newPropertySet() *propertySet {
+	return &propertySet{order: make([]string, 0), values: make(map[string]property)}
+}
+
+// canonicalName will reduce a property name to its relaxed binding form.  Each element is lower cased with dashes and
+// underscores removed; upper case environment variable names such as SPRING_DATASOURCE_URL are split on underscores
+func canonicalName(name string) string {
+	if isEnvironmentForm(name) {
+		var canonical strings.Builder
+		for i, element := range strings.Split(name, "_") {
+			if envIndexRegex.MatchString(element) && i > 0 {
+				canonical.WriteString("[" + element + "]")
+				continue
+			}
+			if i > 0 {
+				canonical.WriteString(".")
+			}
+			canonical.WriteString(strings.ToLower(element))
+		}
+		return canonical.String()
+	}
+	elements := strings.Split(name, ".")
+	for i, element := range elements {
+		elements[i] = canonicalElement(element)
+	}
+	return strings.Join(elements, ".")
+}
+
+// canonicalElement will reduce a single dot separated element of a name; any [index] suffix is kept as written
+func canonicalElement(element string) string {
+	head, index := element, ""
+	if i := strings.Index(element, "["); i >= 0 {
+		head, index = element[:i], element[i:]
+	}
+	head = strings.NewReplacer("-", "", "_", "").Replace(head)
+	return strings.ToLower(head) + index
+}
+
+// isEnvironmentForm will report whether a name is written the way spring expects it from an environment variable
+func isEnvironmentForm(name string) bool {
+	return !strings.Contains(name, ".") && strings.Contains(name, "_") && name == strings.ToUpper(name)
+}
+
+// set will add the property, replacing the value (and spelling) of any equivalent key while keeping its position.
+// Names written with [n] notation are folded into the list value of their root property
+func (ps *propertySet) set(p property) {
+	if parts := indexedNameRegex.FindStringSubmatch(p.name); parts != nil {
+		ps.setIndexed(parts[1], parts[2], p)
+		return
+	}
+	key := canonicalName(p.name)
+	if _, ok := ps.values[key]; !ok {
+		ps.order = append(ps.order, key)
+	}
+	ps.values[key] = p
+}
+
+// setIndexed will set a single element of the list held by the root property, creating the list as needed
+func (ps *propertySet) setIndexed(root string, path string, p property) {
+	listProperty, ok := ps.get(root)
+	if !ok {
+		listProperty = property{name: root, source: p.source, line: p.line}
+	}
+	listProperty.value = setListPath(listProperty.value, path, p.value)
+	ps.set(listProperty)
+}
+
+// setListPath will place value at a path such as [0].host or [1][0] within a list, returning the updated container
+func setListPath(container interface{}, path string, value interface{}) interface{} {
+	if path == "" {
+		return value
+	}
+	if path[0] == '[' {
+		end := strings.Index(path, "]")
+		index, _ := strconv.Atoi(path[1:end])
+		list, _ := container.([]interface{})
+		for len(list) <= index {
+			list = append(list, nil)
+		}
+		list[index] = setListPath(list[index], path[end+1:], value)
+		return list
+	}
+	path = strings.TrimPrefix(path, ".")
+	end := strings.IndexAny(path, ".[")
+	if end < 0 {
+		end = len(path)
+	}
+	name, rest := path[:end], path[end:]
+	tree, _ := container.(yaml.MapSlice)
+	for i, item := range tree {
+		if canonicalElement(fmt.Sprint(item.Key)) == canonicalElement(name) {
+			tree[i].Value = setListPath(item.Value, rest, value)
+			return tree
+		}
+	}
+	return append(tree, yaml.MapItem{Key: name, Value: setListPath(nil, rest, value)})
+}
+
+// indexedProperties will expand a property holding a list into one property per element using [n] notation,
+// so that servers: [{host: a}] becomes servers[0].host.  Properties that do not hold a list are returned as is
+func indexedProperties(p property) []property {
+	switch value := p.value.(type) {
+	case []interface{}:
+		expanded := make([]property, 0, len(value))
+		for i, element := range value {
+			child := p
+			child.name = fmt.Sprintf("%s[%d]", p.name, i)
+			child.value = element
+			expanded = append(expanded, indexedProperties(child)...)
+		}
+		return expanded
+	case yaml.MapSlice:
+		expanded := make([]property, 0, len(value))
+		for _, item := range value {
+			child := p
+			child.name = fmt.Sprintf("%s.%v", p.name, item.Key)
+			child.value = item.Value
+			expanded = append(expanded, indexedProperties(child)...)
+		}
+		return expanded
+	}
+	return []property{p}
+}
+
+// valuesEqual will compare two property values the way spring would bind them: scalars by their string form,
+// lists element by element and nested maps key by key using relaxed binding
+func valuesEqual(a interface{}, b interface{}) bool {
+	switch left := a.(type) {
+	case []interface{}:
+		right, ok := b.([]interface{})
+		if !ok || len(left) != len(right) {
+			return false
+		}
+		for i := range left {
+			if !valuesEqual(left[i], right[i]) {
+				return false
+			}
+		}
+		return true
+	case yaml.MapSlice:
+		right, ok := b.(yaml.MapSlice)
+		if !ok || len(left) != len(right) {
+			return false
+		}
+		for _, item := range left {
+			found := false
+			for _, other := range right {
+				if canonicalElement(fmt.Sprint(item.Key)) == canonicalElement(fmt.Sprint(other.Key)) {
+					found = valuesEqual(item.Value, other.Value)
+					break
+				}
+			}
+			if !found {
+				return false
+			}
+		}
+		return true
+	}
+	switch b.(type) {
+	case []interface{}, yaml.MapSlice:
+		return false
+	}
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return fmt.Sprint(a) == fmt.Sprint(b)
+}
+
+// get will look up a property by any spelling of its name
+func (ps *propertySet) get(name string) (property, bool) {
+	p, ok := ps.values[canonicalName(name)]
+	return p, ok
+}
+
+// remove will delete a property by any spelling of its name
+func (ps *propertySet) remove(name string) {
+	key := canonicalName(name)
+	if _, ok := ps.values[key]; !ok {
+		return
+	}
+	delete(ps.values, key)
+	for i, k := range ps.order {
+		if k == key {
+			ps.order = append(ps.order[:i], ps.order[i+1:]...)
+			break
+		}
+	}
+}
+
+// keys will return the canonical names in the set in the order they were first seen
+func (ps *propertySet) keys() []string {
+	keys := make([]string, len(ps.order))
+	copy(keys, ps.order)
+	return keys
+}
+
+func (ps *propertySet) len() int {
+	return len(ps.order)
+}
+
+// merge will return a new set with the properties of overlay applied on top of this set
+func (ps *propertySet) merge(overlay *propertySet) *propertySet {
+	merged := newPropertySet()
+	for _, key := range ps.order {
+		merged.set(ps.values[key])
+	}
+	for _, key := range overlay.order {
+		merged.set(overlay.values[key])
+	}
+	return merged
+}
+
+// nested will expand the flattened properties back into a tree using the spelling the properties were loaded with.
+// Elements that are equivalent under relaxed binding share a single branch of the tree
+func (ps *propertySet) nested() yaml.MapSlice {
+	root := yaml.MapSlice{}
+	for _, key := range ps.order {
+		p := ps.values[key]
+		root = insertNested(root, strings.Split(p.name, "."), p.value)
+	}
+	return root
+}
+
+func insertNested(tree yaml.MapSlice, elements []string, value interface{}) yaml.MapSlice {
+	for i, item := range tree {
+		if canonicalElement(fmt.Sprint(item.Key)) != canonicalElement(elements[0]) {
+			continue
+		}
+		if len(elements) == 1 {
+			tree[i].Value = value
+			return tree
+		}
+		branch, ok := item.Value.(yaml.MapSlice)
+		if !ok {
+			branch = yaml.MapSlice{}
+		}
+		tree[i].Value = insertNested(branch, elements[1:], value)
+		return tree
+	}
+	if len(elements) == 1 {
+		return append(tree, yaml.MapItem{Key: elements[0], Value: value})
+	}
+	return append(tree, yaml.MapItem{Key: elements[0], Value: insertNested(yaml.MapSlice{}, elements[1:], value)})
+}
@@ -0,0 +1,163 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v2"
+)
+
+func TestCanonicalName(t *testing.T) {
+	expected := "spring.datasource.maxpoolsize"
+	for _, name := range []string{
+		"spring.datasource.maxPoolSize",
+		"spring.datasource.max-pool-size",
+		"spring.datasource.max_pool_size",
+		"Spring.DataSource.MaxPoolSize",
+		"SPRING_DATASOURCE_MAXPOOLSIZE",
+	} {
+		assert.EqualValues(t, expected, canonicalName(name), name)
+	}
+	assert.EqualValues(t, "my.servers[0].host", canonicalName("MY_SERVERS_0_HOST"))
+	assert.EqualValues(t, "my.servers[0].host", canonicalName("my.servers[0].host"))
+}
+
+func TestPropertySetMergeKeepsSpelling(t *testing.T) {
+	base := newPropertySet()
+	base.set(property{name: "spring.datasource.maxPoolSize", value: 10})
+	base.set(property{name: "server.port", value: 8080})
+	overlay := newPropertySet()
+	overlay.set(property{name: "spring.datasource.max-pool-size", value: "20"})
+
+	merged := base.merge(overlay)
+	assert.EqualValues(t, 2, merged.len())
+	assert.EqualValues(t, []string{"spring.datasource.maxpoolsize", "server.port"}, merged.keys())
+	p, ok := merged.get("SPRING_DATASOURCE_MAXPOOLSIZE")
+	assert.True(t, ok)
+	assert.EqualValues(t, "spring.datasource.max-pool-size", p.name)
+	assert.EqualValues(t, "20", p.value)
+
+	// the base set is left untouched
+	p, _ = base.get("spring.datasource.maxpoolsize")
+	assert.EqualValues(t, 10, p.value)
+
+	merged.remove("server.port")
+	assert.EqualValues(t, 1, merged.len())
+}
+
+func TestNestedUsesOriginalSpelling(t *testing.T) {
+	properties := newPropertySet()
+	properties.set(property{name: "spring.dataSource.maxPoolSize", value: 5})
+	properties.set(property{name: "spring.datasource.url", value: "jdbc:h2:mem"})
+	out, err := yaml.Marshal(properties.nested())
+	assert.Nil(t, err)
+	assert.EqualValues(t, "spring:\n  dataSource:\n    maxPoolSize: 5\n    url: jdbc:h2:mem\n", string(out))
+}
+
+func TestParsePropertiesFile(t *testing.T) {
+	content := "# comment\n" +
+		"! also a comment\n" +
+		"spring.datasource.maxPoolSize=10\n" +
+		"server.port : 8080\n" +
+		"app.message hello world\n" +
+		"app.multi=first \\\n" +
+		"    second\n" +
+		"app.escaped\\=key=a\\:b\\u00e9\n" +
+		"app.empty=\n"
+	properties := parsePropertiesDocument(t, []byte(content), "application.properties")
+	assert.EqualValues(t, 6, properties.len())
+
+	p, _ := properties.get("spring.datasource.max-pool-size")
+	assert.EqualValues(t, "spring.datasource.maxPoolSize", p.name)
+	assert.EqualValues(t, "10", p.value)
+	assert.EqualValues(t, 3, p.line)
+
+	p, _ = properties.get("server.port")
+	assert.EqualValues(t, "8080", p.value)
+	p, _ = properties.get("app.message")
+	assert.EqualValues(t, "hello world", p.value)
+	p, _ = properties.get("app.multi")
+	assert.EqualValues(t, "first second", p.value)
+	assert.EqualValues(t, 6, p.line)
+	p, _ = properties.get("app.escaped=key")
+	assert.EqualValues(t, "a:bé", p.value)
+	p, _ = properties.get("app.empty")
+	assert.EqualValues(t, "", p.value)
+}
+
+func TestParseYamlFile(t *testing.T) {
+	content := "spring:\n" +
+		"  datasource:\n" +
+		"    maxPoolSize: 10\n" +
+		"    url: jdbc:h2:mem\n" +
+		"server.port: 8080\n"
+	properties := parseYamlDocument(t, []byte(content), "application.yml")
+	assert.EqualValues(t, []string{"spring.datasource.maxpoolsize", "spring.datasource.url", "server.port"}, properties.keys())
+	p, _ := properties.get("spring.datasource.max-pool-size")
+	assert.EqualValues(t, "spring.datasource.maxPoolSize", p.name)
+	assert.EqualValues(t, 10, p.value)
+	assert.EqualValues(t, 3, p.line)
+
+	properties = parseYamlDocument(t, []byte("# nothing here\n"), "application.yml")
+	assert.EqualValues(t, 0, properties.len())
+}
+
+func TestIndexedPropertiesMatchYamlSequences(t *testing.T) {
+	fromProperties := parsePropertiesDocument(t, []byte("app.servers[0].host=a\napp.servers[0].port=80\napp.servers[1].host=b\napp.tags[0]=x\napp.tags[1]=y\n"), "application.properties")
+	fromYaml := parseYamlDocument(t, []byte("app:\n  servers:\n    - host: a\n      port: 80\n    - host: b\n  tags: [x, y]\n"), "application.yml")
+
+	assert.EqualValues(t, []string{"app.servers", "app.tags"}, fromProperties.keys())
+	assert.EqualValues(t, fromYaml.keys(), fromProperties.keys())
+	for _, key := range fromYaml.keys() {
+		left, _ := fromProperties.get(key)
+		right, _ := fromYaml.get(key)
+		assert.True(t, valuesEqual(left.value, right.value), key)
+	}
+
+	out, err := yaml.Marshal(fromProperties.nested())
+	assert.Nil(t, err)
+	assert.EqualValues(t, "app:\n  servers:\n  - host: a\n    port: \"80\"\n  - host: b\n  tags:\n  - x\n  - \"y\"\n", string(out))
+
+	servers, _ := fromYaml.get("app.servers")
+	expanded := indexedProperties(servers)
+	assert.EqualValues(t, 3, len(expanded))
+	assert.EqualValues(t, "app.servers[0].host", expanded[0].name)
+	assert.EqualValues(t, "app.servers[0].port", expanded[1].name)
+	assert.EqualValues(t, 80, expanded[1].value)
+	assert.EqualValues(t, "app.servers[1].host", expanded[2].name)
+}
+
+func TestMergeReplacesWholeLists(t *testing.T) {
+	base := parseYamlDocument(t, []byte("tags: [a, b, c]\n"), "application.yml")
+	overlay := parsePropertiesDocument(t, []byte("tags[0]=z\n"), "application-dev.properties")
+	merged := base.merge(overlay)
+	tags, _ := merged.get("tags")
+	assert.EqualValues(t, []interface{}{"z"}, tags.value)
+}
+
+func TestValuesEqual(t *testing.T) {
+	assert.True(t, valuesEqual(8080, "8080"))
+	assert.True(t, valuesEqual(nil, nil))
+	assert.False(t, valuesEqual(nil, ""))
+	assert.True(t, valuesEqual([]interface{}{"a", 1}, []interface{}{"a", "1"}))
+	assert.False(t, valuesEqual([]interface{}{"a", 1}, []interface{}{1, "a"}))
+	assert.False(t, valuesEqual([]interface{}{"a"}, "a"))
+	assert.True(t, valuesEqual(yaml.MapSlice{{Key: "maxPool", Value: 1}}, yaml.MapSlice{{Key: "max-pool", Value: "1"}}))
+	assert.False(t, valuesEqual(yaml.MapSlice{{Key: "a", Value: 1}}, yaml.MapSlice{{Key: "b", Value: 1}}))
+}
+
+// parsePropertiesDocument will parse properties content that is expected to hold a single document
+func parsePropertiesDocument(t *testing.T, data []byte, source string) *propertySet {
+	documents, err := parsePropertiesDocuments(data, source)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 1, len(documents))
+	return documents[0]
+}
+
+// parseYamlDocument will parse yaml content that is expected to hold a single document
+func parseYamlDocument(t *testing.T, data []byte, source string) *propertySet {
+	documents, err := parseYamlDocuments(data, source)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 1, len(documents))
+	return documents[0]
+}
@@ -4,89 +4,299 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"sort"
 	"strings"
+	"time"
 
 	mapset "github.com/deckarep/golang-set"
 	log "github.com/gkontos/bivalve-chronicles"
-	"github.com/jeremywohl/flatten"
-	"github.com/wolfeidau/unflatten"
 	"gopkg.in/yaml.v2"
+
+	"github.com/gkontos/spiny-dogfish/model"
+)
+
+const (
+	// SeparateFilesLayout writes one pruned file per profile
+	SeparateFilesLayout = "files"
+	// MultiDocumentLayout writes one pruned file per context holding a yaml document per profile
+	MultiDocumentLayout = "multi-document"
 )
 
+var outputLayouts = []string{SeparateFilesLayout, MultiDocumentLayout}
+
+const (
+	// YamlOutputFormat writes the pruned files as yaml
+	YamlOutputFormat = "yaml"
+	// PropertiesOutputFormat writes the pruned files in java properties syntax
+	PropertiesOutputFormat = "properties"
+	// SameAsInputFormat writes each profile in the format of its own files, or as yaml when it has none
+	SameAsInputFormat = "same"
+)
+
+var outputFormats = []string{YamlOutputFormat, PropertiesOutputFormat, SameAsInputFormat}
+
 type matchingKeys struct {
 	profileMatches []string
 	sharedValue    interface{}
 }
 
 type profilePropertyPruner struct {
-	profile        string
-	flatProperties map[string]interface{}
-	keySet         mapset.Set
-	changes        map[string]changeSet
+	profile    string
+	properties *propertySet
+	keySet     mapset.Set
+	changes    map[string]changeSet
+	// resolved holds the properties with their placeholders resolved when values are compared resolved
+	resolved *propertySet
+	// own holds the properties of the profile's own files, which the changes are applied to
+	own *propertySet
+	// sources are the profile's own files, set once the changes have been decided
+	sources []model.JavaConfigFileMetadata
 }
 
+const (
+	// hoistToDefaultAction sets a value shared by several profiles in the default profile
+	hoistToDefaultAction = "hoist-to-default"
+	// deleteAction removes a value from a profile that now inherits it from the default profile
+	deleteAction = "delete"
+	// conflictAction reports a property that every profile sets to a different value; nothing is changed
+	conflictAction = "conflict"
+	// renameAction moves a value from a key spring boot no longer reads to the key that replaced it
+	renameAction = "rename"
+	// moveAction moves a value from the file of one application context to the file of the same profile in the other
+	moveAction = "move"
+	// overrideAction sets the value a profile inherited from the default profile in the profile's own files, as the
+	// default profile now holds a different value
+	overrideAction = "override"
+)
+
 type changeSet struct {
+	// key is the property name as it is spelled in the configuration files
+	key      string
+	action   string
 	oldValue interface{}
 	newValue interface{}
 	message  string
 	delete   bool
-	profile  string
+	// renamedTo is the new name of a renamed key, which takes newValue
+	renamedTo string
+	// profile is the profile whose file the change applies to
+	profile string
+	// profiles are every profile the change affects
+	profiles []string
+	// source is the file the changed value was read from; it is empty when a value is added
+	source string
+	// values holds the value set in each profile for a conflict
+	values map[string]interface{}
 }
 
 // PruneProperties will load config files, compact duplicate values, and output updated configuration files
 func (env *Pruner) PruneProperties() {
 	if runProfile, err := promptString("Profiles to Consolidate (semi-colon separated list of profiles.  Ie: dev; prod)"); err != nil {
 		log.Errorf("Error: %v", err)
-	} else {
-		profiles := strings.Split(strings.ReplaceAll(runProfile, " ", ""), ";")
-		for _, context := range fileNames {
-			profileProperties, changes := env.intersectProfileAndContext(profiles, context)
-
-			for _, newProperties := range profileProperties {
-				log.Debugf("APPLYING CHANGES TO PROFILE: %s", newProperties.profile)
-				newProperties.flatProperties = applyChanges(newProperties.flatProperties, newProperties.changes)
+	} else if err := env.Prune(SplitProfiles(runProfile), fileNames); err != nil {
+		log.Errorf("Error: %v", err)
+	}
+}
+
+// prunedContext holds the result of pruning one application context before anything is written
+type prunedContext struct {
+	context           string
+	profileProperties []profilePropertyPruner
+	changes           []changeSet
+	targets           map[string]inPlaceTarget
+}
+
+// Prune will compact duplicate values across the profiles for each of the requested contexts and write the pruned configuration files.
+// In place mode rewrites the original files, after backing them up, instead of writing new files to the output directory.
+// A dry run writes nothing but a patch of the changes an in place prune would make
+func (env *Pruner) Prune(profiles []string, contexts []string) (err error) {
+	if len(profiles) == 0 {
+		return fmt.Errorf("at least one profile is required")
+	}
+	if _, found := Find(outputLayouts, env.Config.OutputLayout); !found && env.Config.OutputLayout != "" {
+		return fmt.Errorf("unknown output layout %q, expected one of %s", env.Config.OutputLayout, strings.Join(outputLayouts, ", "))
+	}
+	if _, found := Find(outputFormats, env.Config.OutputFormat); !found && env.Config.OutputFormat != "" {
+		return fmt.Errorf("unknown output format %q, expected one of %s", env.Config.OutputFormat, strings.Join(outputFormats, ", "))
+	}
+	if _, found := Find(comparisonModes, env.Config.Compare); !found && env.Config.Compare != "" {
+		return fmt.Errorf("unknown comparison %q, expected one of %s", env.Config.Compare, strings.Join(comparisonModes, ", "))
+	}
+	if _, found := Find(reportFormats, env.Config.ReportFormat); !found && env.Config.ReportFormat != "" {
+		return fmt.Errorf("unknown report format %q, expected one of %s", env.Config.ReportFormat, strings.Join(reportFormats, ", "))
+	}
+	strategy, err := env.hoistStrategy(profiles)
+	if err != nil {
+		return err
+	}
+	results := make([]prunedContext, 0, len(contexts))
+	for _, context := range contexts {
+		result, err := env.pruneContext(profiles, context)
+		if err != nil {
+			return err
+		}
+		results = append(results, result)
+	}
+
+	// the pruned files are read back and every profile is merged again from them before anything is written
+	var verifyErr error
+	for _, result := range results {
+		if err := env.verifyPruned(result, strategy); err != nil && verifyErr == nil {
+			verifyErr = err
+		}
+	}
+	if env.Config.DryRun {
+		preview := env.previewOutput
+		if env.Config.InPlace {
+			preview = env.previewChanges
+		}
+		if err := preview(results); err != nil {
+			return err
+		}
+		return verifyErr
+	}
+	if env.Config.InPlace && verifyErr != nil {
+		return fmt.Errorf("%v, no files were rewritten", verifyErr)
+	}
+
+	var backup *backupSession
+	if env.Config.InPlace {
+		if backup, err = newBackupSession(env.Config.BackupDirectory, time.Now()); err != nil {
+			return err
+		}
+		defer func() {
+			if closeErr := backup.close(); closeErr != nil && err == nil {
+				err = closeErr
 			}
+		}()
+	}
+	for _, result := range results {
+		if env.Config.InPlace {
+			err = writeInPlace(result.profileProperties, result.targets, backup)
+		} else {
+			err = outputToFiles(result.profileProperties, result.context, env.Config.OutputDirectory, env.Config.OutputLayout, env.Config.OutputFormat)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if err := outputChangeReport(results, env.Config.OutputDirectory, env.Config.ReportFormat, env.Config.ShowSecrets, time.Now()); err != nil {
+		return err
+	}
+	return verifyErr
+}
 
-			outputToFiles(profileProperties, context)
-			outputChanges(changes, context)
+// pruneContext will decide the changes for one context and apply them to the own properties of each profile.  In
+// place mode also finds the file each profile is written to
+func (env *Pruner) pruneContext(profiles []string, context string) (prunedContext, error) {
+	profileProperties, changes, err := env.intersectProfileAndContext(profiles, context)
+	if err != nil {
+		return prunedContext{}, err
+	}
+
+	// the changes were decided on each profile's merged view; they are applied to the profile's own properties
+	// so the pruned files do not repeat what the profile inherits from the default profile
+	for i, newProperties := range profileProperties {
+		log.Debugf("APPLYING CHANGES TO PROFILE: %s", newProperties.profile)
+		profileProperties[i].sources = env.profileSources(newProperties.profile, context)
+		profileProperties[i].properties = applyChanges(newProperties.own, newProperties.changes)
+	}
+
+	result := prunedContext{context: context, profileProperties: profileProperties, changes: changes}
+	if env.Config.InPlace {
+		// every target is checked before any file is touched
+		if result.targets, err = env.inPlaceTargets(profileProperties, context); err != nil {
+			return result, err
 		}
 	}
+	return result, nil
 }
 
-func (env *Pruner) intersectProfileAndContext(profiles []string, context string) ([]profilePropertyPruner, []changeSet) {
-	collectedProfiles := make(map[string]map[string]interface{})
+// SplitProfiles will split a semi-colon (or comma) separated list of profiles, dropping any blank entries
+func SplitProfiles(value string) []string {
+	profiles := make([]string, 0)
+	for _, profile := range strings.FieldsFunc(value, func(r rune) bool { return r == ';' || r == ',' }) {
+		if profile = strings.TrimSpace(profile); profile != "" {
+			profiles = append(profiles, profile)
+		}
+	}
+	return profiles
+}
+
+// intersectProfileAndContext will merge each profile with the default profile and decide how every key set by the
+// pruned profiles is best laid out.  The changes are then checked by merging every profile again with the pruned
+// files; a key whose value would change in any profile other than the default profile is left as it is and
+// reported as a conflict
+func (env *Pruner) intersectProfileAndContext(profiles []string, context string) ([]profilePropertyPruner, []changeSet, error) {
+	strategy, err := env.hoistStrategy(profiles)
+	if err != nil {
+		return nil, nil, err
+	}
+	collectedProfiles := make(map[string]*propertySet)
 	profiles = append(profiles, defaultProfileKey)
 	for _, profile := range profiles {
-		collectedProfiles[profile] = env.unionProfileAndContext(profile, context)
+		properties, err := env.unionProfileAndContext(profile, context)
+		if err != nil {
+			return nil, nil, err
+		}
+		collectedProfiles[profile] = properties
 	}
 
+	environment, err := env.pruneEnvironment()
+	if err != nil {
+		return nil, nil, err
+	}
 	profileProperties := getFlatProperties(collectedProfiles)
+	for i, profileProperty := range profileProperties {
+		own, err := loadSources(env.profileSources(profileProperty.profile, context))
+		if err != nil {
+			return nil, nil, err
+		}
+		profileProperties[i].own = own
+		if env.Config.Compare == ResolvedComparison {
+			resolved, problems := resolvePlaceholders(profileProperty.properties, environment)
+			for _, problem := range problems {
+				log.Infof("Unresolved placeholder in the %s profile: %s", profileProperty.profile, problem)
+			}
+			profileProperties[i].resolved = resolved
+		}
+	}
 
-	// GET A SET OF ALL THE PROPERTIES WHICH ARE SET IN ALL PROFILES
-	keysetIntersection := getPropertyIntersection(profileProperties, defaultProfileKey)
-
-	profileProperties, changes := decorateWithChanges(profileProperties, keysetIntersection)
-	// for the key intersections, if values match the default profile, they should be removed
-	return profileProperties, changes
-
-}
-
-func mostMatches(matches []matchingKeys) matchingKeys {
-	max := 0
-	index := 0
-	for i, match := range matches {
-		if len(match.profileMatches) > max {
-			max = len(match.profileMatches)
-			index = i
+	views, err := env.verifiedViews(context, strategy)
+	if err != nil {
+		return nil, nil, err
+	}
+	keys := getPropertyUnion(profileProperties, defaultProfileKey)
+	// skipped maps each key that is left as it is to the profile it would change
+	skipped := make(map[string]string)
+	for {
+		for i := range profileProperties {
+			profileProperties[i].changes = nil
+		}
+		var changes []changeSet
+		profileProperties, changes = decorateWithChanges(profileProperties, keys, strategy, skipped)
+		changed, err := env.prunedChanges(profileProperties, context, views)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(changed) == 0 {
+			return profileProperties, changes, nil
+		}
+		for key, profile := range changed {
+			if _, found := skipped[key]; found {
+				return nil, nil, fmt.Errorf("%s changes in the %s profile even though it is not pruned", key, profile)
+			}
+			log.Infof("%s is left as it is, pruning it would change its value in the %s profile", key, profile)
+			skipped[key] = profile
 		}
 	}
-	return matches[index]
 }
 
 // addToMatchingValuesSlice if there is already a matchingKay with value, add the profile to the exiting match; otherwise add a new match to the slice
 func addToMatchingValuesSlice(value interface{}, profile string, matchingValues []matchingKeys) []matchingKeys {
 	for i, match := range matchingValues {
-		if match.sharedValue == value {
+		if valuesEqual(match.sharedValue, value) {
 			match.profileMatches = append(match.profileMatches, profile)
 			matchingValues[i] = match
 			return matchingValues
@@ -99,121 +309,187 @@ func addToMatchingValuesSlice(value interface{}, profile string, matchingValues
 	return matchingValues
 }
 
-// findSmallestSetProfile will find and return the profile with the smallest set of properties
-func findSmallestSetProfile(profiles []profilePropertyPruner, exclude string) profilePropertyPruner {
-	minsize := -1
-	minindex := -1
-	for i, profile := range profiles {
-		if profile.profile != exclude {
-			if minsize == -1 || len(profile.flatProperties) < minsize {
-				minsize = len(profile.flatProperties)
-				minindex = i
-			}
+func getFlatProperties(collectedProfiles map[string]*propertySet) []profilePropertyPruner {
+	profileProperties := make([]profilePropertyPruner, 0)
+	for k, v := range collectedProfiles {
+		propertyKeys := mapset.NewSet()
+		for _, key := range v.keys() {
+			propertyKeys.Add(key)
 		}
+		profileProperty := profilePropertyPruner{}
+		profileProperty.keySet = propertyKeys
+		profileProperty.profile = k
+		profileProperty.properties = v
+		profileProperties = append(profileProperties, profileProperty)
 	}
-	if minindex > -1 {
-		return profiles[minindex]
-	}
-	return profilePropertyPruner{}
+	return profileProperties
 }
 
-func getFlatProperties(collectedProfiles map[string]map[string]interface{}) []profilePropertyPruner {
-	profileProperties := make([]profilePropertyPruner, 0)
-	for k, v := range collectedProfiles {
-
-		if flatProfile, err := flatten.Flatten(v, "", flatten.DotStyle); err != nil {
-			log.Errorf("error flatteniing map %v", err)
-		} else {
-			propertyKeys := mapset.NewSet()
-			for key := range flatProfile {
-				propertyKeys.Add(key)
-			}
-			profileProperty := profilePropertyPruner{}
-			profileProperty.keySet = propertyKeys
-			profileProperty.profile = k
-			profileProperty.flatProperties = flatProfile
-			profileProperties = append(profileProperties, profileProperty)
+// spelledName will return the name of a property as it was written in the first profile that defines it
+func spelledName(profileProperties []profilePropertyPruner, key string) string {
+	for _, profileProperty := range profileProperties {
+		if p, ok := profileProperty.properties.get(key); ok {
+			return p.name
 		}
-
 	}
-	return profileProperties
+	return key
 }
 
-func getPropertyIntersection(flatProfileProperties []profilePropertyPruner, excludeProfile string) mapset.Set {
-	smallestSetProfile := findSmallestSetProfile(flatProfileProperties, defaultProfileKey)
-	keysetIntersection := smallestSetProfile.keySet
+// getPropertyUnion will return every key set in any profile other than the excluded one, sorted
+func getPropertyUnion(flatProfileProperties []profilePropertyPruner, excludeProfile string) []string {
+	keysetUnion := mapset.NewSet()
 	for _, v := range flatProfileProperties {
-		if v.profile != smallestSetProfile.profile && v.profile != excludeProfile {
-			keysetIntersection = keysetIntersection.Intersect(v.keySet)
+		if v.profile != excludeProfile {
+			keysetUnion = keysetUnion.Union(v.keySet)
 		}
 	}
-	return keysetIntersection
+	keys := make([]string, 0, keysetUnion.Cardinality())
+	for key := range keysetUnion.Iter() {
+		keys = append(keys, key.(string))
+	}
+	sort.Strings(keys)
+	return keys
 }
 
-func decorateWithChanges(profileProperties []profilePropertyPruner, keysetIntersection mapset.Set) ([]profilePropertyPruner, []changeSet) {
+// decorateWithChanges will lay out each key across the default profile and the own files of the pruned profiles
+// in the fewest lines the hoist strategy allows.  A key that some pruned profile does not see is never hoisted, as
+// that profile would inherit the hoisted value.  When a shared value is hoisted the profiles sharing it drop their
+// copy, and a profile that inherited the value it replaces sets that value in its own files.  Otherwise a profile
+// that repeats the value of the default profile drops its copy, and a key that every profile sets to a different
+// value is reported as a conflict.  Keys in skipped are only reported
+func decorateWithChanges(profileProperties []profilePropertyPruner, keys []string, strategy hoistStrategy, skipped map[string]string) ([]profilePropertyPruner, []changeSet) {
 	changes := make([]changeSet, 0)
-	it := keysetIntersection.Iterator()
-	for elem := range it.C {
-		log.Debugf("DECORATING FOR KEY %s", elem.(string))
+	defaults := profilePropertiesFor(profileProperties, defaultProfileKey)
+	addChange := func(canonical string, change changeSet) {
+		profileProperties = setProfilePropertyChange(profileProperties, canonical, change, change.profile)
+		changes = append(changes, change)
+	}
+	for _, key := range keys {
+		log.Debugf("DECORATING FOR KEY %s", key)
+		name := spelledName(profileProperties, key)
+		if profile, skip := skipped[key]; skip {
+			addChange(key, changeSet{key: name, action: conflictAction, profile: defaultProfileKey, profiles: []string{profile},
+				message: fmt.Sprintf("The property %s is left as it is, pruning it would change its value in the %s profile", name, profile)})
+			continue
+		}
 
 		matchingValues := make([]matchingKeys, 0)
-		for _, profileProperty := range profileProperties {
-			if profileProperty.profile != defaultProfileKey {
-				value, ok := profileProperty.flatProperties[elem.(string)]
-				if !ok {
-					value = ""
-				}
-
-				matchingValues = addToMatchingValuesSlice(value, profileProperty.profile, matchingValues)
+		rawValues := make(map[string]interface{})
+		complete := true
+		for _, profileProperty := range sortedByProfile(profileProperties) {
+			if profileProperty.profile == defaultProfileKey {
+				continue
+			}
+			value, ok := comparedValue(profileProperty, key)
+			if !ok {
+				complete = false
+				break
 			}
+			p, _ := profileProperty.properties.get(key)
+			rawValues[profileProperty.profile] = p.value
+			matchingValues = addToMatchingValuesSlice(value, profileProperty.profile, matchingValues)
+		}
+		if !complete || len(matchingValues) == 0 {
+			continue
+		}
+		current, inDefault := comparedValue(defaults, key)
+
+		// ownChange will describe a change to the copy of the key in a profile's own files
+		ownChange := func(profile string, action string, message string) (changeSet, bool) {
+			p, owned := profilePropertiesFor(profileProperties, profile).own.get(key)
+			change := changeSet{key: name, action: action, delete: action == deleteAction, oldValue: rawValues[profile],
+				profile: profile, profiles: []string{profile}, message: message}
+			if action == overrideAction {
+				change.oldValue, change.newValue = nil, rawValues[profile]
+			} else {
+				change.source = p.source
+			}
+			return change, owned == (action == deleteAction)
 		}
 
-		// THE RULES BELOW APPLY B/C we are looking only at properties which intersect across all files
-		if len(matchingValues) < len(profileProperties) {
-			// if all properties are equal ; set the default property to the found value and mark the property for removal from all profiles
-
-			// if some properties are equal; mark the default property for update and mark the property for removal in equivalent profiles
-			matchingValue := mostMatches(matchingValues)
-
-			allFileMessage := fmt.Sprintf("The property %s is equivalent across profiles %s."+
-				"The shared value of %v is being added to the default file.",
-				elem.(string), strings.Join(matchingValue.profileMatches, ","), matchingValue.sharedValue)
-
-			change := changeSet{}
-			change.delete = false
-			change.newValue = matchingValues[0].sharedValue
-			change.profile = defaultProfileKey
-			change.message = allFileMessage
-			profileProperties = setProfilePropertyChange(profileProperties, elem.(string), change, defaultProfileKey)
-			changes = append(changes, change)
-
-			for _, profile := range matchingValue.profileMatches {
-				change := changeSet{}
-				change.delete = true
-				change.oldValue = matchingValues[0].sharedValue
-				change.profile = profile
-				change.message = allFileMessage
-				profileProperties = setProfilePropertyChange(profileProperties, elem.(string), change, profile)
-				changes = append(changes, change)
+		shared := strategy.bestLayout(matchingValues, current, inDefault)
+		if shared == nil {
+			deleted := false
+			for _, match := range matchingValues {
+				if !inDefault || !valuesEqual(match.sharedValue, current) {
+					continue
+				}
+				for _, profile := range match.profileMatches {
+					message := fmt.Sprintf("The property %s of the %s profile repeats the value of %v it inherits from the default profile",
+						name, profile, maskValue(name, rawValues[profile]))
+					if change, applies := ownChange(profile, deleteAction, message); applies {
+						addChange(key, change)
+						deleted = true
+					}
+				}
+			}
+			if !deleted && len(matchingValues) > 1 && len(matchingValues) == len(rawValues) {
+				// the property is set to a different value in every profile.  This might be a mistake?
+				var msg strings.Builder
+				msg.WriteString(fmt.Sprintf("The property %s is set with different values on all profiles", name))
+				change := changeSet{key: name, action: conflictAction, profile: defaultProfileKey, values: make(map[string]interface{})}
+				for _, v := range matchingValues {
+					msg.WriteString(fmt.Sprintf(" {Profile : %s => %v} ", strings.Join(v.profileMatches, ","), maskValue(name, v.sharedValue)))
+					change.profiles = append(change.profiles, v.profileMatches...)
+					for _, profile := range v.profileMatches {
+						change.values[profile] = v.sharedValue
+					}
+				}
+				change.message = msg.String()
+				addChange(key, change)
 			}
+			continue
+		}
 
-		} else {
-			// add a comment to the default propertyfile?  this property is set in all files, but a different value exists in all files.  This might be a mistake?
-			var msg strings.Builder
-			msg.WriteString(fmt.Sprintf("The property %s is set with different values on all profiles", elem.(string)))
-			for _, v := range matchingValues {
-				msg.WriteString(fmt.Sprintf(" {Profile : %s => %v} ", strings.Join(v.profileMatches, ","), v.sharedValue))
+		sharedValue := hoistedValue(*shared, rawValues)
+		allFileMessage := fmt.Sprintf("The property %s is equivalent across profiles %s. "+
+			"The shared value of %v is being added to the default file.",
+			name, strings.Join(shared.profileMatches, ","), maskValue(name, sharedValue))
+		change := changeSet{key: name, action: hoistToDefaultAction, newValue: sharedValue, profile: defaultProfileKey,
+			profiles: shared.profileMatches, message: allFileMessage}
+		if p, ok := defaults.properties.get(key); ok {
+			change.oldValue = p.value
+			change.source = p.source
+		}
+		addChange(key, change)
+		for i, match := range matchingValues {
+			for _, profile := range match.profileMatches {
+				action, message := deleteAction, allFileMessage
+				if &matchingValues[i] != shared {
+					action = overrideAction
+					message = fmt.Sprintf("The property %s keeps the value of %v in the %s profile, which no longer inherits it from the default profile",
+						name, maskValue(name, rawValues[profile]), profile)
+				}
+				if change, applies := ownChange(profile, action, message); applies {
+					addChange(key, change)
+				}
 			}
-			change := changeSet{}
-			change.message = msg.String()
-			change.delete = false
-			profileProperties = setProfilePropertyChange(profileProperties, elem.(string), change, defaultProfileKey)
+		}
+	}
+	return profileProperties, changes
+}
 
-			changes = append(changes, change)
+// hoistedValue will choose the value moved to the default profile.  Values that were matched after resolving their
+// placeholders are hoisted as written when every profile wrote them the same way, otherwise the resolved value is
+// hoisted so that each profile still sees the value it resolved to
+func hoistedValue(matchingValue matchingKeys, rawValues map[string]interface{}) interface{} {
+	raw := rawValues[matchingValue.profileMatches[0]]
+	for _, profile := range matchingValue.profileMatches[1:] {
+		if !valuesEqual(raw, rawValues[profile]) {
+			return matchingValue.sharedValue
+		}
+	}
+	return raw
+}
 
+// profilePropertiesFor will return the properties loaded for a profile
+func profilePropertiesFor(profileProperties []profilePropertyPruner, profile string) profilePropertyPruner {
+	for _, profileProperty := range profileProperties {
+		if profileProperty.profile == profile {
+			return profileProperty
 		}
 	}
-	return profileProperties, changes
+	return profilePropertyPruner{properties: newPropertySet()}
 }
 
 func setProfilePropertyChange(profileProperties []profilePropertyPruner, propertyKey string, change changeSet, profile string) []profilePropertyPruner {
@@ -231,58 +507,195 @@ func setProfilePropertyChange(profileProperties []profilePropertyPruner, propert
 	return updatedProperties
 }
 
-func applyChanges(flatProperties map[string]interface{}, changes map[string]changeSet) map[string]interface{} {
-	log.Debugf("Start count %d", len(flatProperties))
-	expectedcount := len(flatProperties)
+func applyChanges(properties *propertySet, changes map[string]changeSet) *propertySet {
+	log.Debugf("Start count %d", properties.len())
+	expectedcount := properties.len()
 	deletecount := 0
 	addcount := 0
 	for k, v := range changes {
-		if v.delete {
-			delete(flatProperties, k)
+		if v.renamedTo != "" {
+			renamed, _ := properties.get(k)
+			properties.remove(k)
+			renamed.name = v.renamedTo
+			renamed.value = v.newValue
+			properties.set(renamed)
+		} else if v.delete {
+			properties.remove(k)
 			expectedcount--
 			deletecount++
 		} else if v.newValue != nil {
-			if _, ok := flatProperties[k]; !ok {
-				// if the element does not already exist in the map, this is a new value which will be added
+			updated, ok := properties.get(k)
+			if !ok {
+				// if the element does not already exist in the set, this is a new value which will be added
 				expectedcount++
 				addcount++
+				updated = property{name: v.key}
 			}
-			flatProperties[k] = v.newValue
+			updated.value = v.newValue
+			properties.set(updated)
 
 		}
 	}
 	log.Debugf("deleted: %d, added: %d", deletecount, addcount)
-	log.Debugf("End count %d", len(flatProperties))
-	log.Debugf("Expected %d, Saw %d", expectedcount, len(flatProperties))
-	return flatProperties
+	log.Debugf("End count %d", properties.len())
+	log.Debugf("Expected %d, Saw %d", expectedcount, properties.len())
+	return properties
+}
+
+// outputFile is a pruned file as it is written to the output directory
+type outputFile struct {
+	name       string
+	configType string
+	content    []byte
+	// source is the original file of the profile the file is rendered for; it is nil when the file holds several
+	// profiles or the profile does not come from exactly one file
+	source *model.JavaConfigFileMetadata
+}
+
+// outputToFiles will write the pruned properties for each profile in the requested format
+func outputToFiles(profileProperties []profilePropertyPruner, context string, outputDirectory string, layout string, format string) error {
+	if err := ensureOutputDirectory(outputDirectory); err != nil {
+		return err
+	}
+	files, err := renderOutput(profileProperties, context, layout, format)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		propertiesFileName := filepath.Join(outputDirectory, file.name)
+		if err := ioutil.WriteFile(propertiesFileName, file.content, 0644); err != nil {
+			return fmt.Errorf("unable to write %s: %v", propertiesFileName, err)
+		}
+	}
+	return nil
 }
 
-func outputToFiles(profileProperties []profilePropertyPruner, context string) {
-	for _, properties := range profileProperties {
-		propertiesFileName := fmt.Sprintf("%s-%s-pruned.yml", context, properties.profile)
-		changesFileName := fmt.Sprintf("%s-%s-pruned-changes.txt", context, properties.profile)
-		expandedProperties := unflatten.Unflatten(properties.flatProperties, func(k string) []string { return strings.Split(k, ".") })
-		ymlString, _ := yaml.Marshal(expandedProperties)
-		ioutil.WriteFile(propertiesFileName, ymlString, 0644)
+// renderOutput will render the files a prune writes to the output directory.  The multi-document layout renders
+// every profile of the context into one file, gating each profile's document on spring.config.activate.on-profile,
+// in the format chosen for the default profile.  A profile that comes from a single file of the same format is
+// rendered as an edit of that file, keeping its comments and order
+func renderOutput(profileProperties []profilePropertyPruner, context string, layout string, format string) ([]outputFile, error) {
+	sorted := sortedByProfile(profileProperties)
+	files := make([]outputFile, 0, len(profileProperties))
+	documents := make([]string, 0, len(profileProperties))
+	documentType := profileConfigType(sorted[0], format)
+	for _, properties := range sorted {
+		configType := profileConfigType(properties, format)
+		changes := properties.changes
+		if layout == MultiDocumentLayout {
+			configType = documentType
+			if properties.profile != defaultProfileKey {
+				changes = withActivationChange(changes, properties.profile)
+			}
+		}
+		content, err := prunedDocument(properties, changes, configType)
+		if err != nil {
+			return nil, fmt.Errorf("unable to marshal %s profile: %v", properties.profile, err)
+		}
+		if layout == MultiDocumentLayout {
+			documents = append(documents, string(content))
+			continue
+		}
+		file := outputFile{name: fmt.Sprintf("%s-%s-pruned.%s", context, properties.profile, configType), configType: configType, content: content}
+		if len(properties.sources) == 1 && !isReadOnly(properties.sources[0]) {
+			file.source = &properties.sources[0]
+		}
+		files = append(files, file)
+	}
+	if layout == MultiDocumentLayout {
+		for i, document := range documents {
+			if !strings.HasSuffix(document, "\n") {
+				documents[i] = document + "\n"
+			}
+		}
+		separator := "---\n"
+		if documentType == "properties" {
+			separator = "#---\n"
+		}
+		files = append(files, outputFile{name: fmt.Sprintf("%s-pruned.%s", context, documentType), configType: documentType,
+			content: []byte(strings.Join(documents, separator))})
+	}
+	return files, nil
+}
 
-		f, _ := os.Create(changesFileName)
-		defer f.Close()
-		for _, line := range properties.changes {
-			_, _ = f.WriteString(line.message + "\n")
+// profileConfigType will choose the file type a pruned profile is written as: yml, yaml or properties
+func profileConfigType(properties profilePropertyPruner, format string) string {
+	switch format {
+	case PropertiesOutputFormat:
+		return "properties"
+	case SameAsInputFormat:
+		// sources are in merge order, so the last one is the file the profile's values are read from first
+		if len(properties.sources) > 0 {
+			return properties.sources[len(properties.sources)-1].ConfigurationType
 		}
+	}
+	return "yml"
+}
 
-		f.Sync()
+// prunedDocument will render a profile as configType.  A profile that comes from a single file of the same format
+// is rendered by editing that file; any other profile is formatted from its properties
+func prunedDocument(properties profilePropertyPruner, changes map[string]changeSet, configType string) ([]byte, error) {
+	if len(properties.sources) == 1 && (properties.sources[0].ConfigurationType == "properties") == (configType == "properties") {
+		content, err := editConfigFile(properties.sources[0], changes)
+		if err != errNotEditable {
+			return content, err
+		}
+		log.Infof("The layout of %s can not be kept, writing the %s profile without its comments", properties.sources[0].Path, properties.profile)
+	}
+	prunedProperties := properties.properties
+	if activation, ok := changes[canonicalName(activateOnProfileKey)]; ok {
+		prunedProperties = withActivationProfile(prunedProperties, fmt.Sprint(activation.newValue))
 	}
+	return formatConfigFile(prunedProperties, configType)
 }
 
-func outputChanges(changes []changeSet, context string) {
+// sortedByProfile will order the profiles with the default profile first and the rest alphabetically
+func sortedByProfile(profileProperties []profilePropertyPruner) []profilePropertyPruner {
+	sorted := make([]profilePropertyPruner, len(profileProperties))
+	copy(sorted, profileProperties)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].profile == defaultProfileKey || sorted[j].profile == defaultProfileKey {
+			return sorted[i].profile == defaultProfileKey && sorted[j].profile != defaultProfileKey
+		}
+		return sorted[i].profile < sorted[j].profile
+	})
+	return sorted
+}
 
-	f, _ := os.Create(fmt.Sprintf("change-set-%s.txt", context))
-	defer f.Close()
-	for _, line := range changes {
-		_, _ = f.WriteString(line.message + "\n")
+// withActivationProfile will return a copy of the properties that leads with the spring.config.activate.on-profile
+// key for profile; the default profile is returned unchanged
+func withActivationProfile(properties *propertySet, profile string) *propertySet {
+	if profile == defaultProfileKey {
+		return properties
 	}
+	gated := newPropertySet()
+	gated.set(property{name: activateOnProfileKey, value: profile})
+	return gated.merge(properties)
+}
+
+// withActivationChange will return a copy of the changes that also sets spring.config.activate.on-profile to profile
+func withActivationChange(changes map[string]changeSet, profile string) map[string]changeSet {
+	gated := map[string]changeSet{canonicalName(activateOnProfileKey): {key: activateOnProfileKey, newValue: profile}}
+	for key, change := range changes {
+		gated[key] = change
+	}
+	return gated
+}
 
-	f.Sync()
+// formatConfigFile will render properties as yaml, or as java properties for the properties configuration type
+func formatConfigFile(properties *propertySet, configType string) ([]byte, error) {
+	if configType == "properties" {
+		return formatProperties(properties), nil
+	}
+	return yaml.Marshal(properties.nested())
+}
 
+func ensureOutputDirectory(outputDirectory string) error {
+	if outputDirectory == "" {
+		return nil
+	}
+	if err := os.MkdirAll(outputDirectory, 0755); err != nil {
+		return fmt.Errorf("unable to create output directory %s: %v", outputDirectory, err)
+	}
+	return nil
 }
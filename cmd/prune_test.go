@@ -1,6 +1,9 @@
 package cmd
 
 import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -59,3 +62,153 @@ func TestSetProfilePropertyChange(t *testing.T) {
 	assert.EqualValues(t, 1, len(updatedProfile.changes))
 
 }
+
+func TestSplitProfiles(t *testing.T) {
+	assert.EqualValues(t, []string{"dev", "prod"}, SplitProfiles("dev; prod"))
+	assert.EqualValues(t, []string{"dev", "prod", "cloud"}, SplitProfiles("dev;prod,cloud;"))
+	assert.EqualValues(t, 0, len(SplitProfiles(" ; ")))
+}
+
+func TestAddToMatchingValuesSliceWithLists(t *testing.T) {
+	matchingValues := make([]matchingKeys, 0)
+	matchingValues = addToMatchingValuesSlice([]interface{}{"a", "b"}, "dev", matchingValues)
+	matchingValues = addToMatchingValuesSlice([]interface{}{"a", "b"}, "prod", matchingValues)
+	matchingValues = addToMatchingValuesSlice([]interface{}{"b", "a"}, "qa", matchingValues)
+	assert.EqualValues(t, 2, len(matchingValues))
+	assert.EqualValues(t, []string{"dev", "prod"}, matchingValues[0].profileMatches)
+	assert.EqualValues(t, []string{"qa"}, matchingValues[1].profileMatches)
+}
+
+func TestPruneWritesChangeReport(t *testing.T) {
+	appCtx, cleanup := newTestPruner(t, map[string]string{
+		"application.yml":      "name: base\n",
+		"application-dev.yml":  "name: shared\nport: 1\n",
+		"application-prod.yml": "name: shared\nport: 2\n",
+		"application-qa.yml":   "name: shared\nport: 3\n",
+	})
+	defer cleanup()
+
+	assert.Nil(t, appCtx.Prune([]string{"dev", "prod", "qa"}, []string{"application"}))
+
+	content, err := ioutil.ReadFile(filepath.Join(appCtx.Config.OutputDirectory, "pruned-changes.json"))
+	assert.Nil(t, err)
+	report := changeReport{}
+	assert.Nil(t, json.Unmarshal(content, &report))
+
+	actions := make([]string, 0)
+	for _, change := range report.Changes {
+		actions = append(actions, change.Key+" "+change.Action+" "+change.Profile)
+	}
+	assert.EqualValues(t, []string{
+		"name hoist-to-default default",
+		"name delete dev",
+		"name delete prod",
+		"name delete qa",
+		"port conflict default",
+	}, actions)
+
+	hoist := report.Changes[0]
+	assert.EqualValues(t, "application", hoist.Context)
+	assert.EqualValues(t, []string{"dev", "prod", "qa"}, hoist.Profiles)
+	assert.EqualValues(t, "base", hoist.OldValue)
+	assert.EqualValues(t, "shared", hoist.NewValue)
+	assert.Contains(t, hoist.Source, "application.yml")
+	assert.Contains(t, report.Changes[1].Source, "application-dev.yml")
+	assert.EqualValues(t, map[string]interface{}{"dev": 1.0, "prod": 2.0, "qa": 3.0}, report.Changes[4].Values)
+}
+
+func TestPruneOutputFormats(t *testing.T) {
+	appCtx, cleanup := newTestPruner(t, map[string]string{
+		"application.yml":            "server:\n  port: 8080\n",
+		"application-dev.properties": "# dev\nname=shared\nurl=jdbc:h2:mem\n",
+		"application-prod.yml":       "name: shared\nmessage: \"a: b\\nline two\"\n",
+	})
+	defer cleanup()
+	out := appCtx.Config.OutputDirectory
+
+	appCtx.Config.OutputFormat = SameAsInputFormat
+	assert.Nil(t, appCtx.Prune([]string{"dev", "prod"}, []string{"application"}))
+	assertOutput(t, out, "application-default-pruned.yml", "server:\n  port: 8080\nname: shared\n")
+	assertOutput(t, out, "application-dev-pruned.properties", "# dev\nurl=jdbc:h2:mem\n")
+	assertOutput(t, out, "application-prod-pruned.yml", "message: \"a: b\\nline two\"\n")
+
+	appCtx.Config.OutputFormat = PropertiesOutputFormat
+	assert.Nil(t, appCtx.Prune([]string{"dev", "prod"}, []string{"application"}))
+	assertOutput(t, out, "application-default-pruned.properties", "server.port=8080\nname=shared\n")
+	assertOutput(t, out, "application-prod-pruned.properties", "message=a\\: b\\nline two\n")
+
+	appCtx.Config.OutputLayout = MultiDocumentLayout
+	assert.Nil(t, appCtx.Prune([]string{"dev", "prod"}, []string{"application"}))
+	assertOutput(t, out, "application-pruned.properties", "server.port=8080\nname=shared\n"+
+		"#---\n# dev\nurl=jdbc:h2:mem\nspring.config.activate.on-profile=dev\n"+
+		"#---\nspring.config.activate.on-profile=prod\nmessage=a\\: b\\nline two\n")
+}
+
+func assertOutput(t *testing.T, outputDirectory string, name string, expected string) {
+	content, err := ioutil.ReadFile(filepath.Join(outputDirectory, name))
+	assert.Nil(t, err)
+	assert.Equal(t, expected, string(content), name)
+}
+
+func TestHoistStrategies(t *testing.T) {
+	appCtx, cleanup := newTestPruner(t, map[string]string{
+		"application.yml":       "timeout: 30\n",
+		"application-dev.yml":   "timeout: 60\npool: 10\nregion: eu\ncache: on\n",
+		"application-qa.yml":    "timeout: 60\npool: 10\nregion: eu\ncache: on\n",
+		"application-stage.yml": "timeout: 60\npool: 10\ncache: off\n",
+		"application-prod.yml":  "pool: 20\ncache: off\n",
+	})
+	defer cleanup()
+	profiles := []string{"dev", "qa", "stage", "prod"}
+	actions := func() map[string]string {
+		_, changes, err := appCtx.intersectProfileAndContext(profiles, "application")
+		assert.Nil(t, err)
+		found := make(map[string]string)
+		for _, change := range changes {
+			found[change.key] += change.profile + " " + change.action + ";"
+		}
+		return found
+	}
+
+	// prod inherited a timeout of 30, so it keeps it once 60 is hoisted; region is not hoisted as prod does not set it
+	appCtx.Config.HoistStrategy = MajorityHoisting
+	assert.Equal(t, map[string]string{
+		"timeout": "default hoist-to-default;dev delete;qa delete;stage delete;prod override;",
+		"pool":    "default hoist-to-default;dev delete;qa delete;stage delete;",
+	}, actions())
+	_, changes, _ := appCtx.intersectProfileAndContext(profiles, "application")
+	assert.EqualValues(t, 30, changeFor(changes, "timeout", "prod").newValue)
+
+	appCtx.Config.HoistStrategy = StrictHoisting
+	assert.Equal(t, map[string]string{}, actions())
+
+	appCtx.Config.HoistStrategy = ThresholdHoisting
+	appCtx.Config.HoistThreshold = 50
+	assert.Equal(t, "default hoist-to-default;dev delete;qa delete;", actions()["cache"])
+	appCtx.Config.HoistThreshold = 0
+	_, _, err := appCtx.intersectProfileAndContext(profiles, "application")
+	assert.EqualError(t, err, "hoist_threshold must be a percentage between 1 and 100, not 0")
+
+	// the default profile keeps its values when it is pruned along with the others
+	appCtx.Config.HoistStrategy = MajorityHoisting
+	profiles = append(profiles, defaultProfileKey)
+	assert.Equal(t, map[string]string{}, actions())
+}
+
+func TestPruneKeepsProfilesThatAreNotPruned(t *testing.T) {
+	appCtx, cleanup := newTestPruner(t, map[string]string{
+		"application.yml":      "name: base\nport: 8080\n",
+		"application-dev.yml":  "name: shared\nport: 8080\n",
+		"application-prod.yml": "name: shared\n",
+		"application-qa.yml":   "debug: true\n",
+	})
+	defer cleanup()
+
+	// qa inherits name from the default profile, so hoisting shared would change it
+	_, changes, err := appCtx.intersectProfileAndContext([]string{"dev", "prod"}, "application")
+	assert.Nil(t, err)
+	conflict := changeFor(changes, "name", defaultProfileKey)
+	assert.EqualValues(t, conflictAction, conflict.action)
+	assert.EqualValues(t, []string{"qa"}, conflict.profiles)
+	assert.EqualValues(t, deleteAction, changeFor(changes, "port", "dev").action)
+}
@@ -0,0 +1,274 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/gkontos/bivalve-chronicles"
+
+	"github.com/gkontos/spiny-dogfish/config"
+	"github.com/gkontos/spiny-dogfish/model"
+)
+
+const (
+	backupManifestName    = "manifest.json"
+	backupTimestampFormat = "20060102-150405.000000000"
+	rolledBackSuffix      = "-rolled-back"
+)
+
+// backupEntry records a single file touched by an in-place prune
+type backupEntry struct {
+	Original string `json:"original"`
+	// Backup is the copy of the original file; it is empty when the file did not exist before the prune
+	Backup  string `json:"backup,omitempty"`
+	Existed bool   `json:"existed"`
+}
+
+// backupManifest lists every file an in-place prune touched so that it can be rolled back
+type backupManifest struct {
+	Created string        `json:"created"`
+	Files   []backupEntry `json:"files"`
+}
+
+// backupSession copies files into a timestamped directory before they are rewritten
+type backupSession struct {
+	directory string
+	manifest  backupManifest
+}
+
+// inPlaceTarget is the original file that a pruned profile is written back to
+type inPlaceTarget struct {
+	path       string
+	configType string
+	// source is the original file; it is nil when the profile has no file and a new one is created
+	source *model.JavaConfigFileMetadata
+}
+
+func newBackupSession(backupDirectory string, now time.Time) (*backupSession, error) {
+	if backupDirectory == "" {
+		backupDirectory = config.DefaultBackupDirectory
+	}
+	if err := os.MkdirAll(backupDirectory, 0755); err != nil {
+		return nil, fmt.Errorf("unable to create backup directory %s: %v", backupDirectory, err)
+	}
+	// sessions are named to the nanosecond, and a session that already exists is never reused, so that two prunes
+	// never share a manifest
+	directory := filepath.Join(backupDirectory, now.Format(backupTimestampFormat))
+	if err := os.Mkdir(directory, 0755); err != nil {
+		return nil, fmt.Errorf("unable to create backup directory %s: %v", directory, err)
+	}
+	log.Infof("Backing up original files to %s", directory)
+	return &backupSession{directory: directory, manifest: backupManifest{Created: now.Format(time.RFC3339), Files: make([]backupEntry, 0)}}, nil
+}
+
+// save will copy the original file into the backup directory before it is changed
+func (b *backupSession) save(original string) error {
+	entry := backupEntry{Original: original}
+	data, err := ioutil.ReadFile(original)
+	if err == nil {
+		entry.Existed = true
+		entry.Backup = filepath.Join(b.directory, fmt.Sprintf("%03d-%s", len(b.manifest.Files), filepath.Base(original)))
+		if err := ioutil.WriteFile(entry.Backup, data, 0644); err != nil {
+			return fmt.Errorf("unable to back up %s: %v", original, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return fmt.Errorf("unable to back up %s: %v", original, err)
+	}
+	b.manifest.Files = append(b.manifest.Files, entry)
+	return nil
+}
+
+// close will write the manifest that rollback reads
+func (b *backupSession) close() error {
+	data, err := json.MarshalIndent(b.manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(b.directory, backupManifestName), data, 0644)
+}
+
+// inPlaceTargets will find the original file for each pruned profile.  A profile must come from exactly one single
+// document file to be rewritten; a profile without a file gets a new file, in the output format, at the root of
+// src/main/resources
+func (env *Pruner) inPlaceTargets(profileProperties []profilePropertyPruner, context string) (map[string]inPlaceTarget, error) {
+	targets := make(map[string]inPlaceTarget)
+	problems := make([]string, 0)
+	for _, properties := range profileProperties {
+		sources := properties.sources
+		switch {
+		case len(sources) == 0:
+			name := context
+			if properties.profile != defaultProfileKey {
+				name = context + "-" + properties.profile
+			}
+			configType := profileConfigType(properties, env.Config.OutputFormat)
+			targets[properties.profile] = inPlaceTarget{path: filepath.Join(env.Config.ProjectRoot, javaClasspathResourcePath, name+"."+configType), configType: configType}
+		case len(sources) > 1:
+			paths := make([]string, 0, len(sources))
+			for _, source := range sources {
+				paths = append(paths, source.Path)
+			}
+			problems = append(problems, fmt.Sprintf("the %s profile is defined in more than one place: %s", properties.profile, strings.Join(paths, ", ")))
+		default:
+			documents, err := readDocuments(sources[0])
+			if err != nil {
+				return nil, err
+			}
+			if len(documents) > 1 {
+				problems = append(problems, fmt.Sprintf("the %s profile comes from the multi-document file %s", properties.profile, sources[0].Path))
+				continue
+			}
+			source := sources[0]
+			targets[properties.profile] = inPlaceTarget{path: source.Path, configType: source.ConfigurationType, source: &source}
+		}
+	}
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("unable to rewrite the %s files in place: %s", context, strings.Join(problems, "; "))
+	}
+	return targets, nil
+}
+
+// writeInPlace will back up and rewrite the original file of each profile in its original format.  Files left with
+// no properties are deleted
+func writeInPlace(profileProperties []profilePropertyPruner, targets map[string]inPlaceTarget, backup *backupSession) error {
+	for _, properties := range sortedByProfile(profileProperties) {
+		target := targets[properties.profile]
+		content, err := plannedContent(properties, target)
+		if err != nil {
+			return err
+		}
+		if _, err := os.Stat(target.path); content == nil && os.IsNotExist(err) {
+			continue
+		}
+		if err := backup.save(target.path); err != nil {
+			return err
+		}
+		if content == nil {
+			if err := os.Remove(target.path); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("unable to delete %s: %v", target.path, err)
+			}
+			log.Infof("Deleted %s, no properties remain", target.path)
+			continue
+		}
+		if err := ioutil.WriteFile(target.path, content, 0644); err != nil {
+			return fmt.Errorf("unable to write %s: %v", target.path, err)
+		}
+		log.Infof("Rewrote %s", target.path)
+	}
+	return nil
+}
+
+// plannedContent will render the pruned profile the way it is written to the target: an edit of the original file
+// that keeps its comments and order, or a new file.  A nil result means the target is left with no properties and
+// is deleted
+func plannedContent(properties profilePropertyPruner, target inPlaceTarget) ([]byte, error) {
+	if target.source == nil {
+		if properties.properties.len() == 0 {
+			return nil, nil
+		}
+		content, err := formatConfigFile(properties.properties, target.configType)
+		if err != nil {
+			return nil, fmt.Errorf("unable to format %s: %v", target.path, err)
+		}
+		return content, nil
+	}
+	content, err := editConfigFile(*target.source, properties.changes)
+	if err == errNotEditable {
+		log.Infof("The layout of %s can not be kept, rewriting it without its comments", target.path)
+		content, err = formatConfigFile(properties.properties, target.configType)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to format %s: %v", target.path, err)
+	}
+	if empty, err := isEmptyConfig(content, target.configType); err != nil {
+		return nil, fmt.Errorf("unable to read the pruned %s: %v", target.path, err)
+	} else if empty {
+		return nil, nil
+	}
+	return content, nil
+}
+
+// RunRollback will prompt for a backup and restore the files it holds
+func (env *Pruner) RunRollback() {
+	session, err := promptOptionalString("Backup to restore (blank for the most recent)")
+	if err != nil {
+		log.Errorf("Error: %v", err)
+		return
+	}
+	if err := Rollback(env.Config.BackupDirectory, session); err != nil {
+		log.Errorf("Error: %v", err)
+	}
+}
+
+// Rollback will restore the files changed by an in-place prune from a backup.  An empty session selects the most
+// recent backup that has not already been rolled back
+func Rollback(backupDirectory string, session string) error {
+	if backupDirectory == "" {
+		backupDirectory = config.DefaultBackupDirectory
+	}
+	if session == "" {
+		latest, err := latestBackupSession(backupDirectory)
+		if err != nil {
+			return err
+		}
+		session = latest
+	}
+	directory := filepath.Join(backupDirectory, session)
+	data, err := ioutil.ReadFile(filepath.Join(directory, backupManifestName))
+	if err != nil {
+		return fmt.Errorf("unable to read backup %s: %v", directory, err)
+	}
+	manifest := backupManifest{}
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return fmt.Errorf("unable to read backup %s: %v", directory, err)
+	}
+	// the entries are restored last first, so a file backed up more than once ends with its original content
+	for i := len(manifest.Files) - 1; i >= 0; i-- {
+		entry := manifest.Files[i]
+		if !entry.Existed {
+			if err := os.Remove(entry.Original); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("unable to remove %s: %v", entry.Original, err)
+			}
+			log.Infof("Removed %s", entry.Original)
+			continue
+		}
+		content, err := ioutil.ReadFile(entry.Backup)
+		if err != nil {
+			return fmt.Errorf("unable to read backup of %s: %v", entry.Original, err)
+		}
+		if err := ioutil.WriteFile(entry.Original, content, 0644); err != nil {
+			return fmt.Errorf("unable to restore %s: %v", entry.Original, err)
+		}
+		log.Infof("Restored %s", entry.Original)
+	}
+	return os.Rename(directory, directory+rolledBackSuffix)
+}
+
+// latestBackupSession will return the most recent session below the backup directory that has not been rolled back
+func latestBackupSession(backupDirectory string) (string, error) {
+	entries, err := ioutil.ReadDir(backupDirectory)
+	if err != nil {
+		return "", fmt.Errorf("unable to read backups in %s: %v", backupDirectory, err)
+	}
+	sessions := make([]string, 0)
+	for _, entry := range entries {
+		if !entry.IsDir() || strings.HasSuffix(entry.Name(), rolledBackSuffix) {
+			continue
+		}
+		// the backups of each service are kept in a directory of their own next to the sessions of a share
+		if _, err := os.Stat(filepath.Join(backupDirectory, entry.Name(), backupManifestName)); err == nil {
+			sessions = append(sessions, entry.Name())
+		}
+	}
+	if len(sessions) == 0 {
+		return "", fmt.Errorf("no backups to roll back in %s", backupDirectory)
+	}
+	sort.Strings(sessions)
+	return sessions[len(sessions)-1], nil
+}
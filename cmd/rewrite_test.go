@@ -0,0 +1,244 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormatPropertiesRoundTrip(t *testing.T) {
+	properties := newPropertySet()
+	properties.set(property{name: "greeting", value: " hello = world: ünïcode 😀"})
+	properties.set(property{name: "path", value: `C:\temp` + "\n#next"})
+	properties.set(property{name: "servers", value: []interface{}{"a", "b"}})
+	properties.set(property{name: "!odd key", value: "#value"})
+
+	formatted := formatProperties(properties)
+	assert.Contains(t, string(formatted), "servers[1]=b\n")
+
+	parsed := parsePropertiesDocument(t, formatted, "round-trip.properties")
+	for _, key := range properties.keys() {
+		original, _ := properties.get(key)
+		read, ok := parsed.get(key)
+		assert.True(t, ok, key)
+		assert.True(t, valuesEqual(original.value, read.value), "%s: %v != %v", key, original.value, read.value)
+	}
+}
+
+func TestPruneInPlaceAndRollback(t *testing.T) {
+	appCtx, cleanup := newTestPruner(t, map[string]string{
+		"application.yml":            "server:\n  port: 8080\n",
+		"application-dev.properties": "name=shared\nserver.port=8080\n",
+		"application-prod.yml":       "name: shared\n",
+	})
+	defer cleanup()
+	appCtx.Config.InPlace = true
+	appCtx.Config.BackupDirectory = filepath.Join(appCtx.Config.ProjectRoot, "backups")
+	resources := filepath.Join(appCtx.Config.ProjectRoot, javaClasspathResourcePath)
+
+	assert.Nil(t, appCtx.Prune([]string{"dev", "prod"}, []string{"application"}))
+
+	defaultFile, err := ioutil.ReadFile(filepath.Join(resources, "application.yml"))
+	assert.Nil(t, err)
+	assert.Contains(t, string(defaultFile), "name: shared")
+	_, err = os.Stat(filepath.Join(resources, "application-dev.properties"))
+	assert.True(t, os.IsNotExist(err), "files left empty are deleted")
+	_, err = os.Stat(filepath.Join(resources, "application-prod.yml"))
+	assert.True(t, os.IsNotExist(err), "files left empty are deleted")
+
+	assert.Nil(t, Rollback(appCtx.Config.BackupDirectory, ""))
+	restored, err := ioutil.ReadFile(filepath.Join(resources, "application-dev.properties"))
+	assert.Nil(t, err)
+	assert.Equal(t, "name=shared\nserver.port=8080\n", string(restored))
+	defaultFile, err = ioutil.ReadFile(filepath.Join(resources, "application.yml"))
+	assert.Nil(t, err)
+	assert.Equal(t, "server:\n  port: 8080\n", string(defaultFile))
+
+	assert.NotNil(t, Rollback(appCtx.Config.BackupDirectory, ""), "a backup is only rolled back once")
+}
+
+func TestRollbackRestoresFileBackedUpTwice(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rollback")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	backups := filepath.Join(dir, "backups")
+	original := filepath.Join(dir, "application.yml")
+	assert.Nil(t, ioutil.WriteFile(original, []byte("name: original\n"), 0644))
+
+	now := time.Now()
+	session, err := newBackupSession(backups, now)
+	assert.Nil(t, err)
+	_, err = newBackupSession(backups, now)
+	assert.NotNil(t, err, "a session is never reused")
+	other, err := newBackupSession(backups, now.Add(time.Nanosecond))
+	assert.Nil(t, err)
+	assert.NotEqual(t, session.directory, other.directory)
+
+	assert.Nil(t, session.save(original))
+	assert.Nil(t, ioutil.WriteFile(original, []byte("name: first\n"), 0644))
+	assert.Nil(t, session.save(original))
+	assert.Nil(t, ioutil.WriteFile(original, []byte("name: second\n"), 0644))
+	assert.Nil(t, session.close())
+
+	assert.Nil(t, Rollback(backups, filepath.Base(session.directory)))
+	restored, err := ioutil.ReadFile(original)
+	assert.Nil(t, err)
+	assert.Equal(t, "name: original\n", string(restored))
+}
+
+func TestRollbackSkipsServiceBackups(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rollback")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	backups := filepath.Join(dir, "backups")
+	shared := filepath.Join(dir, "application.yml")
+	service := filepath.Join(dir, "orders.yml")
+	assert.Nil(t, ioutil.WriteFile(shared, []byte("shared: original\n"), 0644))
+	assert.Nil(t, ioutil.WriteFile(service, []byte("orders: original\n"), 0644))
+
+	// a share backs up to the backup directory and each service to a directory named after it below it
+	share, err := newBackupSession(backups, time.Now())
+	assert.Nil(t, err)
+	assert.Nil(t, share.save(shared))
+	assert.Nil(t, share.close())
+	orders, err := newBackupSession(filepath.Join(backups, "orders"), time.Now())
+	assert.Nil(t, err)
+	assert.Nil(t, orders.save(service))
+	assert.Nil(t, orders.close())
+	assert.Nil(t, ioutil.WriteFile(shared, []byte("shared: changed\n"), 0644))
+	assert.Nil(t, ioutil.WriteFile(service, []byte("orders: changed\n"), 0644))
+
+	assert.Nil(t, Rollback(backups, ""))
+	restored, err := ioutil.ReadFile(shared)
+	assert.Nil(t, err)
+	assert.Equal(t, "shared: original\n", string(restored))
+	unchanged, err := ioutil.ReadFile(service)
+	assert.Nil(t, err)
+	assert.Equal(t, "orders: changed\n", string(unchanged), "a service backup is only restored with its own directory")
+
+	assert.Nil(t, Rollback(filepath.Join(backups, "orders"), ""))
+	restored, err = ioutil.ReadFile(service)
+	assert.Nil(t, err)
+	assert.Equal(t, "orders: original\n", string(restored))
+}
+
+func TestPruneInPlaceRefusesProfileFromSeveralFiles(t *testing.T) {
+	appCtx, cleanup := newTestPruner(t, map[string]string{
+		"application-dev.yml":        "name: yml\n",
+		"application-dev.properties": "name=properties\n",
+		"application-prod.yml":       "name: prod\n",
+	})
+	defer cleanup()
+	appCtx.Config.InPlace = true
+	appCtx.Config.BackupDirectory = filepath.Join(appCtx.Config.ProjectRoot, "backups")
+
+	err := appCtx.Prune([]string{"dev", "prod"}, []string{"application"})
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "more than one place")
+	_, err = os.Stat(appCtx.Config.BackupDirectory)
+	assert.True(t, os.IsNotExist(err), "nothing is backed up or written when a target is ambiguous")
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	original := splitLines([]byte("a\nb\nc\nd\ne\nf\ng\nh\ni\nj\n"))
+	updated := splitLines([]byte("a\nB\nc\nd\ne\nf\ng\nh\ni\nj\nk"))
+	assert.Equal(t, "@@ -1,5 +1,5 @@\n a\n-b\n+B\n c\n d\n e\n"+
+		"@@ -8,3 +8,4 @@\n h\n i\n j\n+k\n\\ No newline at end of file\n", unifiedDiff(original, updated, 3))
+
+	assert.Equal(t, "@@ -0,0 +1,1 @@\n+a\n", unifiedDiff(nil, splitLines([]byte("a\n")), 3))
+	assert.Equal(t, "@@ -1,1 +0,0 @@\n-a\n", unifiedDiff(splitLines([]byte("a\n")), nil, 3))
+}
+
+func TestPruneDryRunOnlyWritesPatch(t *testing.T) {
+	appCtx, cleanup := newTestPruner(t, map[string]string{
+		"application.yml":            "server:\n  port: 8080\n",
+		"application-dev.properties": "name=shared\nserver.port=8080\n",
+		"application-prod.yml":       "name: shared\nlevel: info\n",
+	})
+	defer cleanup()
+	appCtx.Config.DryRun = true
+	appCtx.Config.InPlace = true
+	resources := filepath.Join(appCtx.Config.ProjectRoot, javaClasspathResourcePath)
+
+	assert.Nil(t, appCtx.Prune([]string{"dev", "prod"}, []string{"application"}))
+
+	patch, err := ioutil.ReadFile(filepath.Join(appCtx.Config.OutputDirectory, patchFileName))
+	assert.Nil(t, err)
+	assert.Contains(t, string(patch), "diff --git a/src/main/resources/application-dev.properties b/src/main/resources/application-dev.properties\n"+
+		"deleted file mode 100644\n--- a/src/main/resources/application-dev.properties\n+++ /dev/null\n@@ -1,2 +0,0 @@\n-name=shared\n-server.port=8080\n")
+	assert.Contains(t, string(patch), "+name: shared\n")
+	assert.Contains(t, string(patch), "-name: shared\n level: info\n")
+
+	unchanged, err := ioutil.ReadFile(filepath.Join(resources, "application-dev.properties"))
+	assert.Nil(t, err)
+	assert.Equal(t, "name=shared\nserver.port=8080\n", string(unchanged))
+	entries, err := ioutil.ReadDir(appCtx.Config.OutputDirectory)
+	assert.Nil(t, err)
+	assert.Len(t, entries, 1, "a dry run writes nothing but the patch")
+}
+
+func TestPruneDryRunDiffsOutputFiles(t *testing.T) {
+	appCtx, cleanup := newTestPruner(t, map[string]string{
+		"application.yml":              "server:\n  port: 8080\n",
+		"application-dev.yml":          "# dev\nname: shared\nlevel: debug\n",
+		"external/application-dev.yml": "level: trace\n",
+		"application-prod.yml":         "name: shared\nlevel: info\n",
+	})
+	defer cleanup()
+	appCtx.Config.DryRun = true
+	out := appCtx.Config.OutputDirectory
+
+	assert.Nil(t, appCtx.Prune([]string{"dev", "prod"}, []string{"application"}), "a profile from several files is diffed too")
+	patch, err := ioutil.ReadFile(filepath.Join(out, patchFileName))
+	assert.Nil(t, err)
+	assert.Contains(t, string(patch), "diff --git a/src/main/resources/application-prod.yml b/out/application-prod-pruned.yml\n"+
+		"copy from src/main/resources/application-prod.yml\ncopy to out/application-prod-pruned.yml\n")
+	assert.Contains(t, string(patch), "--- /dev/null\n+++ b/out/application-dev-pruned.yml\n")
+
+	git, err := exec.LookPath("git")
+	if err != nil {
+		t.Skip("git is needed to apply the patch")
+	}
+	apply := exec.Command(git, "apply", filepath.Join(out, patchFileName))
+	apply.Dir = appCtx.Config.ProjectRoot
+	output, err := apply.CombinedOutput()
+	assert.Nil(t, err, string(output))
+	applied := make(map[string]string)
+	for _, name := range []string{"application-default-pruned.yml", "application-dev-pruned.yml", "application-prod-pruned.yml"} {
+		content, err := ioutil.ReadFile(filepath.Join(out, name))
+		assert.Nil(t, err, name)
+		applied[name] = string(content)
+	}
+
+	appCtx.Config.DryRun = false
+	assert.Nil(t, appCtx.Prune([]string{"dev", "prod"}, []string{"application"}))
+	for name, content := range applied {
+		assertOutput(t, out, name, content)
+	}
+}
+
+func TestPatchRootHoldsExternalFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "patch")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	projectRoot := filepath.Join(dir, "orders")
+	diffs := []fileDiff{
+		{path: filepath.Join(projectRoot, "src/main/resources/application.yml"), original: []byte("a: 1\n"), existed: true},
+		{path: filepath.Join(dir, "config-repo", "application.yml"), updated: []byte("a: 1\n")},
+	}
+
+	assert.Equal(t, dir, patchRoot(projectRoot, diffs))
+	patch := formatPatch(diffs)
+	assert.Contains(t, patch, "diff --git a/orders/src/main/resources/application.yml b/orders/src/main/resources/application.yml\n")
+	assert.Contains(t, patch, "--- /dev/null\n+++ b/config-repo/application.yml\n")
+	assert.NotContains(t, patch, "../")
+
+	inside := []fileDiff{{path: filepath.Join(projectRoot, "src/main/resources/application.yml")}}
+	assert.Equal(t, projectRoot, patchRoot(projectRoot, inside), "the project root is kept when every file is below it")
+	assert.Equal(t, "src/main/resources/application.yml", inside[0].path)
+}
@@ -0,0 +1,181 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	log "github.com/gkontos/bivalve-chronicles"
+
+	"github.com/gkontos/spiny-dogfish/config"
+	"github.com/gkontos/spiny-dogfish/model"
+)
+
+// skippedPath is a file or directory that a scan passed over
+type skippedPath struct {
+	path   string
+	reason string
+}
+
+// scanSummary records everything a directory scan discovered and everything it skipped
+type scanSummary struct {
+	root       string
+	discovered []model.JavaConfigFileMetadata
+	skipped    []skippedPath
+}
+
+// directoryScanner walks a configuration directory using the scan settings from config.toml
+type directoryScanner struct {
+	settings config.Scan
+	summary  *scanSummary
+	// visited holds the resolved path of each directory already walked so symlink loops are not followed
+	visited map[string]bool
+	// classify describes a file found in relativeDir as a configuration file, or returns the reason it is not one
+	classify func(dir string, relativeDir string, fileName string) (model.JavaConfigFileMetadata, string)
+}
+
+// scanDirectory will walk every subdirectory of root and return the spring configuration files found
+func scanDirectory(root string, settings config.Scan) *scanSummary {
+	return scanWith(root, settings, func(dir string, relativeDir string, fileName string) (model.JavaConfigFileMetadata, string) {
+		return configFileMetadata(dir, fileName)
+	})
+}
+
+func scanWith(root string, settings config.Scan, classify func(string, string, string) (model.JavaConfigFileMetadata, string)) *scanSummary {
+	scanner := &directoryScanner{
+		settings: settings,
+		summary:  &scanSummary{root: root, discovered: make([]model.JavaConfigFileMetadata, 0), skipped: make([]skippedPath, 0)},
+		visited:  make(map[string]bool),
+		classify: classify,
+	}
+	info, err := os.Stat(root)
+	if err != nil {
+		scanner.skip(root, fmt.Sprintf("unable to read directory: %v", err))
+		return scanner.summary
+	}
+	if !info.IsDir() {
+		scanner.skip(root, "not a directory")
+		return scanner.summary
+	}
+	scanner.walk(root, "", 0)
+	return scanner.summary
+}
+
+func (s *directoryScanner) walk(dir string, relativeDir string, depth int) {
+	if resolved, err := filepath.EvalSymlinks(dir); err == nil {
+		if s.visited[resolved] {
+			s.skip(dir, "directory already scanned through another path")
+			return
+		}
+		s.visited[resolved] = true
+	}
+	log.Debugf("Scanning directory %s ", dir)
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		s.skip(dir, fmt.Sprintf("unable to read directory: %v", err))
+		return
+	}
+	for _, entry := range entries {
+		fullPath := dir + "/" + entry.Name()
+		relativePath := path.Join(relativeDir, entry.Name())
+
+		if pattern, excluded := matchAny(s.settings.Exclude, relativePath); excluded {
+			s.skip(fullPath, fmt.Sprintf("excluded by pattern %q", pattern))
+			continue
+		}
+
+		if entry.Mode()&os.ModeSymlink != 0 {
+			if !s.settings.FollowSymlinks {
+				s.skip(fullPath, "symlink not followed")
+				continue
+			}
+			target, err := os.Stat(fullPath)
+			if err != nil {
+				s.skip(fullPath, fmt.Sprintf("broken symlink: %v", err))
+				continue
+			}
+			entry = target
+		}
+
+		if entry.IsDir() {
+			if s.settings.MaxDepth > 0 && depth+1 > s.settings.MaxDepth {
+				s.skip(fullPath, fmt.Sprintf("deeper than max_depth %d", s.settings.MaxDepth))
+				continue
+			}
+			s.walk(fullPath, relativePath, depth+1)
+			continue
+		}
+
+		if len(s.settings.Include) > 0 {
+			if _, included := matchAny(s.settings.Include, relativePath); !included {
+				s.skip(fullPath, "not matched by an include pattern")
+				continue
+			}
+		}
+
+		configFile, reason := s.classify(dir, relativeDir, entry.Name())
+		configFile.Location = relativeDir
+		if reason != "" {
+			s.skip(fullPath, reason)
+			continue
+		}
+		s.summary.discovered = append(s.summary.discovered, configFile)
+	}
+}
+
+func (s *directoryScanner) skip(path string, reason string) {
+	s.summary.skipped = append(s.summary.skipped, skippedPath{path: path, reason: reason})
+}
+
+// configFileMetadata will describe a file as a spring configuration file, or return the reason it is not one
+func configFileMetadata(dir string, fileName string) (model.JavaConfigFileMetadata, string) {
+	configFile := model.JavaConfigFileMetadata{}
+	extension := strings.TrimPrefix(filepath.Ext(fileName), ".")
+	if _, found := Find(fileTypes, extension); !found {
+		return configFile, "unsupported file type"
+	}
+	baseName := strings.TrimSuffix(fileName, "."+extension)
+	// profile names may themselves contain dashes, so only the first dash separates the context from the profile
+	fileNameParts := strings.SplitN(baseName, "-", 2)
+	if _, isJavaConfig := Find(fileNames, fileNameParts[0]); !isJavaConfig {
+		return configFile, "not an application or bootstrap file"
+	}
+	configFile.ConfigurationType = extension
+	configFile.Path = dir + "/" + fileName
+	if len(fileNameParts) > 1 && fileNameParts[1] != "" {
+		configFile.Profile = fileNameParts[1]
+	} else {
+		configFile.Profile = defaultProfileKey
+	}
+	configFile.ApplicationContext = fileNameParts[0]
+	return configFile, ""
+}
+
+// matchAny will return the first glob matching the path.  Globs containing a / are matched against the whole
+// relative path, all others against the final element
+func matchAny(patterns []string, relativePath string) (string, bool) {
+	for _, pattern := range patterns {
+		target := path.Base(relativePath)
+		if strings.Contains(pattern, "/") {
+			target = relativePath
+		}
+		if matched, err := path.Match(pattern, target); err == nil && matched {
+			return pattern, true
+		}
+	}
+	return "", false
+}
+
+// logSummary will report the files a scan found and everything it skipped along with the reason
+func (summary *scanSummary) logSummary() {
+	log.Infof("Scan of %s discovered %d configuration files and skipped %d paths", summary.root, len(summary.discovered), len(summary.skipped))
+	for _, file := range summary.discovered {
+		log.Infof("  found %s (context: %s, profile: %s)", file.Path, file.ApplicationContext, file.Profile)
+	}
+	for _, skipped := range summary.skipped {
+		log.Infof("  skipped %s: %s", skipped.path, skipped.reason)
+	}
+}
@@ -0,0 +1,124 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/gkontos/spiny-dogfish/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func writeTestFiles(t *testing.T, root string, files ...string) {
+	for _, file := range files {
+		fullPath := filepath.Join(root, file)
+		assert.Nil(t, os.MkdirAll(filepath.Dir(fullPath), 0755))
+		assert.Nil(t, ioutil.WriteFile(fullPath, []byte("a: b\n"), 0644))
+	}
+}
+
+func discoveredPaths(root string, summary *scanSummary) []string {
+	paths := make([]string, 0)
+	for _, file := range summary.discovered {
+		relative, _ := filepath.Rel(root, file.Path)
+		paths = append(paths, filepath.ToSlash(relative))
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func skippedReasons(root string, summary *scanSummary) map[string]string {
+	reasons := make(map[string]string)
+	for _, skipped := range summary.skipped {
+		relative, _ := filepath.Rel(root, skipped.path)
+		reasons[filepath.ToSlash(relative)] = skipped.reason
+	}
+	return reasons
+}
+
+func TestScanDirectoryVisitsSiblings(t *testing.T) {
+	root, err := ioutil.TempDir("", "scan")
+	assert.Nil(t, err)
+	defer os.RemoveAll(root)
+	writeTestFiles(t, root,
+		"a/application-dev.yml",
+		"b/application-prod.properties",
+		"b/nested/bootstrap.yml",
+		"application.yml",
+		"application-my-profile.yaml",
+		"logback.xml",
+		"messages.properties",
+	)
+
+	summary := scanDirectory(root, config.Scan{})
+	assert.EqualValues(t, []string{
+		"a/application-dev.yml",
+		"application-my-profile.yaml",
+		"application.yml",
+		"b/application-prod.properties",
+		"b/nested/bootstrap.yml",
+	}, discoveredPaths(root, summary))
+
+	reasons := skippedReasons(root, summary)
+	assert.EqualValues(t, "unsupported file type", reasons["logback.xml"])
+	assert.EqualValues(t, "not an application or bootstrap file", reasons["messages.properties"])
+
+	for _, file := range summary.discovered {
+		if filepath.Base(file.Path) == "application-my-profile.yaml" {
+			assert.EqualValues(t, "my-profile", file.Profile)
+		}
+	}
+}
+
+func TestScanDirectoryFilters(t *testing.T) {
+	root, err := ioutil.TempDir("", "scan")
+	assert.Nil(t, err)
+	defer os.RemoveAll(root)
+	writeTestFiles(t, root,
+		"application.yml",
+		"application-test.yml",
+		"config/application-dev.yml",
+		"config/deep/er/application-qa.yml",
+		"templates/application.yml",
+	)
+
+	summary := scanDirectory(root, config.Scan{Exclude: []string{"templates", "*-test.yml"}, MaxDepth: 2})
+	assert.EqualValues(t, []string{"application.yml", "config/application-dev.yml"}, discoveredPaths(root, summary))
+	reasons := skippedReasons(root, summary)
+	assert.EqualValues(t, `excluded by pattern "templates"`, reasons["templates"])
+	assert.EqualValues(t, `excluded by pattern "*-test.yml"`, reasons["application-test.yml"])
+	assert.EqualValues(t, "deeper than max_depth 2", reasons["config/deep/er"])
+
+	summary = scanDirectory(root, config.Scan{Include: []string{"config/*.yml"}})
+	assert.EqualValues(t, []string{"config/application-dev.yml"}, discoveredPaths(root, summary))
+}
+
+func TestScanDirectorySymlinks(t *testing.T) {
+	root, err := ioutil.TempDir("", "scan")
+	assert.Nil(t, err)
+	defer os.RemoveAll(root)
+	writeTestFiles(t, root, "real/application-dev.yml")
+	if err := os.Symlink(filepath.Join(root, "real"), filepath.Join(root, "linked")); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+	assert.Nil(t, os.Symlink(root, filepath.Join(root, "real", "loop")))
+
+	summary := scanDirectory(root, config.Scan{})
+	assert.EqualValues(t, []string{"real/application-dev.yml"}, discoveredPaths(root, summary))
+	assert.EqualValues(t, "symlink not followed", skippedReasons(root, summary)["linked"])
+
+	// the linked directory is walked first; the real directory and the loop back to the root are not scanned again
+	summary = scanDirectory(root, config.Scan{FollowSymlinks: true})
+	assert.EqualValues(t, []string{"linked/application-dev.yml"}, discoveredPaths(root, summary))
+	reasons := skippedReasons(root, summary)
+	assert.EqualValues(t, "directory already scanned through another path", reasons["real"])
+	assert.EqualValues(t, "directory already scanned through another path", reasons["linked/loop"])
+}
+
+func TestScanDirectoryMissingRoot(t *testing.T) {
+	summary := scanDirectory("/does/not/exist", config.Scan{})
+	assert.EqualValues(t, 0, len(summary.discovered))
+	assert.EqualValues(t, 1, len(summary.skipped))
+}
@@ -0,0 +1,291 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+
+	log "github.com/gkontos/bivalve-chronicles"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	maskedSecret      = "******"
+	secretsReportName = "secrets"
+
+	// values at least this long whose characters are this random are treated as generated keys and tokens
+	secretEntropyMinLength = 20
+	secretEntropyThreshold = 4.0
+	// hex has at most 4 bits per character so a long hex value is held to a lower threshold
+	secretHexMinLength = 32
+	secretHexThreshold = 3.0
+
+	secretKeyReason     = "the key name marks a secret"
+	privateKeyReason    = "the value is a private key"
+	highEntropyReason   = "the value looks like a generated key or token"
+	secretPatchLineKind = "+- "
+)
+
+// secretKeyPatterns are matched against the canonical form of the last element of a key
+var secretKeyPatterns = []string{"password", "passwd", "pwd", "secret", "token", "privatekey", "apikey", "accesskey", "credentials"}
+
+// secretKeyExclusions end key names that mention a secret without holding one, such as token-uri or password-file
+var secretKeyExclusions = []string{"uri", "url", "endpoint", "path", "location", "file", "enabled", "header", "headername",
+	"parameter", "seconds", "timeout", "ttl", "validity", "expiry", "length", "type", "size", "algorithm"}
+
+var (
+	privateKeyRegex = regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----`)
+	hexRegex        = regexp.MustCompile(`^[0-9a-fA-F]+$`)
+	patchEntryRegex = regexp.MustCompile(`^([-+ ]\s*(?:-\s+)?)([^\s:=#!][^:=]*?)(\s*[:=]\s*)(\S.*)$`)
+)
+
+// secretFinding is a property holding a plaintext secret
+type secretFinding struct {
+	property property
+	reason   string
+}
+
+// secretsReport lists the plaintext secrets of every configuration file
+type secretsReport struct {
+	Generated string              `json:"generated" yaml:"generated"`
+	Files     []secretsReportFile `json:"files" yaml:"files"`
+}
+
+type secretsReportFile struct {
+	Path    string               `json:"path" yaml:"path"`
+	Secrets []secretsReportEntry `json:"secrets" yaml:"secrets"`
+}
+
+type secretsReportEntry struct {
+	Key    string `json:"key" yaml:"key"`
+	Line   int    `json:"line,omitempty" yaml:"line,omitempty"`
+	Reason string `json:"reason" yaml:"reason"`
+}
+
+// RunSecrets will list the plaintext secrets in every configuration file
+func (appCtx *Pruner) RunSecrets() {
+	if err := appCtx.Secrets(fileNames); err != nil {
+		log.Errorf("Error: %v", err)
+	}
+}
+
+// Secrets will list the plaintext secrets of every file in the contexts, so they can be moved to a vault or the
+// environment, and write the list to the secrets report.  Values are never shown
+func (appCtx *Pruner) Secrets(contexts []string) error {
+	if _, found := Find(reportFormats, appCtx.Config.ReportFormat); !found && appCtx.Config.ReportFormat != "" {
+		return fmt.Errorf("unknown report format %q, expected one of %s", appCtx.Config.ReportFormat, strings.Join(reportFormats, ", "))
+	}
+	report := secretsReport{Generated: time.Now().Format(time.RFC3339), Files: make([]secretsReportFile, 0)}
+	files := make(map[string]int)
+	total := 0
+	for _, context := range contexts {
+		for _, source := range appCtx.contextSources(context) {
+			properties, err := loadFromFile(source)
+			if err != nil {
+				return err
+			}
+			findings := propertySecrets(properties)
+			if len(findings) == 0 {
+				continue
+			}
+			index, seen := files[source.Path]
+			if !seen {
+				index = len(report.Files)
+				files[source.Path] = index
+				report.Files = append(report.Files, secretsReportFile{Path: source.Path, Secrets: make([]secretsReportEntry, 0)})
+			}
+			for _, finding := range findings {
+				report.Files[index].Secrets = append(report.Files[index].Secrets,
+					secretsReportEntry{Key: finding.property.name, Line: finding.property.line, Reason: finding.reason})
+			}
+			total += len(findings)
+		}
+	}
+
+	for _, file := range report.Files {
+		log.Infof("PLAINTEXT SECRETS IN %s", file.Path)
+		for _, entry := range file.Secrets {
+			log.Infof("    %s (line %d): %s", entry.Key, entry.Line, entry.Reason)
+		}
+	}
+	log.Infof("%d plaintext secrets in %d files", total, len(report.Files))
+	return writeSecretsReport(report, appCtx.Config.OutputDirectory, appCtx.Config.ReportFormat)
+}
+
+func writeSecretsReport(report secretsReport, outputDirectory string, format string) error {
+	if err := ensureOutputDirectory(outputDirectory); err != nil {
+		return err
+	}
+	var (
+		content []byte
+		err     error
+	)
+	fileName := filepath.Join(outputDirectory, secretsReportName+".json")
+	if format == YAMLReportFormat {
+		fileName = filepath.Join(outputDirectory, secretsReportName+".yml")
+		content, err = yaml.Marshal(report)
+	} else {
+		content, err = json.MarshalIndent(report, "", "  ")
+		content = append(content, '\n')
+	}
+	if err != nil {
+		return fmt.Errorf("unable to format the secrets report: %v", err)
+	}
+	if err := ioutil.WriteFile(fileName, content, 0644); err != nil {
+		return fmt.Errorf("unable to write %s: %v", fileName, err)
+	}
+	return nil
+}
+
+// propertySecrets will find the secrets in a property set, looking inside lists and nested maps
+func propertySecrets(properties *propertySet) []secretFinding {
+	findings := make([]secretFinding, 0)
+	for _, key := range properties.keys() {
+		p, _ := properties.get(key)
+		for _, element := range indexedProperties(p) {
+			if reason := secretReason(element.name, element.value); reason != "" {
+				findings = append(findings, secretFinding{property: element, reason: reason})
+			}
+		}
+	}
+	return findings
+}
+
+// secretReason will classify a single value, returning why it is a secret or an empty string when it is not.  A
+// value that only references a placeholder is not a plaintext secret
+func secretReason(name string, value interface{}) string {
+	if value == nil || isContainer(value) {
+		return ""
+	}
+	text := strings.TrimSpace(fmt.Sprint(value))
+	if text == "" || isPlaceholderReference(text) {
+		return ""
+	}
+	if privateKeyRegex.MatchString(text) {
+		return privateKeyReason
+	}
+	if isSecretKey(name) {
+		return secretKeyReason
+	}
+	if _, isText := value.(string); isText && looksGenerated(text) {
+		return highEntropyReason
+	}
+	return ""
+}
+
+// isSecretKey will match the last element of a key against the secret key patterns
+func isSecretKey(name string) bool {
+	elements := strings.Split(canonicalName(name), ".")
+	last := indexedNameRegex.ReplaceAllString(elements[len(elements)-1], "$1")
+	for _, exclusion := range secretKeyExclusions {
+		if strings.HasSuffix(last, exclusion) {
+			return false
+		}
+	}
+	for _, pattern := range secretKeyPatterns {
+		if strings.Contains(last, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+func isPlaceholderReference(text string) bool {
+	return strings.HasPrefix(text, placeholderPrefix) && placeholderEnd(text, 0) == len(text)-1
+}
+
+// looksGenerated will report whether a value is long and random enough to be a generated key or token.  Words,
+// urls and paths are not, and neither is a value without both letters and digits
+func looksGenerated(text string) bool {
+	if len(text) < secretEntropyMinLength || strings.Contains(text, "://") || strings.ContainsAny(text, " \t/") {
+		return false
+	}
+	if !strings.ContainsAny(text, "0123456789") || strings.IndexFunc(text, unicode.IsLetter) < 0 {
+		return false
+	}
+	entropy := shannonEntropy(text)
+	if hexRegex.MatchString(text) {
+		return len(text) >= secretHexMinLength && entropy >= secretHexThreshold
+	}
+	return entropy >= secretEntropyThreshold
+}
+
+// shannonEntropy is the average number of bits per character of text
+func shannonEntropy(text string) float64 {
+	counts := make(map[rune]int)
+	total := 0
+	for _, r := range text {
+		counts[r]++
+		total++
+	}
+	entropy := 0.0
+	for _, count := range counts {
+		frequency := float64(count) / float64(total)
+		entropy -= frequency * math.Log2(frequency)
+	}
+	return entropy
+}
+
+// maskValue will replace every secret within a value, including those in the elements of lists and nested maps
+func maskValue(name string, value interface{}) interface{} {
+	switch v := value.(type) {
+	case []interface{}:
+		masked := make([]interface{}, len(v))
+		for i, element := range v {
+			masked[i] = maskValue(fmt.Sprintf("%s[%d]", name, i), element)
+		}
+		return masked
+	case yaml.MapSlice:
+		masked := make(yaml.MapSlice, len(v))
+		for i, item := range v {
+			masked[i] = yaml.MapItem{Key: item.Key, Value: maskValue(fmt.Sprintf("%s.%v", name, item.Key), item.Value)}
+		}
+		return masked
+	}
+	if secretReason(name, value) != "" {
+		return maskedSecret
+	}
+	return value
+}
+
+// maskSecrets will return a copy of the properties with every secret masked
+func maskSecrets(properties *propertySet) *propertySet {
+	masked := newPropertySet()
+	for _, key := range properties.keys() {
+		p, _ := properties.get(key)
+		p.value = maskValue(p.name, p.value)
+		masked.set(p)
+	}
+	return masked
+}
+
+// displayed is the value of a property as it is shown in logs and reports: masked unless secrets are shown
+func (appCtx *Pruner) displayed(p property) interface{} {
+	if appCtx.Config.ShowSecrets {
+		return p.value
+	}
+	return maskValue(p.name, p.value)
+}
+
+// maskPatch will mask the values of the secret entries in a patch before it is shown.  Only the last element of a
+// nested yaml key is known here, which is enough for the key name patterns
+func maskPatch(patch string) string {
+	lines := strings.Split(patch, "\n")
+	for i, line := range lines {
+		if strings.HasPrefix(line, "+++") || strings.HasPrefix(line, "---") || line == "" || !strings.ContainsAny(line[:1], secretPatchLineKind) {
+			continue
+		}
+		parts := patchEntryRegex.FindStringSubmatch(line)
+		if parts == nil || secretReason(strings.TrimSpace(parts[2]), strings.TrimSpace(parts[4])) == "" {
+			continue
+		}
+		lines[i] = parts[1] + parts[2] + parts[3] + maskedSecret
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,235 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	log "github.com/gkontos/bivalve-chronicles"
+
+	"github.com/gkontos/spiny-dogfish/model"
+)
+
+// sharedContext is the application context the shared file belongs to.  Bootstrap keys are not shared
+const sharedContext = "application"
+
+// sharedKey is a key every service sets to the same value in every profile
+type sharedKey struct {
+	property property
+	// existing is set when the shared file already holds the key with the same value
+	existing bool
+}
+
+// Share will move the keys that every service sets to the same value, in its default profile and in every one of
+// its profiles, out of the services' own files and into the shared file.  Because the value is the same everywhere
+// each service's effective configuration does not change as long as it reads the shared file, from the config
+// server's application.yml or through spring.config.import.  Files are rewritten in place after backing them up,
+// unless this is a dry run, and every change is recorded in the change report
+func (env *Pruner) Share(services []*Pruner) (err error) {
+	if len(services) < 2 {
+		return fmt.Errorf("at least two services are needed to share keys between them")
+	}
+	if _, found := Find(reportFormats, env.Config.ReportFormat); !found && env.Config.ReportFormat != "" {
+		return fmt.Errorf("unknown report format %q, expected one of %s", env.Config.ReportFormat, strings.Join(reportFormats, ", "))
+	}
+	sharedFile, err := env.sharedFileMetadata()
+	if err != nil {
+		return err
+	}
+	existing := newPropertySet()
+	if _, statErr := os.Stat(sharedFile.Path); statErr == nil {
+		documents, err := readDocuments(sharedFile)
+		if err != nil {
+			return err
+		}
+		if len(documents) > 1 {
+			return fmt.Errorf("the shared file %s is a multi-document file", sharedFile.Path)
+		}
+		existing = documents[0]
+	}
+
+	keys, err := sharedKeys(services, existing)
+	if err != nil {
+		return err
+	}
+	results := make([]prunedContext, 0)
+	problems := make([]string, 0)
+	moved := make(map[string]bool)
+	names := make([]string, 0, len(services))
+	for _, service := range services {
+		names = append(names, service.Service)
+	}
+	for _, service := range services {
+		for _, source := range service.projectSources(sharedContext) {
+			properties, err := loadFromFile(source)
+			if err != nil {
+				return err
+			}
+			edits := make(map[string]changeSet)
+			deletions := make([]changeSet, 0)
+			for _, key := range keys {
+				p, ok := properties.get(key.property.name)
+				if !ok {
+					continue
+				}
+				canonical := canonicalName(p.name)
+				edits[canonical] = changeSet{key: p.name, delete: true}
+				deletions = append(deletions, changeSet{key: p.name, action: deleteAction, delete: true, oldValue: p.value,
+					profile: source.Profile, profiles: []string{source.Profile}, source: sourceLocation(p),
+					message: fmt.Sprintf("%s of the %s service is read from the shared file %s", p.name, service.Service, sharedFile.Path)})
+				moved[canonical] = true
+			}
+			if len(edits) == 0 {
+				continue
+			}
+			documents, err := readDocuments(source)
+			if err != nil {
+				return err
+			}
+			if len(documents) > 1 {
+				problems = append(problems, fmt.Sprintf("%s is a multi-document file", source.Path))
+				continue
+			}
+			pruned := profilePropertyPruner{profile: source.Profile, properties: applyChanges(properties, edits), changes: edits,
+				sources: []model.JavaConfigFileMetadata{source}}
+			src := source
+			results = append(results, prunedContext{
+				context:           sharedContext,
+				profileProperties: []profilePropertyPruner{pruned},
+				changes:           deletions,
+				targets:           map[string]inPlaceTarget{source.Profile: {path: source.Path, configType: source.ConfigurationType, source: &src}},
+			})
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("unable to share keys: %s", strings.Join(problems, "; "))
+	}
+
+	// a key that no service writes itself, such as one already read from the config server, is left where it is
+	additions := make(map[string]changeSet)
+	hoists := make([]changeSet, 0)
+	for _, key := range keys {
+		canonical := canonicalName(key.property.name)
+		if !moved[canonical] || key.existing {
+			continue
+		}
+		additions[canonical] = changeSet{key: key.property.name, newValue: key.property.value}
+		hoists = append(hoists, changeSet{key: key.property.name, action: hoistToDefaultAction, newValue: key.property.value,
+			profile: defaultProfileKey, profiles: names,
+			message: fmt.Sprintf("%s is set to %v by every profile of the services %s", key.property.name, maskValue(key.property.name, key.property.value), strings.Join(names, ", "))})
+	}
+	if len(results) == 0 {
+		log.Info("No keys are shared by every service")
+		return nil
+	}
+	if len(additions) > 0 {
+		target := inPlaceTarget{path: sharedFile.Path, configType: sharedFile.ConfigurationType}
+		if _, statErr := os.Stat(sharedFile.Path); statErr == nil {
+			target.source = &sharedFile
+		}
+		shared := profilePropertyPruner{profile: defaultProfileKey, properties: applyChanges(existing, additions), changes: additions}
+		results = append(results, prunedContext{
+			context:           sharedContext,
+			profileProperties: []profilePropertyPruner{shared},
+			changes:           hoists,
+			targets:           map[string]inPlaceTarget{defaultProfileKey: target},
+		})
+	}
+	log.Infof("%d keys are shared by the services %s", len(moved), strings.Join(names, ", "))
+
+	if env.Config.DryRun {
+		return env.previewChanges(results)
+	}
+	backup, err := newBackupSession(env.Config.BackupDirectory, time.Now())
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := backup.close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}()
+	for _, result := range results {
+		if err = writeInPlace(result.profileProperties, result.targets, backup); err != nil {
+			return err
+		}
+	}
+	return outputChangeReport(results, env.Config.OutputDirectory, env.Config.ReportFormat, env.Config.ShowSecrets, time.Now())
+}
+
+// sharedFileMetadata describes the shared file: the configured file, or the config server's application.yml
+func (env *Pruner) sharedFileMetadata() (model.JavaConfigFileMetadata, error) {
+	path := env.Config.SharedFile
+	if path == "" && env.Config.ConfigServer.Directory != "" {
+		path = filepath.Join(env.Config.ConfigServer.Directory, sharedConfigName+".yml")
+	}
+	if path == "" {
+		return model.JavaConfigFileMetadata{}, fmt.Errorf("shared_file must be set when there is no config server directory")
+	}
+	extension := strings.TrimPrefix(filepath.Ext(path), ".")
+	if _, found := Find(fileTypes, extension); !found {
+		return model.JavaConfigFileMetadata{}, fmt.Errorf("the shared file %s must be a yaml or properties file", path)
+	}
+	return model.JavaConfigFileMetadata{ConfigurationType: extension, Path: path, Profile: defaultProfileKey, ApplicationContext: sharedContext}, nil
+}
+
+// sharedKeys will find the keys every service sets to the same value in its default profile and each of its
+// profiles, in the order the first service sets them.  A key the shared file already sets to another value is not
+// shared
+func sharedKeys(services []*Pruner, existing *propertySet) ([]sharedKey, error) {
+	var views []*propertySet
+	for _, service := range services {
+		for _, profile := range service.scopeProfiles(nil) {
+			view, err := service.unionProfileAndContext(profile, sharedContext)
+			if err != nil {
+				return nil, err
+			}
+			views = append(views, view)
+		}
+	}
+	keys := make([]sharedKey, 0)
+	for _, key := range views[0].keys() {
+		first, _ := views[0].get(key)
+		shared := true
+		for _, view := range views[1:] {
+			if p, ok := view.get(key); !ok || !valuesEqual(p.value, first.value) {
+				shared = false
+				break
+			}
+		}
+		if !shared {
+			continue
+		}
+		current, inSharedFile := existing.get(key)
+		if inSharedFile && !valuesEqual(current.value, first.value) {
+			log.Infof("%s is shared by every service but the shared file sets it to %v", first.name, maskValue(first.name, current.value))
+			continue
+		}
+		keys = append(keys, sharedKey{property: first, existing: inSharedFile})
+	}
+	return keys, nil
+}
+
+// projectSources will return the documents of a context from the project's own classpath and external files.
+// Files from a config server are shared with other applications and are not changed for a single service, and
+// files packaged in archives can not be changed at all
+func (env *Pruner) projectSources(context string) []model.JavaConfigFileMetadata {
+	sources := make([]model.JavaConfigFileMetadata, 0)
+	for _, source := range env.contextSources(context) {
+		if !env.isConfigServerFile(source) && !isReadOnly(source) {
+			sources = append(sources, source)
+		}
+	}
+	return sources
+}
+
+func (env *Pruner) isConfigServerFile(source model.JavaConfigFileMetadata) bool {
+	for _, file := range env.ConfigFiles[configServerFileKey] {
+		if file.Path == source.Path {
+			return true
+		}
+	}
+	return false
+}
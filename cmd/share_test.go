@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShareAcrossServices(t *testing.T) {
+	orders, cleanupOrders := newTestPruner(t, map[string]string{
+		"application.yml":      "spring:\n  application:\n    name: orders\n  jackson:\n    time-zone: UTC\nlogging:\n  level:\n    root: INFO\nserver:\n  port: 8080\n",
+		"application-dev.yml":  "logging:\n  level:\n    root: DEBUG\n",
+		"application-prod.yml": "spring:\n  jackson:\n    time-zone: UTC\n",
+	})
+	defer cleanupOrders()
+	billing, cleanupBilling := newTestPruner(t, map[string]string{
+		"application.properties": "spring.application.name=billing\nspring.jackson.time-zone=UTC\nlogging.level.root=INFO\nserver.port=8080\n",
+	})
+	defer cleanupBilling()
+	orders.Service, billing.Service = "orders", "billing"
+
+	sharedDirectory, err := ioutil.TempDir("", "shared")
+	assert.Nil(t, err)
+	defer os.RemoveAll(sharedDirectory)
+	sharedFile := filepath.Join(sharedDirectory, "application.yml")
+	assert.Nil(t, ioutil.WriteFile(sharedFile, []byte("# shared by every service\nserver:\n  port: 9090\n"), 0644))
+
+	env := &Pruner{Config: orders.Config}
+	settings := *orders.Config
+	settings.SharedFile = sharedFile
+	settings.BackupDirectory = filepath.Join(sharedDirectory, "backups")
+	settings.OutputDirectory = filepath.Join(sharedDirectory, "out")
+	env.Config = &settings
+	assert.Nil(t, env.Share([]*Pruner{orders, billing}))
+
+	// logging.level.root differs in dev and server.port is set differently by the shared file, so only the time zone moves
+	assertFileContent(t, orders, "application.yml", "spring:\n  application:\n    name: orders\nlogging:\n  level:\n    root: INFO\nserver:\n  port: 8080\n")
+	_, err = os.Stat(filepath.Join(orders.Config.ProjectRoot, javaClasspathResourcePath, "application-prod.yml"))
+	assert.True(t, os.IsNotExist(err), "a file left without properties is deleted")
+	assertFileContent(t, billing, "application.properties", "spring.application.name=billing\nlogging.level.root=INFO\nserver.port=8080\n")
+	content, err := ioutil.ReadFile(sharedFile)
+	assert.Nil(t, err)
+	assert.Equal(t, "# shared by every service\nserver:\n  port: 9090\nspring:\n  jackson:\n    time-zone: UTC\n", string(content))
+
+	_, err = ioutil.ReadFile(filepath.Join(sharedDirectory, "out", changeReportName+".json"))
+	assert.Nil(t, err)
+	assert.EqualError(t, env.Share([]*Pruner{orders}), "at least two services are needed to share keys between them")
+}
@@ -0,0 +1,153 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	log "github.com/gkontos/bivalve-chronicles"
+)
+
+var sourceDirectories = []string{"src/main/java", "src/main/kotlin"}
+
+var sourceExtensions = []string{".java", ".kt"}
+
+var (
+	stringLiteralRegex         = regexp.MustCompile(`"((?:[^"\\\n]|\\.)*)"`)
+	configurationPropsRegex    = regexp.MustCompile(`(?s)@ConfigurationProperties\(([^)]*)\)`)
+	conditionalOnPropertyRegex = regexp.MustCompile(`(?s)@ConditionalOnProperty\(([^)]*)\)`)
+	environmentCallRegex       = regexp.MustCompile(`\b(?:getProperty|getRequiredProperty|containsProperty)\(\s*"((?:[^"\\]|\\.)*)"`)
+	annotationPrefixRegex      = regexp.MustCompile(`\bprefix\s*=\s*"([^"]*)"`)
+	annotationNamesRegex       = regexp.MustCompile(`\b(?:name|value)\s*=\s*(\{[^}]*\}|\[[^\]]*\]|"[^"]*")`)
+	leadingStringsRegex        = regexp.MustCompile(`^\s*(\{[^}]*\}|\[[^\]]*\]|"[^"]*")`)
+	quotedStringRegex          = regexp.MustCompile(`"([^"]*)"`)
+)
+
+// sourceReference is a place in the application code that reads configuration
+type sourceReference struct {
+	// name is the property name, or the prefix for @ConfigurationProperties, as written in the code
+	name string
+	// prefix is set when every property below name is bound
+	prefix bool
+	source string
+	line   int
+}
+
+// scanSourceReferences will collect the property names read by the java and kotlin code below the project root
+func scanSourceReferences(projectRoot string) ([]sourceReference, error) {
+	references := make([]sourceReference, 0)
+	for _, directory := range sourceDirectories {
+		root := filepath.Join(projectRoot, directory)
+		if _, err := os.Stat(root); os.IsNotExist(err) {
+			continue
+		}
+		err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() {
+				return nil
+			}
+			if _, found := Find(sourceExtensions, filepath.Ext(path)); !found {
+				return nil
+			}
+			content, err := ioutil.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			references = append(references, sourceFileReferences(string(content), path)...)
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("unable to scan %s: %v", root, err)
+		}
+	}
+	log.Debugf("found %d configuration references in source", len(references))
+	return references, nil
+}
+
+// sourceFileReferences will find the configuration read by a single source file
+func sourceFileReferences(content string, source string) []sourceReference {
+	// kotlin escapes the $ of a placeholder inside a string
+	content = strings.ReplaceAll(content, `\$`, `$`)
+	references := make([]sourceReference, 0)
+	add := func(name string, prefix bool, offset int) {
+		if name = strings.TrimSpace(name); name != "" {
+			references = append(references, sourceReference{name: name, prefix: prefix, source: source, line: strings.Count(content[:offset], "\n") + 1})
+		}
+	}
+
+	// placeholders are read from every string so that @Scheduled(cron = "${...}") counts as well as @Value
+	for _, match := range stringLiteralRegex.FindAllStringSubmatchIndex(content, -1) {
+		for _, name := range placeholderNames(content[match[2]:match[3]]) {
+			add(name, false, match[0])
+		}
+	}
+	for _, match := range environmentCallRegex.FindAllStringSubmatchIndex(content, -1) {
+		add(content[match[2]:match[3]], false, match[0])
+	}
+	for _, match := range configurationPropsRegex.FindAllStringSubmatchIndex(content, -1) {
+		arguments := content[match[2]:match[3]]
+		if prefix := annotationPrefixRegex.FindStringSubmatch(arguments); prefix != nil {
+			add(prefix[1], true, match[0])
+		} else if names := annotationStrings(arguments); len(names) > 0 {
+			add(names[0], true, match[0])
+		}
+	}
+	for _, match := range conditionalOnPropertyRegex.FindAllStringSubmatchIndex(content, -1) {
+		arguments := content[match[2]:match[3]]
+		prefix := ""
+		if found := annotationPrefixRegex.FindStringSubmatch(arguments); found != nil {
+			prefix = strings.TrimSuffix(found[1], ".")
+		}
+		for _, name := range annotationStrings(arguments) {
+			if prefix != "" {
+				name = prefix + "." + name
+			}
+			add(name, false, match[0])
+		}
+	}
+	return references
+}
+
+// annotationStrings will return the names given to an annotation, either as name or value, or as its leading
+// unnamed argument
+func annotationStrings(arguments string) []string {
+	list := ""
+	if named := annotationNamesRegex.FindStringSubmatch(arguments); named != nil {
+		list = named[1]
+	} else if leading := leadingStringsRegex.FindStringSubmatch(arguments); leading != nil {
+		list = leading[1]
+	}
+	names := make([]string, 0)
+	for _, quoted := range quotedStringRegex.FindAllStringSubmatch(list, -1) {
+		names = append(names, quoted[1])
+	}
+	return names
+}
+
+// placeholderNames will return the property name of every ${...} placeholder in text, including those nested in
+// the name or default of another placeholder
+func placeholderNames(text string) []string {
+	names := make([]string, 0)
+	for {
+		start := strings.Index(text, placeholderPrefix)
+		if start < 0 {
+			return names
+		}
+		end := placeholderEnd(text, start)
+		if end < 0 {
+			return names
+		}
+		name, defaultValue, _ := splitPlaceholder(text[start+len(placeholderPrefix) : end])
+		if !strings.Contains(name, placeholderPrefix) {
+			names = append(names, name)
+		}
+		names = append(names, placeholderNames(name)...)
+		names = append(names, placeholderNames(defaultValue)...)
+		text = text[end+1:]
+	}
+}
@@ -0,0 +1,106 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	log "github.com/gkontos/bivalve-chronicles"
+)
+
+// frameworkPrefixes are the namespaces read by spring boot itself rather than by application code
+var frameworkPrefixes = []string{"spring", "server", "logging", "management", "info", "debug", "trace"}
+
+// RunUnused will prompt for a profile and list the properties no code reads
+func (appCtx *Pruner) RunUnused() {
+	runProfile, err := promptString("Spring Profile (single profile or a comma separated list)")
+	if err != nil {
+		log.Errorf("Error: %v", err)
+		return
+	}
+	if err := appCtx.FindUnused(runProfile, fileNames); err != nil {
+		log.Errorf("Error: %v", err)
+	}
+}
+
+// FindUnused will list every property of the merged profile that is not read by the java or kotlin code through
+// @Value, @ConfigurationProperties, @ConditionalOnProperty or Environment.getProperty, nor by another property's
+// placeholder.  Properties spring boot reads itself are left out unless the config asks for them
+func (appCtx *Pruner) FindUnused(runProfile string, contexts []string) error {
+	references, err := scanSourceReferences(appCtx.Config.ProjectRoot)
+	if err != nil {
+		return err
+	}
+	for _, context := range contexts {
+		properties, _, err := appCtx.effectiveProfile(runProfile, context)
+		if err != nil {
+			return err
+		}
+		unused := unusedProperties(properties, references, appCtx.Config.UnusedFrameworkKeys)
+		log.Infof("UNUSED PROPERTIES FOR %s (profiles: %s)", context, runProfile)
+		for _, p := range unused {
+			log.Infof("%s = %v\n    from %s", p.name, appCtx.displayed(p), sourceLocation(p))
+		}
+		log.Infof("%d of %d properties in %s are not read by any code", len(unused), properties.len(), context)
+	}
+	return nil
+}
+
+// unusedProperties will return the properties that no reference binds, comparing names with relaxed binding
+func unusedProperties(properties *propertySet, references []sourceReference, includeFramework bool) []property {
+	names := make([]string, 0)
+	prefixes := make([]string, 0)
+	for _, reference := range references {
+		if reference.prefix {
+			prefixes = append(prefixes, canonicalName(reference.name))
+		} else {
+			names = append(names, canonicalName(reference.name))
+		}
+	}
+	// a property read through another property's placeholder is as used as the property that reads it
+	for _, key := range properties.keys() {
+		p, _ := properties.get(key)
+		for _, value := range indexedProperties(p) {
+			if text, ok := value.value.(string); ok {
+				for _, name := range placeholderNames(text) {
+					names = append(names, canonicalName(name))
+				}
+			}
+		}
+	}
+
+	unused := make([]property, 0)
+	for _, key := range properties.keys() {
+		if !includeFramework {
+			if _, framework := Find(frameworkPrefixes, strings.SplitN(key, ".", 2)[0]); framework {
+				continue
+			}
+		}
+		if isReferenced(key, names, prefixes) {
+			continue
+		}
+		p, _ := properties.get(key)
+		unused = append(unused, p)
+	}
+	return unused
+}
+
+// isReferenced will report whether a canonical key is read by name, sits below a bound prefix, or is the list or
+// map holding a name that is read
+func isReferenced(key string, names []string, prefixes []string) bool {
+	for _, name := range names {
+		if name == key || isBelow(key, name) || isBelow(name, key) {
+			return true
+		}
+	}
+	for _, prefix := range prefixes {
+		if prefix == key || isBelow(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// isBelow will report whether the canonical name is nested within parent
+func isBelow(name string, parent string) bool {
+	return strings.HasPrefix(name, fmt.Sprintf("%s.", parent)) || strings.HasPrefix(name, fmt.Sprintf("%s[", parent))
+}
@@ -0,0 +1,85 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSourceFileReferences(t *testing.T) {
+	java := "@Configuration\n" +
+		"@ConfigurationProperties(prefix = \"app.mail\")\n" +
+		"@ConditionalOnProperty(prefix = \"feature.\", name = {\"enabled\", \"beta\"}, havingValue = \"true\")\n" +
+		"public class MailConfig {\n" +
+		"    @Value(\"${mail.host:${default-host}}\")\n" +
+		"    private String host;\n" +
+		"    String timeout() { return env.getProperty(\"mail.timeout\", \"10\"); }\n" +
+		"    @Scheduled(cron = \"${mail.cron}\") void send() {}\n" +
+		"}\n"
+	kotlin := "@ConfigurationProperties(\"cache\")\n" +
+		"@ConditionalOnProperty(\"audit.enabled\")\n" +
+		"class Cache(@Value(\"\\${cache.ttl}\") val ttl: Long)\n"
+
+	names := func(references []sourceReference) map[string]bool {
+		found := make(map[string]bool)
+		for _, reference := range references {
+			found[reference.name] = reference.prefix
+		}
+		return found
+	}
+	assert.EqualValues(t, map[string]bool{
+		"app.mail":        true,
+		"feature.enabled": false,
+		"feature.beta":    false,
+		"mail.host":       false,
+		"default-host":    false,
+		"mail.timeout":    false,
+		"mail.cron":       false,
+	}, names(sourceFileReferences(java, "MailConfig.java")))
+	assert.EqualValues(t, map[string]bool{
+		"cache":         true,
+		"audit.enabled": false,
+		"cache.ttl":     false,
+	}, names(sourceFileReferences(kotlin, "Cache.kt")))
+
+	references := sourceFileReferences(java, "MailConfig.java")
+	for _, reference := range references {
+		if reference.name == "mail.timeout" {
+			assert.EqualValues(t, 7, reference.line)
+		}
+	}
+}
+
+func TestUnusedProperties(t *testing.T) {
+	appCtx, cleanup := newTestPruner(t, map[string]string{
+		"application.yml": "server:\n  port: 8080\n" +
+			"app:\n  mail:\n    from: a@b\n" +
+			"mailHost: smtp\n" +
+			"url: http://${mail-host}/\n" +
+			"endpoint: ${url}\n" +
+			"legacy:\n  flag: true\n",
+	})
+	defer cleanup()
+	source := filepath.Join(appCtx.Config.ProjectRoot, "src/main/java/Mail.java")
+	assert.Nil(t, os.MkdirAll(filepath.Dir(source), 0755))
+	assert.Nil(t, ioutil.WriteFile(source, []byte(
+		"@ConfigurationProperties(prefix = \"app.mail\")\nclass Mail {\n  @Value(\"${endpoint}\") String endpoint;\n}\n"), 0644))
+
+	references, err := scanSourceReferences(appCtx.Config.ProjectRoot)
+	assert.Nil(t, err)
+	properties, err := appCtx.unionProfileAndContext("", "application")
+	assert.Nil(t, err)
+
+	unusedNames := func(includeFramework bool) []string {
+		names := make([]string, 0)
+		for _, p := range unusedProperties(properties, references, includeFramework) {
+			names = append(names, p.name)
+		}
+		return names
+	}
+	assert.EqualValues(t, []string{"legacy.flag"}, unusedNames(false))
+	assert.EqualValues(t, []string{"server.port", "legacy.flag"}, unusedNames(true))
+}
@@ -0,0 +1,131 @@
+package cmd
+
+import (
+	"fmt"
+
+	log "github.com/gkontos/bivalve-chronicles"
+)
+
+// verifyPruned will read back the pruned files of a context as they are written, merge every profile again from
+// them and compare each key with the merge before the prune.  Each difference is logged, and an error is returned
+// when there is any
+func (env *Pruner) verifyPruned(result prunedContext, strategy hoistStrategy) error {
+	pruned := make(map[string]*propertySet)
+	if !env.Config.InPlace && env.Config.OutputLayout == MultiDocumentLayout {
+		rendered, err := env.renderedDocuments(result)
+		if err != nil {
+			return err
+		}
+		pruned = rendered
+	}
+	for _, properties := range result.profileProperties {
+		if _, ok := pruned[properties.profile]; ok {
+			continue
+		}
+		rendered, err := env.renderedProfile(properties, result.targets)
+		if err != nil {
+			return err
+		}
+		pruned[properties.profile] = rendered
+	}
+	views, err := env.verifiedViews(result.context, strategy)
+	if err != nil {
+		return err
+	}
+	differences, err := env.prunedDifferences(views, result.context, pruned)
+	if err != nil {
+		return err
+	}
+	for _, difference := range differences {
+		log.Errorf("The pruned %s files change %s in the %s profile from %s to %s", result.context, difference.key,
+			difference.profile, env.describeDifference(difference.before), env.describeDifference(difference.after))
+	}
+	if len(differences) > 0 {
+		return fmt.Errorf("the pruned %s files change the effective configuration in %d places", result.context, len(differences))
+	}
+	log.Debugf("the pruned %s files produce the same configuration for %d profiles", result.context, len(views))
+	return nil
+}
+
+// renderedProfile will render a pruned profile the way it is written and read it back.  A profile is rendered to
+// its in place target when there is one, and otherwise as the separate file a prune writes to the output directory
+func (env *Pruner) renderedProfile(properties profilePropertyPruner, targets map[string]inPlaceTarget) (*propertySet, error) {
+	var content []byte
+	var err error
+	configType := profileConfigType(properties, env.Config.OutputFormat)
+	if target, ok := targets[properties.profile]; ok {
+		configType = target.configType
+		content, err = plannedContent(properties, target)
+	} else {
+		content, err = prunedDocument(properties, properties.changes, configType)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var documents []*propertySet
+	if configType == "properties" {
+		documents, err = parsePropertiesDocuments(content, "")
+	} else {
+		documents, err = parseYamlDocuments(content, "")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read back the pruned %s profile: %v", properties.profile, err)
+	}
+	rendered := newPropertySet()
+	for _, document := range documents {
+		rendered = rendered.merge(document)
+	}
+	return rendered, nil
+}
+
+// renderedDocuments will render the multi-document file of a context the way it is written and read it back, giving
+// each document to the profiles it is activated on, or to the default profile when it has no activation.  A pruned
+// profile without a document of its own is read back empty
+func (env *Pruner) renderedDocuments(result prunedContext) (map[string]*propertySet, error) {
+	files, err := renderOutput(result.profileProperties, result.context, MultiDocumentLayout, env.Config.OutputFormat)
+	if err != nil {
+		return nil, err
+	}
+	pruned := make(map[string]*propertySet)
+	for _, properties := range result.profileProperties {
+		pruned[properties.profile] = newPropertySet()
+	}
+	for _, file := range files {
+		var documents []*propertySet
+		if file.configType == "properties" {
+			documents, err = parsePropertiesDocuments(file.content, "")
+		} else {
+			documents, err = parseYamlDocuments(file.content, "")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("unable to read back the pruned %s: %v", file.name, err)
+		}
+		for _, document := range documents {
+			profiles, err := activationProfiles(document)
+			if err != nil {
+				return nil, fmt.Errorf("unable to read back the pruned %s: %v", file.name, err)
+			}
+			if len(profiles) == 0 {
+				if document.len() == 0 {
+					continue
+				}
+				profiles = []string{defaultProfileKey}
+			}
+			for _, profile := range profiles {
+				if _, ok := pruned[profile]; !ok {
+					pruned[profile] = newPropertySet()
+				}
+				pruned[profile] = pruned[profile].merge(document)
+			}
+		}
+	}
+	return pruned, nil
+}
+
+// describeDifference will show one side of a difference, masking secrets unless they are shown
+func (env *Pruner) describeDifference(p *property) string {
+	if p == nil {
+		return "unset"
+	}
+	return fmt.Sprint(env.displayed(*p))
+}
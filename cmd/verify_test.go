@@ -0,0 +1,65 @@
+package cmd
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerifyPruned(t *testing.T) {
+	appCtx, cleanup := newTestPruner(t, map[string]string{
+		"application.yml":      "name: base\n",
+		"application-dev.yml":  "name: shared\nport: 1\n",
+		"application-prod.yml": "name: shared\nport: 2\n",
+	})
+	defer cleanup()
+	appCtx.Config.InPlace = true
+	appCtx.Config.BackupDirectory = filepath.Join(appCtx.Config.ProjectRoot, "backups")
+	strategy, err := appCtx.hoistStrategy([]string{"dev", "prod"})
+	assert.Nil(t, err)
+
+	result, err := appCtx.pruneContext([]string{"dev", "prod"}, "application")
+	assert.Nil(t, err)
+	assert.Nil(t, appCtx.verifyPruned(result, strategy))
+
+	// dropping the port of the dev profile changes what it sees
+	for _, properties := range result.profileProperties {
+		if properties.profile == "dev" {
+			properties.changes[canonicalName("port")] = changeSet{key: "port", action: deleteAction, delete: true}
+			properties.properties.remove("port")
+		}
+	}
+	assert.EqualError(t, appCtx.verifyPruned(result, strategy), "the pruned application files change the effective configuration in 1 places")
+}
+
+func TestVerifyPrunedMultiDocument(t *testing.T) {
+	appCtx, cleanup := newTestPruner(t, map[string]string{
+		"application.yml":      "name: base\n",
+		"application-dev.yml":  "name: shared\nport: 1\n",
+		"application-prod.yml": "name: shared\nport: 2\n",
+	})
+	defer cleanup()
+	appCtx.Config.OutputLayout = MultiDocumentLayout
+	strategy, err := appCtx.hoistStrategy([]string{"dev", "prod"})
+	assert.Nil(t, err)
+
+	result, err := appCtx.pruneContext([]string{"dev", "prod"}, "application")
+	assert.Nil(t, err)
+	rendered, err := appCtx.renderedDocuments(result)
+	assert.Nil(t, err)
+	dev, ok := rendered["dev"]
+	assert.True(t, ok)
+	assert.EqualValues(t, []string{"port"}, dev.keys(), "the document is read back by its activation")
+	name, ok := rendered[defaultProfileKey].get("name")
+	assert.True(t, ok, "the document without an activation belongs to the default profile")
+	assert.EqualValues(t, "shared", name.value)
+	assert.Nil(t, appCtx.verifyPruned(result, strategy))
+
+	for _, properties := range result.profileProperties {
+		if properties.profile == "prod" {
+			properties.changes[canonicalName("port")] = changeSet{key: "port", action: deleteAction, delete: true}
+		}
+	}
+	assert.EqualError(t, appCtx.verifyPruned(result, strategy), "the pruned application files change the effective configuration in 1 places")
+}
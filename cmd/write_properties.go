@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+)
+
+// formatProperties will render a property set in java properties syntax.  Lists are written with [n] notation and
+// everything outside of printable ascii is escaped, since spring boot reads .properties files as ISO 8859-1
+func formatProperties(properties *propertySet) []byte {
+	var out strings.Builder
+	for _, key := range properties.keys() {
+		p, _ := properties.get(key)
+		for _, entry := range indexedProperties(p) {
+			out.WriteString(escapePropertiesKey(entry.name))
+			out.WriteString("=")
+			out.WriteString(escapePropertiesValue(propertiesValue(entry.value)))
+			out.WriteString("\n")
+		}
+	}
+	return []byte(out.String())
+}
+
+// propertiesValue will convert a loaded value to the text written after the separator
+func propertiesValue(value interface{}) string {
+	if value == nil {
+		return ""
+	}
+	return fmt.Sprint(value)
+}
+
+func escapePropertiesKey(key string) string {
+	return escapeProperties(key, true)
+}
+
+func escapePropertiesValue(value string) string {
+	return escapeProperties(value, false)
+}
+
+// escapeProperties will escape text for a properties file.  Keys escape every space and separator; values only
+// need a leading space escaped, but separators are escaped as well so the output reads the same either way
+func escapeProperties(text string, isKey bool) string {
+	var out strings.Builder
+	for i, r := range text {
+		switch r {
+		case '\\':
+			out.WriteString(`\\`)
+		case '\n':
+			out.WriteString(`\n`)
+		case '\r':
+			out.WriteString(`\r`)
+		case '\t':
+			out.WriteString(`\t`)
+		case '\f':
+			out.WriteString(`\f`)
+		case '=', ':':
+			out.WriteRune('\\')
+			out.WriteRune(r)
+		case '#', '!':
+			if i == 0 {
+				out.WriteRune('\\')
+			}
+			out.WriteRune(r)
+		case ' ':
+			if isKey || i == 0 {
+				out.WriteRune('\\')
+			}
+			out.WriteRune(r)
+		default:
+			if r < 0x20 || r > 0x7e {
+				out.WriteString(unicodeEscape(r))
+			} else {
+				out.WriteRune(r)
+			}
+		}
+	}
+	return out.String()
+}
+
+// unicodeEscape will write a rune as one \uXXXX escape, or a surrogate pair for runes outside the basic plane
+func unicodeEscape(r rune) string {
+	if r > 0xffff {
+		r -= 0x10000
+		return fmt.Sprintf(`\u%04x\u%04x`, 0xd800+(r>>10), 0xdc00+(r&0x3ff))
+	}
+	return fmt.Sprintf(`\u%04x`, r)
+}
@@ -0,0 +1,626 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	log "github.com/gkontos/bivalve-chronicles"
+	"github.com/gkontos/spiny-dogfish/cmd"
+	"github.com/gkontos/spiny-dogfish/config"
+)
+
+const (
+	exitSuccess = 0
+	exitFailure = 1
+	exitUsage   = 2
+)
+
+// subcommand is a non-interactive action that can be run from scripts or CI
+type subcommand struct {
+	name        string
+	description string
+	run         func(args []string) int
+}
+
+var subcommands []subcommand
+
+func init() {
+	subcommands = []subcommand{
+		{name: "view", description: "display the combined configuration for one or more profiles", run: runView},
+		{name: "prune", description: "consolidate duplicate properties across profiles and write pruned files", run: runPrune},
+		{name: "explain", description: "show the file and line each resolved value came from and the values it overrode", run: runExplain},
+		{name: "unused", description: "list the properties that no java or kotlin code reads", run: runUnused},
+		{name: "validate", description: "check properties against the spring configuration metadata of the project and its libraries", run: runValidate},
+		{name: "migrate", description: "rename keys that newer spring boot releases replaced, in every configuration file", run: runMigrate},
+		{name: "secrets", description: "list the plaintext passwords, tokens and keys in every configuration file", run: runSecrets},
+		{name: "bootstrap", description: "report keys repeated across the bootstrap and application contexts and move them where they belong", run: runBootstrap},
+		{name: "share", description: "move the keys every service sets to the same value into one shared file", run: runShare},
+		{name: "rollback", description: "restore the files changed by the last in-place prune from their backups", run: runRollback},
+	}
+}
+
+// runCommand will dispatch the command line arguments to a subcommand and return the process exit code
+func runCommand(args []string) int {
+	name := args[0]
+	if name == "help" || name == "-h" || name == "--help" {
+		printUsage()
+		return exitSuccess
+	}
+	for _, command := range subcommands {
+		if command.name == name {
+			return command.run(splitSystemProperties(args[1:]))
+		}
+	}
+	fmt.Fprintf(os.Stderr, "unknown command %q\n\n", name)
+	printUsage()
+	return exitUsage
+}
+
+func printUsage() {
+	fmt.Fprintf(os.Stderr, "Usage: spiny-dogfish <command> [flags]\n\n")
+	fmt.Fprintf(os.Stderr, "Running without a command starts the interactive menu.\n\nCommands:\n")
+	for _, command := range subcommands {
+		fmt.Fprintf(os.Stderr, "  %-9s %s\n", command.name, command.description)
+	}
+	fmt.Fprintf(os.Stderr, "\nRun 'spiny-dogfish <command> -h' for the flags of a command.\n")
+}
+
+// applicationFlags are the flags shared by every subcommand; each maps onto a config.Application field
+type applicationFlags struct {
+	configFile  string
+	services    string
+	projectRoot string
+	external    string
+	contexts    string
+	showSecrets bool
+	// the config server the application part of the configuration is read from
+	configServerDir string
+	configServerURL string
+	application     string
+	label           string
+	archives        string
+}
+
+func (f *applicationFlags) register(flags *flag.FlagSet) {
+	flags.StringVar(&f.configFile, "config", "", "path of the config file (default config.toml in the working directory)")
+	flags.StringVar(&f.services, "service", "", "comma separated services of the config file to run against (default every service)")
+	flags.StringVar(&f.projectRoot, "project-root", "", "spring application root directory (overrides project_root)")
+	flags.StringVar(&f.external, "external", "", "directory that holds external configuration files (overrides external_properties)")
+	flags.StringVar(&f.contexts, "context", "", "comma separated application contexts to process, ie: application,bootstrap (default all)")
+	flags.BoolVar(&f.showSecrets, "show-secrets", false, "show secret values instead of masking them (overrides show_secrets)")
+	flags.StringVar(&f.configServerDir, "config-server-dir", "", "config server repository holding application.yml and {application}-{profile}.yml (overrides config_server.directory)")
+	flags.StringVar(&f.configServerURL, "config-server-url", "", "config server read through its /{application}/{profile} api, ie: http://localhost:8888 (overrides config_server.url)")
+	flags.StringVar(&f.application, "application", "", "{application} name on the config server (overrides config_server.application, default spring.application.name)")
+	flags.StringVar(&f.label, "label", "", "git label requested from the config server url (overrides config_server.label)")
+	flags.StringVar(&f.archives, "archives", "", "comma separated jar and war files or globs whose packaged configuration is read (overrides archives, default target/*.jar)")
+}
+
+// environmentFlags select the environment layered over the configuration files, and whether the bootstrap files
+// are layered under them, by the commands that show the merged configuration
+type environmentFlags struct {
+	envFiles         string
+	processEnv       bool
+	systemProperties stringList
+	inheritBootstrap bool
+}
+
+func (f *environmentFlags) register(flags *flag.FlagSet) {
+	flags.StringVar(&f.envFiles, "env-file", "", "comma separated .env or env files of NAME=value lines (overrides environment_files)")
+	flags.BoolVar(&f.processEnv, "process-env", false, "layer the variables of this process over the configuration (overrides process_environment)")
+	flags.Var(&f.systemProperties, "D", "system property as name=value, may be repeated or written -Dname=value (adds to system_properties)")
+	flags.BoolVar(&f.inheritBootstrap, "inherit-bootstrap", false, "layer the bootstrap files under the application context (overrides inherit_bootstrap)")
+}
+
+func (f *environmentFlags) apply(appConf *config.Application) {
+	if f.envFiles != "" {
+		appConf.EnvironmentFiles = strings.Split(f.envFiles, ",")
+	}
+	if f.processEnv {
+		appConf.ProcessEnvironment = true
+	}
+	appConf.SystemProperties = append(appConf.SystemProperties, f.systemProperties...)
+	if f.inheritBootstrap {
+		appConf.InheritBootstrap = true
+	}
+}
+
+// stringList is a flag that may be repeated
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// splitSystemProperties will separate java style -Dname=value arguments into -D name=value for the flag package
+func splitSystemProperties(args []string) []string {
+	split := make([]string, 0, len(args))
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "-D") && len(arg) > 2 {
+			split = append(split, "-D", arg[2:])
+			continue
+		}
+		split = append(split, arg)
+	}
+	return split
+}
+
+// project is a single spring project a subcommand runs against; name is empty unless it is a declared service
+type project struct {
+	name string
+	conf *config.Application
+}
+
+// load will read the config file named by -config, or by --config before the subcommand, or config.toml when it is
+// present
+func (f *applicationFlags) load() (*config.AppConfig, error) {
+	path := f.configFile
+	if path == "" {
+		path = configFile
+	}
+	return loadConfigFile(path)
+}
+
+// projects will load the config file and return its projects
+func (f *applicationFlags) projects() ([]project, error) {
+	conf, err := f.load()
+	if err != nil {
+		return nil, err
+	}
+	return f.projectsOf(conf)
+}
+
+// projectsOf will return the project in [app] of a loaded config, or each selected service when the config declares
+// services and -project-root is not given.  The flags that were set override the values of each project
+func (f *applicationFlags) projectsOf(conf *config.AppConfig) ([]project, error) {
+	if len(conf.Services) == 0 || f.projectRoot != "" {
+		if f.services != "" {
+			return nil, fmt.Errorf("-service was given but no services are declared in the config file")
+		}
+		f.override(&conf.App)
+		if conf.App.ProjectRoot == "" {
+			return nil, fmt.Errorf("project_root must be set in %s or with -project-root", defaultConfigFile)
+		}
+		return []project{{conf: &conf.App}}, nil
+	}
+	services, err := conf.SelectServices(f.services)
+	if err != nil {
+		return nil, err
+	}
+	projects := make([]project, 0, len(services))
+	for _, service := range services {
+		app := conf.ForService(service)
+		f.override(&app)
+		projects = append(projects, project{name: service.Name, conf: &app})
+	}
+	return projects, nil
+}
+
+// override will replace the values of a project with any flags that were set
+func (f *applicationFlags) override(app *config.Application) {
+	if f.projectRoot != "" {
+		app.ProjectRoot = f.projectRoot
+	}
+	if f.external != "" {
+		app.ExternalConfiguration = f.external
+	}
+	if f.showSecrets {
+		app.ShowSecrets = true
+	}
+	if f.configServerDir != "" {
+		app.ConfigServer.Directory = f.configServerDir
+	}
+	if f.configServerURL != "" {
+		app.ConfigServer.URL = f.configServerURL
+	}
+	if f.application != "" {
+		app.ConfigServer.Application = f.application
+	}
+	if f.label != "" {
+		app.ConfigServer.Label = f.label
+	}
+	if f.archives != "" {
+		app.Archives = strings.Split(f.archives, ",")
+	}
+}
+
+// loadConfigFile will read a config file.  The default config.toml is optional, a file named with --config is not
+func loadConfigFile(path string) (*config.AppConfig, error) {
+	if path == defaultConfigFile {
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			return &config.AppConfig{}, nil
+		}
+	}
+	return config.LoadAppConfig(path)
+}
+
+func runView(args []string) int {
+	common := &applicationFlags{}
+	flags := flag.NewFlagSet("view", flag.ContinueOnError)
+	common.register(flags)
+	environment := &environmentFlags{}
+	environment.register(flags)
+	profile := flags.String("profile", "", "spring profile or comma separated list of profiles, ie: dev,cloud")
+	resolve := flags.Bool("resolve", false, "show ${...} placeholders resolved (overrides resolve_placeholders)")
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if *profile == "" {
+		fmt.Fprintln(os.Stderr, "view: -profile is required")
+		flags.Usage()
+		return exitUsage
+	}
+
+	return forEachProject(common, "view", func(appConf *config.Application) {
+		environment.apply(appConf)
+		if *resolve {
+			appConf.ResolvePlaceholders = true
+		}
+	}, func(contexts []string) error {
+		return organizer.ViewProfile(*profile, contexts)
+	})
+}
+
+func runPrune(args []string) int {
+	common := &applicationFlags{}
+	flags := flag.NewFlagSet("prune", flag.ContinueOnError)
+	common.register(flags)
+	profiles := flags.String("profiles", "", "semi-colon separated list of profiles to consolidate, ie: dev;prod (overrides profiles)")
+	out := flags.String("out", "", "directory the pruned files are written to (overrides output_directory)")
+	layout := flags.String("layout", "", "files or multi-document (overrides output_layout)")
+	format := flags.String("format", "", "yaml, properties or same as the input files (overrides output_format)")
+	inPlace := flags.Bool("in-place", false, "rewrite the original configuration files after backing them up (overrides in_place)")
+	compare := flags.String("compare", "", "raw or resolved, whether values are compared before or after resolving placeholders (overrides compare)")
+	strategy := flags.String("strategy", "", "strict, majority or threshold, which shared values are hoisted to the default profile (overrides hoist_strategy)")
+	threshold := flags.Int("threshold", 0, "percentage of the profiles that must share a value for the threshold strategy (overrides hoist_threshold)")
+	report := flags.String("report", "", "json or yaml format for the change report (overrides report_format)")
+	dryRun := flags.Bool("dry-run", false, "show the changes the prune would make and write them to pruned.patch without changing any files (overrides dry_run)")
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	return forEachProject(common, "prune", func(appConf *config.Application) {
+		if *out != "" {
+			appConf.OutputDirectory = *out
+		}
+		if *layout != "" {
+			appConf.OutputLayout = *layout
+		}
+		if *format != "" {
+			appConf.OutputFormat = *format
+		}
+		if *inPlace {
+			appConf.InPlace = true
+		}
+		if *compare != "" {
+			appConf.Compare = *compare
+		}
+		if *strategy != "" {
+			appConf.HoistStrategy = *strategy
+		}
+		if *threshold != 0 {
+			appConf.HoistThreshold = *threshold
+		}
+		if *report != "" {
+			appConf.ReportFormat = *report
+		}
+		if *dryRun {
+			appConf.DryRun = true
+		}
+	}, func(contexts []string) error {
+		selected := cmd.SplitProfiles(*profiles)
+		if len(selected) == 0 {
+			selected = organizer.Config.Profiles
+		}
+		return organizer.Prune(selected, contexts)
+	})
+}
+
+func runExplain(args []string) int {
+	common := &applicationFlags{}
+	flags := flag.NewFlagSet("explain", flag.ContinueOnError)
+	common.register(flags)
+	environment := &environmentFlags{}
+	environment.register(flags)
+	profile := flags.String("profile", "", "spring profile or comma separated list of profiles, ie: dev,cloud")
+	key := flags.String("key", "", "only explain this property and the properties nested below it")
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if *profile == "" {
+		fmt.Fprintln(os.Stderr, "explain: -profile is required")
+		flags.Usage()
+		return exitUsage
+	}
+
+	return forEachProject(common, "explain", func(appConf *config.Application) {
+		environment.apply(appConf)
+	}, func(contexts []string) error {
+		return organizer.Explain(*profile, contexts, *key)
+	})
+}
+
+func runUnused(args []string) int {
+	common := &applicationFlags{}
+	flags := flag.NewFlagSet("unused", flag.ContinueOnError)
+	common.register(flags)
+	environment := &environmentFlags{}
+	environment.register(flags)
+	profile := flags.String("profile", "", "spring profile or comma separated list of profiles, ie: dev,cloud")
+	framework := flags.Bool("framework", false, "also report keys spring boot reads itself (overrides unused_framework_keys)")
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if *profile == "" {
+		fmt.Fprintln(os.Stderr, "unused: -profile is required")
+		flags.Usage()
+		return exitUsage
+	}
+
+	return forEachProject(common, "unused", func(appConf *config.Application) {
+		environment.apply(appConf)
+		if *framework {
+			appConf.UnusedFrameworkKeys = true
+		}
+	}, func(contexts []string) error {
+		return organizer.FindUnused(*profile, contexts)
+	})
+}
+
+func runValidate(args []string) int {
+	common := &applicationFlags{}
+	flags := flag.NewFlagSet("validate", flag.ContinueOnError)
+	common.register(flags)
+	environment := &environmentFlags{}
+	environment.register(flags)
+	profile := flags.String("profile", "", "spring profile or comma separated list of profiles, ie: dev,cloud")
+	metadata := flags.String("metadata", "", "comma separated directories searched for spring-configuration-metadata.json (overrides metadata_directories)")
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if *profile == "" {
+		fmt.Fprintln(os.Stderr, "validate: -profile is required")
+		flags.Usage()
+		return exitUsage
+	}
+
+	return forEachProject(common, "validate", func(appConf *config.Application) {
+		environment.apply(appConf)
+		if *metadata != "" {
+			appConf.MetadataDirectories = strings.Split(*metadata, ",")
+		}
+	}, func(contexts []string) error {
+		return organizer.Validate(*profile, contexts)
+	})
+}
+
+func runMigrate(args []string) int {
+	common := &applicationFlags{}
+	flags := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	common.register(flags)
+	from := flags.String("from", "", "spring boot version the configuration was written for, ie: 2.3 (overrides migrate_from)")
+	to := flags.String("to", "", "spring boot version to migrate to, ie: 3.0 (overrides migrate_to)")
+	renames := flags.String("renames", "", "yaml file of extra renames applied before the built in ones (overrides rename_file)")
+	out := flags.String("out", "", "directory the change report and patch are written to (overrides output_directory)")
+	report := flags.String("report", "", "json or yaml format for the change report (overrides report_format)")
+	dryRun := flags.Bool("dry-run", false, "show the renames and write them to pruned.patch without changing any files (overrides dry_run)")
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	return forEachProject(common, "migrate", func(appConf *config.Application) {
+		if *from != "" {
+			appConf.MigrateFrom = *from
+		}
+		if *to != "" {
+			appConf.MigrateTo = *to
+		}
+		if *renames != "" {
+			appConf.RenameFile = *renames
+		}
+		if *out != "" {
+			appConf.OutputDirectory = *out
+		}
+		if *report != "" {
+			appConf.ReportFormat = *report
+		}
+		if *dryRun {
+			appConf.DryRun = true
+		}
+	}, func(contexts []string) error {
+		return organizer.Migrate(contexts)
+	})
+}
+
+func runSecrets(args []string) int {
+	common := &applicationFlags{}
+	flags := flag.NewFlagSet("secrets", flag.ContinueOnError)
+	common.register(flags)
+	out := flags.String("out", "", "directory the secrets report is written to (overrides output_directory)")
+	report := flags.String("report", "", "json or yaml format for the secrets report (overrides report_format)")
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	return forEachProject(common, "secrets", func(appConf *config.Application) {
+		if *out != "" {
+			appConf.OutputDirectory = *out
+		}
+		if *report != "" {
+			appConf.ReportFormat = *report
+		}
+	}, func(contexts []string) error {
+		return organizer.Secrets(contexts)
+	})
+}
+
+func runBootstrap(args []string) int {
+	common := &applicationFlags{}
+	flags := flag.NewFlagSet("bootstrap", flag.ContinueOnError)
+	common.register(flags)
+	profiles := flags.String("profiles", "", "semi-colon separated list of profiles to compare, ie: dev;prod (overrides profiles, default every profile)")
+	move := flags.Bool("move", false, "move each key to the context it belongs in and delete redundant copies")
+	bootstrapKeys := flags.String("bootstrap-keys", "", "comma separated keys or prefixes that also belong in the bootstrap context (overrides bootstrap_keys)")
+	out := flags.String("out", "", "directory the change report and patch are written to (overrides output_directory)")
+	report := flags.String("report", "", "json or yaml format for the change report (overrides report_format)")
+	dryRun := flags.Bool("dry-run", false, "show the moves and write them to pruned.patch without changing any files (overrides dry_run)")
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	return forEachProject(common, "bootstrap", func(appConf *config.Application) {
+		if *bootstrapKeys != "" {
+			appConf.BootstrapKeys = strings.Split(*bootstrapKeys, ",")
+		}
+		if *out != "" {
+			appConf.OutputDirectory = *out
+		}
+		if *report != "" {
+			appConf.ReportFormat = *report
+		}
+		if *dryRun {
+			appConf.DryRun = true
+		}
+	}, func(contexts []string) error {
+		return organizer.Bootstrap(cmd.SplitProfiles(*profiles), *move)
+	})
+}
+
+func runShare(args []string) int {
+	common := &applicationFlags{}
+	flags := flag.NewFlagSet("share", flag.ContinueOnError)
+	common.register(flags)
+	sharedFile := flags.String("shared-file", "", "file the shared keys are moved to (overrides shared_file, default the config server's application.yml)")
+	out := flags.String("out", "", "directory the change report and patch are written to (overrides output_directory)")
+	report := flags.String("report", "", "json or yaml format for the change report (overrides report_format)")
+	dryRun := flags.Bool("dry-run", false, "show the changes and write them to pruned.patch without changing any files (overrides dry_run)")
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	conf, err := common.load()
+	if err != nil {
+		log.Errorf("%v", err)
+		return exitFailure
+	}
+	projects, err := common.projectsOf(conf)
+	if err != nil {
+		log.Errorf("%v", err)
+		return exitFailure
+	}
+	services := make([]*cmd.Pruner, 0, len(projects))
+	for _, project := range projects {
+		if project.name == "" {
+			log.Errorf("share needs the services of a config file")
+			return exitFailure
+		}
+		setupApplication(project.conf)
+		organizer.Service = project.name
+		organizer.LoadConfigFileMetadata()
+		services = append(services, organizer)
+	}
+
+	// the shared file, report and backups belong to every service rather than to one of them
+	common.override(&conf.App)
+	if *sharedFile != "" {
+		conf.App.SharedFile = *sharedFile
+	}
+	if *out != "" {
+		conf.App.OutputDirectory = *out
+	}
+	if *report != "" {
+		conf.App.ReportFormat = *report
+	}
+	if *dryRun {
+		conf.App.DryRun = true
+	}
+	setupApplication(&conf.App)
+	if err := organizer.Share(services); err != nil {
+		log.Errorf("share failed: %v", err)
+		return exitFailure
+	}
+	return exitSuccess
+}
+
+func runRollback(args []string) int {
+	flags := flag.NewFlagSet("rollback", flag.ContinueOnError)
+	path := flags.String("config", "", "path of the config file (default config.toml in the working directory)")
+	service := flags.String("service", "", "restore a backup of this service rather than one made by share")
+	backupDirectory := flags.String("backup-dir", "", "directory holding the in-place backups (overrides backup_directory)")
+	session := flags.String("session", "", "timestamp of the backup to restore (default the most recent)")
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	directory := *backupDirectory
+	if directory == "" || *service != "" {
+		if *path == "" {
+			*path = configFile
+		}
+		conf, err := loadConfigFile(*path)
+		if err != nil {
+			log.Errorf("%v", err)
+			return exitFailure
+		}
+		if directory != "" {
+			conf.App.BackupDirectory = directory
+		}
+		directory = conf.App.BackupDirectory
+		if *service != "" {
+			services, err := conf.SelectServices(*service)
+			if err != nil {
+				log.Errorf("%v", err)
+				return exitFailure
+			}
+			directory = conf.ForService(services[0]).BackupDirectory
+		}
+	}
+	if err := cmd.Rollback(directory, *session); err != nil {
+		log.Errorf("rollback failed: %v", err)
+		return exitFailure
+	}
+	return exitSuccess
+}
+
+// forEachProject will run a subcommand against the project in [app], or against each selected service when the
+// config declares services.  configure applies the subcommand's flags before the project's files are scanned.  Every
+// service is run even when one of them fails
+func forEachProject(common *applicationFlags, name string, configure func(*config.Application), run func(contexts []string) error) int {
+	contexts, err := cmd.ParseContexts(common.contexts)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+	projects, err := common.projects()
+	if err != nil {
+		log.Errorf("%v", err)
+		return exitFailure
+	}
+	code := exitSuccess
+	for _, project := range projects {
+		if configure != nil {
+			configure(project.conf)
+		}
+		if project.name != "" {
+			log.Infof("SERVICE %s", project.name)
+		}
+		setupApplication(project.conf)
+		organizer.Service = project.name
+		organizer.LoadConfigFileMetadata()
+		if err := run(contexts); err != nil {
+			if project.name != "" {
+				log.Errorf("%s failed for %s: %v", name, project.name, err)
+			} else {
+				log.Errorf("%s failed: %v", name, err)
+			}
+			code = exitFailure
+		}
+	}
+	return code
+}
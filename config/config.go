@@ -3,6 +3,8 @@ package config
 import (
 	"fmt"
 	"io/ioutil"
+	"path/filepath"
+	"strings"
 
 	"github.com/BurntSushi/toml"
 )
@@ -10,14 +12,116 @@ import (
 // AppConfig is the top level config
 type AppConfig struct {
 	App Application `toml:"app"`
+	// Services are the projects of a monorepo, or of several repositories, that share the settings in App
+	Services []Service `toml:"services"`
+}
+
+// Service is a single project of a multi-service config.  Every setting it does not name is taken from App
+type Service struct {
+	Name                  string   `toml:"name"`
+	ProjectRoot           string   `toml:"project_root"`
+	ExternalConfiguration string   `toml:"external_properties"`
+	Profiles              []string `toml:"profiles"`
+	// Application is the service's name on the config server; defaults to its spring.application.name
+	Application string `toml:"application"`
 }
 
 // Application contains configurations for the app
 type Application struct {
 	ProjectRoot           string `toml:"project_root"`
 	ExternalConfiguration string `toml:"external_properties"`
+	// Profiles are consolidated by a prune when none are given
+	Profiles []string `toml:"profiles"`
+	// SharedFile is the file that share hoists the keys set to the same value by every service into; defaults to
+	// application.yml in the config server directory
+	SharedFile string `toml:"shared_file"`
+	// OutputDirectory is where pruned files are written; defaults to the working directory
+	OutputDirectory string `toml:"output_directory"`
+	// OutputLayout is either files (one pruned file per profile) or multi-document (one file per context)
+	OutputLayout string `toml:"output_layout"`
+	// OutputFormat is yaml, properties, or same to write each profile in the format of its own files
+	OutputFormat string `toml:"output_format"`
+	// Precedence selects the spring boot merge order: current (2.4 and later) or legacy (2.3 and earlier)
+	Precedence string `toml:"precedence"`
+	// ResolvePlaceholders shows ${...} references resolved against the merged profile and the environment
+	ResolvePlaceholders bool `toml:"resolve_placeholders"`
+	// Compare is raw to compare the values of each profile as they are written, or resolved to compare them after
+	// their placeholders are resolved
+	Compare string `toml:"compare"`
+	// HoistStrategy decides which values a prune hoists to the default profile: strict only hoists a value every
+	// profile shares, majority one shared by more than half of them, and threshold one shared by HoistThreshold percent
+	HoistStrategy string `toml:"hoist_strategy"`
+	// HoistThreshold is the percentage of the profiles that must share a value for the threshold strategy to hoist it
+	HoistThreshold int `toml:"hoist_threshold"`
+	// ShowSecrets shows the values of passwords, tokens and other secrets instead of masking them in logs and reports
+	ShowSecrets bool `toml:"show_secrets"`
+	// ProcessEnvironment layers the variables of this process over the configuration files the way spring does
+	ProcessEnvironment bool `toml:"process_environment"`
+	// EnvironmentFiles are .env or env files of NAME=value lines layered over the process environment, later files
+	// winning
+	EnvironmentFiles []string `toml:"environment_files"`
+	// SystemProperties are name=value pairs layered over the environment the way -D java system properties are
+	SystemProperties []string `toml:"system_properties"`
+	// InheritBootstrap layers the bootstrap files under the application files when the application context is shown,
+	// the way spring cloud makes the bootstrap properties visible to the application
+	InheritBootstrap bool `toml:"inherit_bootstrap"`
+	// BootstrapKeys are extra keys, and prefixes of keys, that belong in the bootstrap context along with
+	// spring.application.name, spring.cloud.config and the other keys that locate remote configuration
+	BootstrapKeys []string `toml:"bootstrap_keys"`
+	// UnusedFrameworkKeys also reports spring, server, logging and the other keys spring boot reads itself as unused
+	UnusedFrameworkKeys bool `toml:"unused_framework_keys"`
+	// MetadataDirectories are searched for spring-configuration-metadata.json, such as a directory of extracted jars,
+	// in addition to the target/classes and build directories of the project
+	MetadataDirectories []string `toml:"metadata_directories"`
+	// Archives are jar and war files, or globs of them, whose packaged configuration is read as part of the classpath;
+	// when none are set target/*.jar and target/*.war below the project root are read
+	Archives []string `toml:"archives"`
+	// MigrateFrom and MigrateTo limit migrate to the renames of the spring boot releases after MigrateFrom up to and
+	// including MigrateTo; either may be blank
+	MigrateFrom string `toml:"migrate_from"`
+	MigrateTo   string `toml:"migrate_to"`
+	// RenameFile is a yaml mapping of old keys to new keys that migrate applies before the built in renames
+	RenameFile string `toml:"rename_file"`
+	// InPlace rewrites the original configuration files instead of writing pruned copies to OutputDirectory
+	InPlace bool `toml:"in_place"`
+	// BackupDirectory holds the timestamped copies of each file rewritten in place
+	BackupDirectory string `toml:"backup_directory"`
+	// DryRun writes a patch of the changes an in place prune would make instead of changing any files
+	DryRun bool `toml:"dry_run"`
+	// ReportFormat is the format of the change report written by a prune: json or yaml
+	ReportFormat string       `toml:"report_format"`
+	Scan         Scan         `toml:"scan"`
+	ConfigServer ConfigServer `toml:"config_server"`
+}
+
+// ConfigServer describes the spring cloud config server that serves the application part of its configuration
+type ConfigServer struct {
+	// Directory is a config server repository in the native or git layout: application.yml shared by every service
+	// next to {application}.yml and {application}-{profile}.yml
+	Directory string `toml:"directory"`
+	// URL is a running config server, or a stand in for one, read through its /{application}/{profile} api
+	URL string `toml:"url"`
+	// Application is the {application} name of the service; defaults to spring.application.name
+	Application string `toml:"application"`
+	// Label is the git branch, tag or commit requested from URL; blank uses the server's default label
+	Label string `toml:"label"`
+}
+
+// Scan controls how the configuration directories are crawled
+type Scan struct {
+	// Include limits the scan to files matching at least one glob; patterns containing a / match the path relative to the scanned directory, others match the file name
+	Include []string `toml:"include"`
+	// Exclude skips files and directories matching any glob, using the same rules as Include
+	Exclude []string `toml:"exclude"`
+	// FollowSymlinks will descend into symlinked directories and read symlinked files
+	FollowSymlinks bool `toml:"follow_symlinks"`
+	// MaxDepth limits how many directories below the scanned directory are visited; 0 is unlimited
+	MaxDepth int `toml:"max_depth"`
 }
 
+// DefaultBackupDirectory is the directory in-place rewrites back up to when backup_directory is not set
+const DefaultBackupDirectory = ".spiny-dogfish-backups"
+
 // LoadAppConfig will load configs from a toml config file
 func LoadAppConfig(file string) (*AppConfig, error) {
 	conf := &AppConfig{}
@@ -32,5 +136,69 @@ func LoadAppConfig(file string) (*AppConfig, error) {
 	if _, err := toml.Decode(string(tomlData), &conf); err != nil {
 		return nil, fmt.Errorf("could not read config file %q: %v", file, err)
 	}
+	if err := conf.validate(); err != nil {
+		return nil, fmt.Errorf("invalid config file %q: %v", file, err)
+	}
 	return conf, nil
 }
+
+// ForService will return the settings of App with the project of a service.  Pruned files, reports and backups are
+// kept in a subdirectory named after the service so services do not overwrite each other's
+func (conf *AppConfig) ForService(service Service) Application {
+	app := conf.App
+	app.ProjectRoot = service.ProjectRoot
+	app.ExternalConfiguration = service.ExternalConfiguration
+	if len(service.Profiles) > 0 {
+		app.Profiles = service.Profiles
+	}
+	if service.Application != "" {
+		app.ConfigServer.Application = service.Application
+	}
+	app.OutputDirectory = filepath.Join(app.OutputDirectory, service.Name)
+	backupDirectory := app.BackupDirectory
+	if backupDirectory == "" {
+		backupDirectory = DefaultBackupDirectory
+	}
+	app.BackupDirectory = filepath.Join(backupDirectory, service.Name)
+	return app
+}
+
+// SelectServices will return the services named in a comma separated list, or every service when the list is empty
+func (conf *AppConfig) SelectServices(names string) ([]Service, error) {
+	if strings.TrimSpace(names) == "" {
+		return conf.Services, nil
+	}
+	selected := make([]Service, 0)
+	for _, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+		found := false
+		for _, service := range conf.Services {
+			if service.Name == name {
+				selected = append(selected, service)
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown service %q", name)
+		}
+	}
+	return selected, nil
+}
+
+// validate will check that every service can be told apart and has a project
+func (conf *AppConfig) validate() error {
+	names := make(map[string]bool)
+	for i, service := range conf.Services {
+		if service.Name == "" {
+			return fmt.Errorf("service %d has no name", i+1)
+		}
+		if names[service.Name] {
+			return fmt.Errorf("service %q is declared more than once", service.Name)
+		}
+		names[service.Name] = true
+		if service.ProjectRoot == "" {
+			return fmt.Errorf("service %q has no project_root", service.Name)
+		}
+	}
+	return nil
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"os"
+	"strings"
 
 	log "github.com/gkontos/bivalve-chronicles"
 	"github.com/gkontos/spiny-dogfish/cmd"
@@ -16,25 +17,53 @@ const (
 	exitAction           = "Exit"
 	viewProfileAction    = "View Profile Configuration"
 	optimizeConfigAction = "Optimize Configuration"
+	explainAction        = "Explain Property Values"
+	unusedAction         = "Find Unused Properties"
+	validateAction       = "Validate Against Metadata"
+	migrateAction        = "Migrate Renamed Properties"
+	secretsAction        = "List Plaintext Secrets"
+	bootstrapAction      = "Compare Bootstrap And Application"
+	rollbackAction       = "Roll Back In-Place Changes"
+
+	defaultConfigFile = "config.toml"
 )
 
 var organizer *cmd.Pruner
 
-func main() {
-	v := getConfig()
+// configFile is the config file read by the menu and by subcommands that are not given -config
+var configFile = defaultConfigFile
 
+func main() {
 	setupLogging()
-	log.Info("Welcome to the Properties Compactor")
-	log.Debugf("getConfig result: %v", v)
 
-	setupApplication(&v.App)
+	args, err := globalFlags(os.Args[1:])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(exitUsage)
+	}
+	// subcommands run non-interactively; the menu is only a fallback when none is given
+	if len(args) > 0 {
+		os.Exit(runCommand(args))
+	}
 
-	action, err := getAction()
+	v, err := getConfig()
+	if err != nil {
+		panic(err.Error())
+	}
 
-	organizer.ConfigFiles = make(map[int8][]model.JavaConfigFileMetadata)
+	log.Info("Welcome to the Properties Compactor")
+	log.Debugf("getConfig result: %v", v)
+
+	app, err := selectService(v)
+	if err != nil {
+		panic(err.Error())
+	}
+	setupApplication(app)
 
 	organizer.LoadConfigFileMetadata()
 
+	action, err := getAction()
+
 	for {
 		if err != nil {
 			log.Errorf("Error: %v", err)
@@ -48,6 +77,27 @@ func main() {
 		if action == optimizeConfigAction {
 			organizer.PruneProperties()
 		}
+		if action == explainAction {
+			organizer.RunExplain()
+		}
+		if action == unusedAction {
+			organizer.RunUnused()
+		}
+		if action == validateAction {
+			organizer.RunValidate()
+		}
+		if action == migrateAction {
+			organizer.RunMigrate()
+		}
+		if action == secretsAction {
+			organizer.RunSecrets()
+		}
+		if action == bootstrapAction {
+			organizer.RunBootstrap()
+		}
+		if action == rollbackAction {
+			organizer.RunRollback()
+		}
 		action, err = getAction()
 	}
 }
@@ -55,7 +105,7 @@ func main() {
 func getAction() (string, error) {
 	prompt := promptui.Select{
 		Label: "Select Action",
-		Items: []string{exitAction, viewProfileAction, optimizeConfigAction},
+		Items: []string{exitAction, viewProfileAction, optimizeConfigAction, explainAction, unusedAction, validateAction, migrateAction, secretsAction, bootstrapAction, rollbackAction},
 	}
 
 	_, result, err := prompt.Run()
@@ -69,27 +119,65 @@ func getAction() (string, error) {
 	return result, nil
 }
 
-func getConfig() *config.AppConfig {
+// globalFlags will take --config path (or --config=path) from the front of the arguments, returning the rest
+func globalFlags(args []string) ([]string, error) {
+	for len(args) > 0 {
+		arg := args[0]
+		switch {
+		case arg == "--config" || arg == "-config":
+			if len(args) < 2 {
+				return nil, fmt.Errorf("%s needs the path of a config file", arg)
+			}
+			configFile, args = args[1], args[2:]
+		case strings.HasPrefix(arg, "--config=") || strings.HasPrefix(arg, "-config="):
+			configFile, args = arg[strings.Index(arg, "=")+1:], args[1:]
+		default:
+			return args, nil
+		}
+	}
+	return args, nil
+}
+
+func getConfig() (*config.AppConfig, error) {
 
 	var filename string
 
-	if _, err := os.Stat("config.toml"); err == nil {
-		filename = "config.toml"
+	if _, err := os.Stat(configFile); err == nil {
+		filename = configFile
 	} else {
-		panic("No configuration available.  Exiting.")
+		return nil, fmt.Errorf("No configuration available at %s.  Exiting.", configFile)
 	}
 
-	if conf, err := config.LoadAppConfig(filename); err != nil {
-		panic(fmt.Sprintf("Unable to get configuration - %s", err))
-	} else {
-		return conf
+	conf, err := config.LoadAppConfig(filename)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to get configuration - %s", err)
 	}
+	return conf, nil
+}
+
+// selectService will prompt for the service the menu works on when the config declares services
+func selectService(conf *config.AppConfig) (*config.Application, error) {
+	if len(conf.Services) == 0 {
+		return &conf.App, nil
+	}
+	names := make([]string, 0, len(conf.Services))
+	for _, service := range conf.Services {
+		names = append(names, service.Name)
+	}
+	prompt := promptui.Select{Label: "Select Service", Items: names}
+	index, _, err := prompt.Run()
+	if err != nil {
+		return nil, err
+	}
+	app := conf.ForService(conf.Services[index])
+	return &app, nil
 }
 
 func setupApplication(appConf *config.Application) {
 	log.Debugf("in application %+v", appConf)
 	organizer = &cmd.Pruner{}
 	organizer.Config = appConf
+	organizer.ConfigFiles = make(map[int8][]model.JavaConfigFileMetadata)
 }
 
 func setupLogging() {
@@ -12,6 +12,20 @@ type JavaConfigFileMetadata struct {
 
 	// bootstrap vs application
 	ApplicationContext string
+
+	// index of the document within a multi-document file that this entry reads
+	Document int
+
+	// directory of the file relative to the scanned directory, using forward slashes; empty for the scanned directory itself
+	Location string
+
+	// config server application the file belongs to, ie: order-service for order-service-dev.yml; empty for the
+	// application files shared by every service and for files outside of a config server
+	Application string
+
+	// jar or war the file is packaged in, in which case Path names the entry as app.jar!/BOOT-INF/classes/application.yml;
+	// empty for files on disk
+	Archive string
 }
 
 type JavaConfig struct {